@@ -0,0 +1,149 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// usage is the traffic of a single day.
+type usage struct {
+	requests int
+	sent     int64
+	received int64
+}
+
+// AccountingTransport is a http.RoundTripper that totals the requests and body bytes sent and received for each
+// UTC day crawled, as given by ghsearch.CrawledDay, or each day they're sent if not crawling one. The bytes
+// received are those on the wire: it asks for and decodes gzip itself rather than leave it to Base, which
+// would hide the compressed size.
+type AccountingTransport struct {
+	Base http.RoundTripper
+
+	mu   sync.Mutex
+	days map[string]*usage
+}
+
+// add records traffic against day.
+func (t *AccountingTransport) add(day string, requests int, sent, received int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.days == nil {
+		t.days = make(map[string]*usage)
+	}
+	u, ok := t.days[day]
+	if !ok {
+		u = &usage{}
+		t.days[day] = u
+	}
+	u.requests += requests
+	u.sent += sent
+	u.received += received
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *AccountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	day, ok := ghsearch.CrawledDay(req.Context())
+	if !ok {
+		day = time.Now().UTC()
+	}
+	key := day.Format(time.DateOnly)
+	t.add(key, 1, max(req.ContentLength, 0), 0)
+	// A caller asking for an encoding decodes it, otherwise gzip is asked for and decoded here
+	decode := req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == ""
+	if decode {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, t: t, day: key}
+	if decode && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		resp.Body = &gzipBody{body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+// Requests returns the total number of requests sent.
+func (t *AccountingTransport) Requests() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var requests int
+	for _, u := range t.days {
+		requests += u.requests
+	}
+	return requests
+}
+
+// Summary describes the requests and bytes of each day, such as 2024-01-02: requests=10 sent=1234 received=56789.
+func (t *AccountingTransport) Summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.days) == 0 {
+		return "none"
+	}
+	days := make([]string, 0, len(t.days))
+	for day := range t.days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	parts := make([]string, 0, len(days))
+	for _, day := range days {
+		u := t.days[day]
+		parts = append(parts, fmt.Sprintf("%s: requests=%d sent=%d received=%d", day, u.requests, u.sent, u.received))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// countingBody adds the bytes read from a response body to an AccountingTransport.
+type countingBody struct {
+	io.ReadCloser
+	t   *AccountingTransport
+	day string
+}
+
+// Read implements io.Reader.
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.t.add(b.day, 0, 0, int64(n))
+	}
+	return n, err
+}
+
+// gzipBody decodes a gzip response body, opened on the first Read so an empty body, such as of a HEAD request,
+// only fails if read.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+// Read implements io.Reader.
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+// Close implements io.Closer.
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
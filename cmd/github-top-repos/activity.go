@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// FetchParticipation returns the weekly commit counts of a repository for the last 52 weeks, oldest first.
+// GitHub computes the statistics in the background, so the request is retried up to retries times, waiting
+// wait between each, until they are ready. An empty repository has no statistics and returns nil.
+func FetchParticipation(ctx context.Context, client *http.Client, restURL, nameWithOwner string, retries int, wait time.Duration) ([]int, error) {
+	// https://docs.github.com/en/rest/metrics/statistics#get-the-weekly-commit-count
+	for attempt := 0; ; attempt++ {
+		var participation struct {
+			All []int `json:"all"`
+		}
+		_, err := restGet(ctx, client, restURL+"/repos/"+nameWithOwner+"/stats/participation", &participation)
+		var restErr *RESTError
+		if errors.As(err, &restErr) && restErr.StatusCode == http.StatusNoContent {
+			return nil, nil
+		} else if errors.As(err, &restErr) && restErr.StatusCode == http.StatusAccepted && attempt < retries {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return participation.All, nil
+	}
+}
+
+// commitActivityMain implements the commit-activity subcommand.
+func commitActivityMain(ctx context.Context, args []string) {
+	// Statistics are expensive, so default to a slower pace than other enrichments
+	fs := newEnrichFlags("commit-activity", 2, time.Second)
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	retries := fs.Int("stats-retries", 5, "times to retry while GitHub computes the statistics of a repository")
+	wait := fs.Duration("stats-wait", 3*time.Second, "time to wait between retries while GitHub computes the statistics")
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewHTTPClient(ctx, transports.REST, Token("rest"))
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name_with_owner", "total_commits", "weekly_commits"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		weeks, err := FetchParticipation(ctx, client, *restURL, repo.NameWithOwner, *retries, *wait)
+		if err != nil {
+			log.Printf("Failed to fetch commit activity of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		var total int
+		counts := make([]string, len(weeks))
+		for i, count := range weeks {
+			total += count
+			counts[i] = FormatInt(count)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]string{repo.NameWithOwner, FormatInt(total), strings.Join(counts, ";")})
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to fetch commit activity of %d repositories", n)
+	}
+}
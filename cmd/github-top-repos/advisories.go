@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// CountAdvisories returns the number of published security advisories of a repository.
+func CountAdvisories(ctx context.Context, client *http.Client, restURL, nameWithOwner string) (int, error) {
+	// https://docs.github.com/en/rest/security-advisories/repository-advisories
+	return restCount(ctx, client, restURL+"/repos/"+nameWithOwner+"/security-advisories?state=published&per_page=100")
+}
+
+// CountVulnerabilityAlerts returns the number of open vulnerability alerts of a repository,
+// which requires access to the alerts of the repository.
+func CountVulnerabilityAlerts(ctx context.Context, client *githubv4.Client, nameWithOwner string) (int, error) {
+	owner, name, _ := strings.Cut(nameWithOwner, "/")
+	// https://docs.github.com/en/graphql/reference/objects#repositoryvulnerabilityalert
+	var q struct {
+		Repository struct {
+			VulnerabilityAlerts struct {
+				TotalCount int
+			} `graphql:"vulnerabilityAlerts(states: OPEN)"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	if err := client.Query(ctx, &q, map[string]any{
+		"owner": githubv4.String(owner),
+		"name":  githubv4.String(name),
+	}); err != nil {
+		return 0, err
+	}
+	return q.Repository.VulnerabilityAlerts.TotalCount, nil
+}
+
+// advisoriesMain implements the advisories subcommand.
+func advisoriesMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("advisories", 4, 100*time.Millisecond)
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	alerts := fs.Bool("alerts", false, "also count open vulnerability alerts")
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	httpClient := NewHTTPClient(ctx, transports.REST, Token("rest"))
+	client := NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql"))
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	// Counts are left empty where they are not accessible
+	w.Write([]string{"name_with_owner", "published_advisories", "vulnerability_alerts"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		record := []string{repo.NameWithOwner, "", ""}
+		advisories, err := CountAdvisories(ctx, httpClient, *restURL, repo.NameWithOwner)
+		var restErr *RESTError
+		if errors.As(err, &restErr) && restErr.StatusCode == http.StatusNotFound {
+			// Advisories are not accessible for this repository, leave it empty
+		} else if err != nil {
+			log.Printf("Failed to count advisories of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		} else {
+			record[1] = FormatInt(advisories)
+		}
+		if *alerts {
+			if count, err := CountVulnerabilityAlerts(ctx, client, repo.NameWithOwner); err == nil {
+				record[2] = FormatInt(count)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(record)
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to count advisories of %d repositories", n)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/retry"
+)
+
+// APIFlags are the flags of the transport stack shared by every subcommand sending API requests: the audit log
+// and budget of the requests actually sent, and the retries of those that fail.
+type APIFlags struct {
+	AuditLog      *string
+	MaxAPICalls   *int64
+	MaxAttempts   *int
+	RetryMaxDelay *time.Duration
+
+	audit *os.File
+}
+
+// AddAPIFlags defines the APIFlags on fs.
+func AddAPIFlags(fs *flag.FlagSet) *APIFlags {
+	return &APIFlags{
+		AuditLog:      fs.String("audit-log", "", "append an NDJSON record of every API request to this file"),
+		MaxAPICalls:   fs.Int64("max-api-calls", 0, "stop cleanly after this many API calls (0 for unlimited)"),
+		MaxAttempts:   fs.Int("max-attempts", 5, "times to send a request failing with a rate limit, server error or timeout before giving up"),
+		RetryMaxDelay: fs.Duration("retry-max-delay", 15*time.Minute, "longest wait before retrying a request, including any Retry-After or rate limit reset"),
+	}
+}
+
+// Meter wraps base, which sends the requests, in the audit log of -audit-log and the budget of -max-api-calls.
+// It is called once, below the rate limits and retries of every API, so each request sent is recorded and
+// counted once, retries included.
+func (f *APIFlags) Meter(base http.RoundTripper) (http.RoundTripper, error) {
+	transport := base
+	if *f.AuditLog != "" {
+		file, err := os.OpenFile(*f.AuditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		f.audit = file
+		transport = NewAuditTransport(transport, file)
+	}
+	if *f.MaxAPICalls > 0 {
+		budget := &BudgetTransport{Base: transport}
+		budget.Remaining.Store(*f.MaxAPICalls)
+		transport = budget
+	}
+	return transport, nil
+}
+
+// Retry wraps t, once rate limited, in the retries of -max-attempts, which still go through the rate limit,
+// and pauses it on SIGUSR1 until SIGUSR2.
+func (f *APIFlags) Retry(ctx context.Context, t http.RoundTripper) http.RoundTripper {
+	t = retry.NewTransport(t, *f.MaxAttempts, *f.RetryMaxDelay)
+	return NewPauseTransport(ctx, t)
+}
+
+// Close closes the audit log, if any.
+func (f *APIFlags) Close() error {
+	if f.audit == nil {
+		return nil
+	}
+	return f.audit.Close()
+}
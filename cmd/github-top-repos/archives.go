@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// ArchiveURL returns the codeload URL of the default branch archive of a repository, format is tar.gz or zip.
+func ArchiveURL(baseURL, format, nameWithOwner string) string {
+	return fmt.Sprintf("%s/%s/%s/HEAD", baseURL, nameWithOwner, format)
+}
+
+// errPermanent marks a download failure that will not succeed on retry.
+var errPermanent = errors.New("permanent failure")
+
+// DownloadArchive downloads url to target, returning the number of bytes and their SHA-256 checksum.
+// The archive is written to a temporary file and renamed once complete, so target only exists for finished downloads.
+func DownloadArchive(ctx context.Context, client *http.Client, url, target string) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("non-200 OK status code: %v", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			err = fmt.Errorf("%w: %v", errPermanent, err)
+		}
+		return 0, "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, "", err
+	}
+	tmp := target + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// downloadArchivesMain implements the download-archives subcommand.
+func downloadArchivesMain(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("download-archives", flag.ExitOnError)
+	dir := fs.String("dir", "archives", "directory to download into, as owner/name.(tar.gz|zip)")
+	format := fs.String("format", "tar.gz", "archive format, tar.gz or zip")
+	baseURL := fs.String("base-url", "https://codeload.github.com", "base URL to download archives from")
+	jobs := fs.Int("jobs", 4, "number of downloads to run in parallel")
+	interval := fs.Duration("interval", 0, "minimum time between starting downloads (0 for no limit)")
+	retries := fs.Int("retries", 3, "number of times to retry a failed download")
+	budget := fs.Int64("budget", 0, "stop starting downloads once this many bytes have been downloaded (0 for no limit)")
+	nameRegex := fs.String("name-regex", "", "only download repositories whose owner/name matches this regexp")
+	excludeNameRegex := fs.String("exclude-name-regex", "", "skip repositories whose owner/name matches this regexp")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s download-archives [flags] (file.csv|-)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *jobs < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch *format {
+	default:
+		log.Fatalf("Unsupported format: %q", *format)
+	case "tar.gz", "zip":
+	}
+	filters, err := nameFilters(*nameRegex, *excludeNameRegex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos, err := readRepositories(fs.Arg(0), filters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Checksums of every download are appended in sha256sum format
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	sums, err := os.OpenFile(filepath.Join(*dir, "SHA256SUMS"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sums.Close()
+	var sumsMu sync.Mutex
+
+	// Finished downloads are skipped so an interrupted run can be resumed
+	target := func(repo ghsearch.Repository) string {
+		return filepath.Join(*dir, repo.NameWithOwner+"."+*format)
+	}
+	pending := skipExisting(repos, target)
+
+	// Stop starting downloads once the budget is spent, letting those in progress finish
+	stop, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var downloaded, total, failed atomic.Int64
+	forEachParallel(stop, pending, *jobs, *interval, func(repo ghsearch.Repository) {
+		url := ArchiveURL(*baseURL, *format, repo.NameWithOwner)
+		var n int64
+		var sum string
+		var err error
+		for attempt := 0; attempt <= *retries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<(attempt-1)) * time.Second):
+				}
+			}
+			if n, sum, err = DownloadArchive(ctx, http.DefaultClient, url, target(repo)); err == nil || errors.Is(err, errPermanent) || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to download %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		downloaded.Add(1)
+		sumsMu.Lock()
+		fmt.Fprintf(sums, "%s  %s\n", sum, repo.NameWithOwner+"."+*format)
+		sumsMu.Unlock()
+		if *budget > 0 && total.Add(n) >= *budget {
+			cancel()
+		}
+	})
+	if *budget > 0 && total.Load() >= *budget {
+		log.Printf("Stopped after reaching the budget of %d bytes", *budget)
+	}
+	log.Printf("Downloaded %d (%d bytes), skipped %d, failed %d repositories", downloaded.Load(), total.Load(), len(repos)-len(pending), failed.Load())
+}
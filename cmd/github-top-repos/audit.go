@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a single line of the NDJSON audit log.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Query     string    `json:"query"`
+	Cursor    *string   `json:"cursor"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Cost      int       `json:"cost"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// AuditTransport is a http.RoundTripper that records every GraphQL request to an audit log.
+type AuditTransport struct {
+	Base http.RoundTripper
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewAuditTransport writes an AuditRecord to w for every request made via base.
+func NewAuditTransport(base http.RoundTripper, w io.Writer) *AuditTransport {
+	return &AuditTransport{Base: base, enc: json.NewEncoder(w)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *AuditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	rec := AuditRecord{Time: start.UTC()}
+
+	// Extract the search variables from the GraphQL request body
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			var in struct {
+				Variables struct {
+					Query  string  `json:"query"`
+					Cursor *string `json:"cursor"`
+				} `json:"variables"`
+			}
+			if err := json.NewDecoder(body).Decode(&in); err == nil {
+				rec.Query, rec.Cursor = in.Variables.Query, in.Variables.Cursor
+			}
+			body.Close()
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Status = resp.StatusCode
+		// Buffer the response so the query cost can be extracted
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			rec.Error = err.Error()
+			resp = nil
+		} else {
+			var out struct {
+				Data struct {
+					RateLimit struct {
+						Cost int `json:"cost"`
+					} `json:"rateLimit"`
+				} `json:"data"`
+			}
+			if json.Unmarshal(body, &out) == nil {
+				rec.Cost = out.Data.RateLimit.Cost
+			}
+		}
+	}
+	rec.LatencyMS = time.Since(start).Milliseconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if encErr := t.enc.Encode(rec); encErr != nil && err == nil {
+		return nil, encErr
+	}
+	return resp, err
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// benchRows is how many synthetic repositories the fake search server holds.
+const benchRows = 10000
+
+// fakeSearchServer serves a search of total synthetic repositories in pages of the requested size,
+// with every optional field, so the client and sinks can be measured without the GitHub API.
+func fakeSearchServer(total int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				First  int     `json:"first"`
+				Cursor *string `json:"cursor"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		offset := 0
+		if req.Variables.Cursor != nil {
+			offset, _ = strconv.Atoi(*req.Variables.Cursor)
+		}
+		end := min(offset+req.Variables.First, total)
+		nodes := make([]map[string]any, 0, end-offset)
+		for i := offset; i < end; i++ {
+			nodes = append(nodes, map[string]any{
+				"databaseId":      i + 1,
+				"nameWithOwner":   fmt.Sprintf("owner%d/repo%d", i%1000, i),
+				"stargazerCount":  total - i,
+				"forkCount":       (total - i) / 10,
+				"diskUsage":       i * 7,
+				"description":     "A synthetic repository, with a description long enough to be \"typical\" of one",
+				"createdAt":       ghsearch.GitHubLaunch.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+				"isFork":          i%5 == 0,
+				"isMirror":        false,
+				"isTemplate":      false,
+				"isArchived":      i%7 == 0,
+				"isDisabled":      false,
+				"primaryLanguage": map[string]any{"name": "Go"},
+				"licenseInfo":     map[string]any{"spdxId": "MIT"},
+				"languages": map[string]any{"edges": []map[string]any{
+					{"size": 12345, "node": map[string]any{"name": "Go"}},
+					{"size": 678, "node": map[string]any{"name": "Shell"}},
+				}},
+				"repositoryTopics": map[string]any{"nodes": []map[string]any{
+					{"topic": map[string]any{"name": "cli"}},
+					{"topic": map[string]any{"name": "github"}},
+				}},
+				"owner": map[string]any{"__typename": "Organization", "databaseId": i%1000 + 1, "isVerified": i%2 == 0},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"rateLimit": map[string]any{"cost": 1},
+			"search": map[string]any{
+				"repositoryCount": total,
+				"nodes":           nodes,
+				"pageInfo":        map[string]any{"endCursor": strconv.Itoa(end), "hasNextPage": end < total},
+			},
+		}})
+	}))
+}
+
+// fakePages returns the Pages of a search of the fake server fetching every optional field.
+func fakePages(server *httptest.Server) *ghsearch.Pages {
+	pages := ghsearch.NewPages(NewClient(context.Background(), http.DefaultTransport, server.URL, ""), "bench")
+	pages.Languages, pages.Topics, pages.Flags, pages.Owner = 10, true, true, true
+	return pages
+}
+
+// fetchedRows are the rows of the fake server, fetched once by every benchmark writing them.
+var fetchedRows = sync.OnceValues(func() ([]ghsearch.Row, error) {
+	server := fakeSearchServer(benchRows)
+	defer server.Close()
+	pages := fakePages(server)
+	var rows []ghsearch.Row
+	for {
+		repos, err := pages.Next(context.Background(), 100)
+		if err != nil {
+			return nil, err
+		} else if repos == nil {
+			return rows, nil
+		}
+		for _, repo := range repos {
+			rows = append(rows, ghsearch.Row{Repository: repo})
+		}
+	}
+})
+
+// countingWriter discards what is written, counting the bytes.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// BenchmarkFetch measures decoding pages of 100 repositories from the fake server, each op a page.
+func BenchmarkFetch(b *testing.B) {
+	server := fakeSearchServer(benchRows)
+	defer server.Close()
+	var pages *ghsearch.Pages
+	var rows int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pages == nil {
+			pages = fakePages(server)
+		}
+		repos, err := pages.Next(context.Background(), 100)
+		if err != nil {
+			b.Fatal(err)
+		} else if repos == nil {
+			// Start over at the end of the search
+			pages = nil
+			i--
+			continue
+		}
+		rows += len(repos)
+	}
+	b.ReportMetric(float64(rows)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// BenchmarkOutput measures writing the rows of the fake server to each output format, each op a row.
+func BenchmarkOutput(b *testing.B) {
+	rows, err := fetchedRows()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, sink := range []struct {
+		name, format, compression string
+	}{
+		{"csv", "csv", ""},
+		{"ndjson", "ndjson", ""},
+		{"parquet", "parquet", ""},
+		{"sqlite", "sqlite", ""},
+		{"csv+gzip", "csv", "gzip"},
+		{"csv+zstd", "csv", "zstd"},
+	} {
+		b.Run(sink.name, func(b *testing.B) {
+			w := &countingWriter{}
+			var out io.Writer = w
+			var compressor Compressor
+			if sink.compression != "" {
+				var err error
+				if compressor, err = NewCompressor(w, sink.compression); err != nil {
+					b.Fatal(err)
+				}
+				out = compressor
+			}
+			fields := OutputFields{SuspectedBot: true, Languages: true, License: true, Topics: true, Flags: true, Owner: true}
+			output := NewOutput(out, sink.format, "stars", fields, false)
+			output.Compressor = compressor
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := output.Write(rows[i%len(rows)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := output.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+			b.ReportMetric(float64(w.n)/float64(b.N), "B/row")
+		})
+	}
+}
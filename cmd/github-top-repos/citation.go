@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// doiPattern matches a DOI, https://www.crossref.org/blog/dois-and-matching-regular-expressions/
+var doiPattern = regexp.MustCompile(`\b10\.\d{4,9}/[-._;()/:A-Za-z0-9]+[A-Za-z0-9]`)
+
+// Citation describes how a repository asks to be cited.
+type Citation struct {
+	// HasCFF is set if the repository has a CITATION.cff file.
+	HasCFF bool
+	// DOIs are the unique DOIs found in the CITATION.cff and README.md files.
+	DOIs []string
+}
+
+// FetchCitation looks for a CITATION.cff file and DOIs at the default branch of a repository.
+func FetchCitation(ctx context.Context, client *githubv4.Client, nameWithOwner string) (Citation, error) {
+	owner, name, _ := strings.Cut(nameWithOwner, "/")
+	// https://citation-file-format.github.io/
+	var q struct {
+		Repository struct {
+			CFF    readmeBlob `graphql:"cff: object(expression: \"HEAD:CITATION.cff\")"`
+			Readme readmeBlob `graphql:"readme: object(expression: \"HEAD:README.md\")"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	if err := client.Query(ctx, &q, map[string]any{
+		"owner": githubv4.String(owner),
+		"name":  githubv4.String(name),
+	}); err != nil {
+		return Citation{}, err
+	}
+	citation := Citation{HasCFF: q.Repository.CFF.Blob.Text != ""}
+	seen := make(map[string]bool)
+	for _, text := range []string{q.Repository.CFF.Blob.Text, q.Repository.Readme.Blob.Text} {
+		for _, doi := range doiPattern.FindAllString(text, -1) {
+			// DOIs are case-insensitive
+			if key := strings.ToLower(doi); !seen[key] {
+				seen[key] = true
+				citation.DOIs = append(citation.DOIs, doi)
+			}
+		}
+	}
+	return citation, nil
+}
+
+// citationsMain implements the citations subcommand.
+func citationsMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("citations", 4, 100*time.Millisecond)
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql"))
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name_with_owner", "has_citation_cff", "dois"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		citation, err := FetchCitation(ctx, client, repo.NameWithOwner)
+		if err != nil {
+			log.Printf("Failed to fetch citation of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]string{repo.NameWithOwner, FormatBool(citation.HasCFF), strings.Join(citation.DOIs, ";")})
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to fetch citations of %d repositories", n)
+	}
+}
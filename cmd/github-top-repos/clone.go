@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// BareClone performs a bare clone of url into target, optionally limited to depth commits.
+// The clone is made in a temporary directory and renamed once complete, so target only exists for finished clones.
+func BareClone(ctx context.Context, url, target string, depth int) error {
+	tmp := target + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	args := []string{"clone", "--bare", "--quiet"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	cmd := exec.CommandContext(ctx, "git", append(args, url, tmp)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// cloneMain implements the clone subcommand.
+func cloneMain(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	dir := fs.String("dir", "repos", "directory to clone into, as owner/name.git")
+	depth := fs.Int("depth", 1, "number of commits to clone (0 for full history)")
+	jobs := fs.Int("jobs", 4, "number of clones to run in parallel")
+	interval := fs.Duration("interval", time.Second, "minimum time between starting clones (0 for no limit)")
+	protocol := fs.String("protocol", "https", "clone protocol, ssh or https")
+	host := fs.String("host", "github.com", "git host to clone from")
+	nameRegex := fs.String("name-regex", "", "only clone repositories whose owner/name matches this regexp")
+	excludeNameRegex := fs.String("exclude-name-regex", "", "skip repositories whose owner/name matches this regexp")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s clone [flags] (file.csv|-)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *jobs < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch *protocol {
+	default:
+		log.Fatalf("Unsupported protocol: %q", *protocol)
+	case "ssh", "https":
+	}
+	filters, err := nameFilters(*nameRegex, *excludeNameRegex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos, err := readRepositories(fs.Arg(0), filters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Finished clones are skipped so an interrupted run can be resumed
+	target := func(repo ghsearch.Repository) string {
+		return filepath.Join(*dir, repo.NameWithOwner+".git")
+	}
+	pending := skipExisting(repos, target)
+	var cloned, failed atomic.Int64
+	forEachParallel(ctx, pending, *jobs, *interval, func(repo ghsearch.Repository) {
+		if err := BareClone(ctx, CloneURL(*host, *protocol, repo.NameWithOwner), target(repo), *depth); err != nil {
+			log.Printf("Failed to clone %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+		} else {
+			cloned.Add(1)
+		}
+	})
+	log.Printf("Cloned %d, skipped %d, failed %d repositories", cloned.Load(), len(repos)-len(pending), failed.Load())
+}
+
+// skipExisting returns the repositories whose target path does not exist yet.
+func skipExisting(repos []ghsearch.Repository, target func(ghsearch.Repository) string) []ghsearch.Repository {
+	var pending []ghsearch.Repository
+	for _, repo := range repos {
+		if _, err := os.Stat(target(repo)); err != nil {
+			pending = append(pending, repo)
+		}
+	}
+	return pending
+}
+
+// forEachParallel calls fn for each repository (or batch of them) using up to jobs goroutines, starting at most one
+// call per interval, until every one has been started or ctx is cancelled. It returns once all calls are complete.
+func forEachParallel[T any](ctx context.Context, repos []T, jobs int, interval time.Duration, fn func(T)) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sem := make(chan struct{}, jobs)
+	for _, repo := range repos {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(repo T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(repo)
+		}(repo)
+	}
+}
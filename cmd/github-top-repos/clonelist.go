@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// CloneURL returns the git URL of a repository on host using protocol ssh or https.
+func CloneURL(host, protocol, nameWithOwner string) string {
+	if protocol == "ssh" {
+		return fmt.Sprintf("git@%s:%s.git", host, nameWithOwner)
+	}
+	return fmt.Sprintf("https://%s/%s.git", host, nameWithOwner)
+}
+
+// nameFilters compiles the -name-regex and -exclude-name-regex flags of a subcommand.
+func nameFilters(nameRegex, excludeNameRegex string) ([]ghsearch.Filter, error) {
+	var filters []ghsearch.Filter
+	if nameRegex != "" {
+		re, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -name-regex: %w", err)
+		}
+		filters = append(filters, MatchName(re))
+	}
+	if excludeNameRegex != "" {
+		re, err := regexp.Compile(excludeNameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude-name-regex: %w", err)
+		}
+		filters = append(filters, ExcludeName(re))
+	}
+	return filters, nil
+}
+
+// csvNameWithOwner returns the owner/name of a record of CSV output with the header row, or false if the row is not
+// a header naming the name_with_owner, or owner and name, columns. No owner/name is without a slash, so a header is
+// recognized by its column names.
+func csvNameWithOwner(header []string) (func(record []string) string, bool) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+	owner, hasOwner := index["owner"]
+	name, hasName := index["name"]
+	if i, ok := index["name_with_owner"]; ok {
+		return func(record []string) string { return record[i] }, true
+	} else if hasOwner && hasName {
+		return func(record []string) string { return record[owner] + "/" + record[name] }, true
+	}
+	return nil, false
+}
+
+// RepositoryRef identifies a repository of an input by its owner/name or, for the output of other tools that have
+// none, by its database ID or node ID, which the enrichment subcommands resolve to its owner/name.
+type RepositoryRef struct {
+	NameWithOwner string
+	DatabaseId    int
+	NodeID        string
+}
+
+// csvRepositoryRef returns the repository of a record of CSV output with the header row, or false if the row is not a
+// header naming the columns of csvNameWithOwner or a database_id, databaseId, node_id or id column. The first column of
+// a header has no slash, unlike the owner/name that is the first column without one.
+func csvRepositoryRef(header []string) (func(record []string) (RepositoryRef, error), bool) {
+	if len(header) == 0 || strings.Contains(header[0], "/") {
+		return nil, false
+	}
+	nameWithOwner, hasName := csvNameWithOwner(header)
+	databaseID, nodeID := -1, -1
+	for i, name := range header {
+		switch name {
+		case "database_id", "databaseId":
+			databaseID = i
+		case "node_id", "nodeId", "id":
+			nodeID = i
+		}
+	}
+	if !hasName && databaseID < 0 && nodeID < 0 {
+		return nil, false
+	}
+	return func(record []string) (RepositoryRef, error) {
+		var ref RepositoryRef
+		if hasName {
+			ref.NameWithOwner = nameWithOwner(record)
+		}
+		if databaseID >= 0 && databaseID < len(record) && record[databaseID] != "" {
+			id, err := strconv.Atoi(record[databaseID])
+			if err != nil {
+				return ref, fmt.Errorf("invalid %s %q", header[databaseID], record[databaseID])
+			}
+			ref.DatabaseId = id
+		}
+		if nodeID >= 0 && nodeID < len(record) {
+			ref.NodeID = record[nodeID]
+		}
+		if ref == (RepositoryRef{}) {
+			return ref, errors.New("no owner/name or ID")
+		}
+		return ref, nil
+	}, true
+}
+
+// readRepositoryRefs reads the repositories of the CSV or NDJSON output of a crawl or another tool at path, or stdin
+// for "-". Each is identified by the first CSV column, unless a -header row names the columns of csvRepositoryRef,
+// or by the fields of each JSON object found by jsonRepositoryRef.
+func readRepositoryRefs(path string) ([]RepositoryRef, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	// No owner/name starts with a brace, so a JSON object is recognized by its first byte
+	br := bufio.NewReader(in)
+	if b, err := br.Peek(1); err == nil && b[0] == '{' {
+		return readJSONRepositoryRefs(br)
+	}
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	var refs []RepositoryRef
+	repositoryRef := func(record []string) (RepositoryRef, error) {
+		return RepositoryRef{NameWithOwner: record[0]}, nil
+	}
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			return refs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// Tolerate output written with -bom
+		record[0] = strings.TrimPrefix(record[0], "\uFEFF")
+		if first {
+			if fn, ok := csvRepositoryRef(record); ok {
+				repositoryRef = fn
+				continue
+			}
+		}
+		ref, err := repositoryRef(record)
+		if err != nil {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// jsonRepositoryRef returns the repository identified by an object of NDJSON, by its fields named as in the output
+// of a crawl, the GraphQL API or the REST API: name_with_owner, nameWithOwner or full_name for the owner/name,
+// database_id or databaseId for the database ID and node_id or nodeId for the node ID. An id is the database ID
+// if it is a number, as in the REST API, or the node ID if it is a string, as in the GraphQL API.
+func jsonRepositoryRef(obj map[string]json.RawMessage) (RepositoryRef, error) {
+	var ref RepositoryRef
+	fields := []struct {
+		names []string
+		v     any
+	}{
+		{[]string{"name_with_owner", "nameWithOwner", "full_name"}, &ref.NameWithOwner},
+		{[]string{"database_id", "databaseId"}, &ref.DatabaseId},
+		{[]string{"node_id", "nodeId"}, &ref.NodeID},
+	}
+	for _, field := range fields {
+		for _, name := range field.names {
+			if raw, ok := obj[name]; ok {
+				if err := json.Unmarshal(raw, field.v); err != nil {
+					return ref, fmt.Errorf("invalid %s: %w", name, err)
+				}
+				break
+			}
+		}
+	}
+	if raw, ok := obj["id"]; ok {
+		var id any
+		if err := json.Unmarshal(raw, &id); err != nil {
+			return ref, fmt.Errorf("invalid id: %w", err)
+		}
+		switch id := id.(type) {
+		case float64:
+			if ref.DatabaseId == 0 {
+				ref.DatabaseId = int(id)
+			}
+		case string:
+			if ref.NodeID == "" {
+				ref.NodeID = id
+			}
+		}
+	}
+	if ref == (RepositoryRef{}) {
+		return ref, errors.New("no name_with_owner, database_id or node_id field")
+	}
+	return ref, nil
+}
+
+// readJSONRepositoryRefs reads the repositories of NDJSON output.
+func readJSONRepositoryRefs(in io.Reader) ([]RepositoryRef, error) {
+	dec := json.NewDecoder(in)
+	var refs []RepositoryRef
+	for n := 1; ; n++ {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err == io.EOF {
+			return refs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ref, err := jsonRepositoryRef(obj)
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", n, err)
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// filterRepositories returns the repositories passing every filter.
+func filterRepositories(repos []ghsearch.Repository, filters []ghsearch.Filter) []ghsearch.Repository {
+	passed := repos[:0]
+Repos:
+	for _, repo := range repos {
+		for _, filter := range filters {
+			if !filter(repo) {
+				continue Repos
+			}
+		}
+		passed = append(passed, repo)
+	}
+	return passed
+}
+
+// readRepositories reads the repositories passing filters from the CSV or NDJSON output at path as by
+// readRepositoryRefs, each of which must have an owner/name.
+func readRepositories(path string, filters []ghsearch.Filter) ([]ghsearch.Repository, error) {
+	refs, err := readRepositoryRefs(path)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]ghsearch.Repository, len(refs))
+	for i, ref := range refs {
+		if ref.NameWithOwner == "" {
+			return nil, fmt.Errorf("repository %d has only an ID, which is only resolved by the enrichment subcommands", i+1)
+		}
+		repos[i] = ghsearch.Repository{NameWithOwner: ref.NameWithOwner, DatabaseId: ref.DatabaseId}
+	}
+	return filterRepositories(repos, filters), nil
+}
+
+// cloneListMain implements the clone-list subcommand.
+func cloneListMain(args []string) {
+	fs := flag.NewFlagSet("clone-list", flag.ExitOnError)
+	protocol := fs.String("protocol", "https", "clone protocol, ssh or https")
+	host := fs.String("host", "github.com", "git host to clone from")
+	format := fs.String("format", "list", "output format, list (one URL per line for xargs) or script (parallel git clone)")
+	jobs := fs.Int("jobs", 4, "parallel clones in the script format")
+	nameRegex := fs.String("name-regex", "", "only list repositories whose owner/name matches this regexp")
+	excludeNameRegex := fs.String("exclude-name-regex", "", "skip repositories whose owner/name matches this regexp")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s clone-list [flags] (file.csv|-)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch *protocol {
+	default:
+		log.Fatalf("Unsupported protocol: %q", *protocol)
+	case "ssh", "https":
+	}
+	switch *format {
+	default:
+		log.Fatalf("Unsupported format: %q", *format)
+	case "list", "script":
+	}
+	filters, err := nameFilters(*nameRegex, *excludeNameRegex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos, err := readRepositories(fs.Arg(0), filters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if *format == "script" {
+		fmt.Fprintf(out, "#!/bin/sh\nset -e\nxargs -P %d -n 2 git clone <<'EOF'\n", *jobs)
+	}
+	for _, repo := range repos {
+		url := CloneURL(*host, *protocol, repo.NameWithOwner)
+		if *format == "script" {
+			// Clone into owner/name so repos with the same name don't collide
+			fmt.Fprintf(out, "%s %s\n", url, repo.NameWithOwner)
+		} else {
+			fmt.Fprintln(out, url)
+		}
+	}
+	if *format == "script" {
+		fmt.Fprintln(out, "EOF")
+	}
+}
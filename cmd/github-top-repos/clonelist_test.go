@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadRepositoryRefs(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		// want are the repositories read, or nil for an error
+		want []RepositoryRef
+	}{
+		{"csv", "a/x,1\nb/y,2\n", []RepositoryRef{{NameWithOwner: "a/x"}, {NameWithOwner: "b/y"}}},
+		{"csv with -bom", "\uFEFFa/x,1\n", []RepositoryRef{{NameWithOwner: "a/x"}}},
+		{"csv -header", "stars,name_with_owner,database_id\n1,a/x,10\n2,b/y,\n", []RepositoryRef{{NameWithOwner: "a/x", DatabaseId: 10}, {NameWithOwner: "b/y"}}},
+		{"csv owner and name", "owner,name\na,x\n", []RepositoryRef{{NameWithOwner: "a/x"}}},
+		{"csv database IDs", "database_id,stars\n10,1\n20,2\n", []RepositoryRef{{DatabaseId: 10}, {DatabaseId: 20}}},
+		{"csv node IDs", "id,stars\nR_kgDOA,1\n", []RepositoryRef{{NodeID: "R_kgDOA"}}},
+		{"csv invalid database ID", "database_id\nten\n", nil},
+		{"csv without an ID", "database_id,stars\n,1\n", nil},
+		{"ndjson of a crawl", `{"name_with_owner":"a/x","database_id":10,"stars":1}` + "\n" + `{"name_with_owner":"b/y"}` + "\n", []RepositoryRef{{NameWithOwner: "a/x", DatabaseId: 10}, {NameWithOwner: "b/y"}}},
+		{"ndjson of GraphQL", `{"id":"R_kgDOA","databaseId":10,"nameWithOwner":"a/x"}` + "\n" + `{"id":"R_kgDOB"}` + "\n", []RepositoryRef{{NameWithOwner: "a/x", DatabaseId: 10, NodeID: "R_kgDOA"}, {NodeID: "R_kgDOB"}}},
+		{"ndjson of REST", `{"id":10,"node_id":"R_kgDOA","full_name":"a/x"}` + "\n" + `{"id":20}` + "\n", []RepositoryRef{{NameWithOwner: "a/x", DatabaseId: 10, NodeID: "R_kgDOA"}, {DatabaseId: 20}}},
+		{"ndjson node ID", `{"node_id":"R_kgDOA"}` + "\n", []RepositoryRef{{NodeID: "R_kgDOA"}}},
+		{"ndjson without an ID", `{"stars":1}` + "\n", nil},
+		{"ndjson invalid database ID", `{"database_id":"10"}` + "\n", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "input")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			refs, err := readRepositoryRefs(path)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("readRepositoryRefs() = %+v, want an error", refs)
+				}
+			} else if err != nil {
+				t.Errorf("readRepositoryRefs(): %v", err)
+			} else if !reflect.DeepEqual(refs, tt.want) {
+				t.Errorf("readRepositoryRefs() = %+v, want %+v", refs, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRepositoriesWithoutNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(path, []byte(`{"name_with_owner":"a/x"}`+"\n"+`{"database_id":10}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Only the enrichment subcommands resolve IDs to names
+	if repos, err := readRepositories(path, nil); err == nil {
+		t.Errorf("readRepositories() = %+v, want an error", repos)
+	}
+}
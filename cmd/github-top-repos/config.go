@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// loadConfig reads the config file at ConfigPath once, only for the subcommands that use it, so a broken
+// file doesn't stop the rest, such as version or init rewriting it.
+var loadConfig = sync.OnceValues(func() (*Config, error) {
+	return LoadConfig(ConfigPath())
+})
+
+// mustLoadConfig returns the config file at ConfigPath, exiting if it can't be read.
+func mustLoadConfig() *Config {
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	return config
+}
+
+// Config is a file of key=value lines written by init. The token, field and query keys
+// are the token and positional arguments of a crawl, queries.<name> keys are saved queries
+// used as @name, and any other key is the default of a flag.
+type Config struct {
+	Path    string
+	Token   string
+	Field   string
+	Query   string
+	Queries map[string]string
+	Values  map[string]string
+}
+
+// ConfigPath is the config file named by GITHUB_TOP_REPOS_CONFIG, otherwise
+// github-top-repos/config in the user's config directory.
+func ConfigPath() string {
+	if path := os.Getenv("GITHUB_TOP_REPOS_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "github-top-repos", "config")
+}
+
+// NewConfig returns an empty config to be written to path.
+func NewConfig(path string) *Config {
+	return &Config{Path: path, Queries: make(map[string]string), Values: make(map[string]string)}
+}
+
+// LoadConfig reads the config file at path, returning an empty config if it does not exist.
+func LoadConfig(path string) (*Config, error) {
+	c := NewConfig(path)
+	if path == "" {
+		return c, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key=value, got %q", path, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "token":
+			c.Token = value
+		case "field":
+			c.Field = value
+		case "query":
+			c.Query = value
+		default:
+			if name, ok := strings.CutPrefix(key, "queries."); ok {
+				c.Queries[name] = value
+				continue
+			}
+			c.Values[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ResolveQuery replaces a query of the form @name with the saved query of that name.
+func (c *Config) ResolveQuery(query string) (string, error) {
+	name, ok := strings.CutPrefix(query, "@")
+	if !ok {
+		return query, nil
+	}
+	saved, ok := c.Queries[name]
+	if !ok {
+		return "", fmt.Errorf("no saved query %q, add queries.%s=... to %s", name, name, c.Path)
+	}
+	return saved, nil
+}
+
+// Apply sets each flag in fs named in the config, before parsing so the command line takes precedence.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	for key, value := range c.Values {
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown flag %q", c.Path, key)
+		}
+		if err := fs.Set(key, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", c.Path, key, err)
+		}
+	}
+	return nil
+}
+
+// Save writes the config file, only readable by the user as it may contain the token.
+func (c *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# Written by github-top-repos init, flags given on the command line take precedence\n")
+	for _, kv := range [][2]string{{"token", c.Token}, {"field", c.Field}, {"query", c.Query}} {
+		if kv[1] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", kv[0], kv[1])
+		}
+	}
+	for _, key := range sortedKeys(c.Queries) {
+		fmt.Fprintf(&b, "queries.%s=%s\n", key, c.Queries[key])
+	}
+	for _, key := range sortedKeys(c.Values) {
+		fmt.Fprintf(&b, "%s=%s\n", key, c.Values[key])
+	}
+	return os.WriteFile(c.Path, []byte(b.String()), 0600)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// CountContributors returns the number of contributors to a repository, including anonymous ones, which GitHub
+// doesn't list for a repository whose history is too large, answering 403 instead.
+func CountContributors(ctx context.Context, client *http.Client, restURL, nameWithOwner string) (int, error) {
+	// https://docs.github.com/en/rest/repos/repos#list-repository-contributors
+	var page []json.RawMessage
+	n, err := restLastPage(ctx, client, restURL+"/repos/"+nameWithOwner+"/contributors?per_page=1&anon=true", &page)
+	var restErr *RESTError
+	if errors.As(err, &restErr) && restErr.StatusCode == http.StatusNoContent {
+		// An empty repository has no contributors
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	} else if len(page) == 0 {
+		return 0, nil
+	}
+	return n, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sync"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// CrawlEnricher runs enrich stages over the repositories of a crawl as they are found, writing the row of each to
+// the enrich output once its stages are done, in the order they finish. Repositories are queued without limit, so
+// the crawl is never held up waiting for enrichment, which its Scheduler holds back for the searches instead.
+type CrawlEnricher struct {
+	ctx            context.Context
+	names          []string
+	stages         []Enricher
+	maxValueLength int
+
+	mu     sync.Mutex
+	queued sync.Cond
+	queue  []ghsearch.Repository
+	closed bool
+
+	wmu sync.Mutex
+	w   *csv.Writer
+	wg  sync.WaitGroup
+}
+
+// NewCrawlEnricher returns a CrawlEnricher running the named stages for jobs repositories at a time, writing the CSV
+// enrich output to w, with a header row if header is set, until ctx is done.
+func NewCrawlEnricher(ctx context.Context, w io.Writer, names []string, stages []Enricher, jobs int, header bool, maxValueLength int) *CrawlEnricher {
+	e := &CrawlEnricher{ctx: ctx, names: names, stages: stages, maxValueLength: maxValueLength, w: csv.NewWriter(w)}
+	e.queued.L = &e.mu
+	if header {
+		e.w.Write(enrichHeader(stages))
+	}
+	// Wake the workers to stop once the crawl is canceled
+	stop := context.AfterFunc(ctx, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.queued.Broadcast()
+	})
+	e.wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer e.wg.Done()
+			for {
+				repo, ok := e.next()
+				if !ok {
+					return
+				}
+				record := enrichRepository(ctx, names, stages, repo, maxValueLength)
+				e.wmu.Lock()
+				e.w.Write(record)
+				e.w.Flush()
+				e.wmu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		e.wg.Wait()
+		stop()
+	}()
+	return e
+}
+
+// next returns the next repository to enrich, or false once the queue is closed and empty or ctx is done.
+func (e *CrawlEnricher) next() (ghsearch.Repository, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.queue) == 0 && !e.closed && e.ctx.Err() == nil {
+		e.queued.Wait()
+	}
+	if len(e.queue) == 0 || e.ctx.Err() != nil {
+		return ghsearch.Repository{}, false
+	}
+	repo := e.queue[0]
+	e.queue = e.queue[1:]
+	return repo, true
+}
+
+// Add queues repo to be enriched.
+func (e *CrawlEnricher) Add(repo ghsearch.Repository) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queue = append(e.queue, ghsearch.Repository{NameWithOwner: repo.NameWithOwner, DatabaseId: repo.DatabaseId})
+	e.queued.Signal()
+}
+
+// Close waits for every queued repository to be enriched, unless ctx is done first, returning the number left
+// and the first error writing the output.
+func (e *CrawlEnricher) Close() (int, error) {
+	e.mu.Lock()
+	e.closed = true
+	e.queued.Broadcast()
+	e.mu.Unlock()
+	e.wg.Wait()
+	e.w.Flush()
+	return len(e.queue), e.w.Error()
+}
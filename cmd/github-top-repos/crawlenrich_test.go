@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// fakeEnricher is a stage adding the length of the owner/name of a repository, failing for those in errs.
+type fakeEnricher struct {
+	errs map[string]error
+}
+
+func (fakeEnricher) Columns() []string { return []string{"length"} }
+
+func (e fakeEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	if err := e.errs[repo.NameWithOwner]; err != nil {
+		return nil, err
+	}
+	return []string{FormatInt(len(repo.NameWithOwner))}, nil
+}
+
+func TestCrawlEnricher(t *testing.T) {
+	var buf bytes.Buffer
+	stages := []Enricher{fakeEnricher{map[string]error{
+		"a/gone":   errors.New("Could not resolve to a Repository with the name 'a/gone'."),
+		"a/failed": errors.New("timeout"),
+	}}}
+	e := NewCrawlEnricher(context.Background(), &buf, []string{"fake"}, stages, 3, true, 0)
+	for _, name := range []string{"a/x", "a/gone", "a/failed", "bb/y"} {
+		e.Add(ghsearch.Repository{NameWithOwner: name})
+	}
+	if left, err := e.Close(); left != 0 || err != nil {
+		t.Fatalf("Close() = %d, %v", left, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want := "name_with_owner,length,deleted,deleted_at"; lines[0] != want {
+		t.Errorf("header %q, want %q", lines[0], want)
+	}
+	// Rows are in the order they finish
+	rows := lines[1:]
+	sort.Strings(rows)
+	want := []string{"a/failed,,false,", "a/gone,,true,", "a/x,3,false,", "bb/y,4,false,"}
+	if len(rows) != len(want) {
+		t.Fatalf("rows %q, want %q", rows, want)
+	}
+	for i, row := range rows {
+		// The time a repository was found deleted varies, so only its presence is compared
+		if at, ok := strings.CutPrefix(row, "a/gone,,true,"); ok && at != "" {
+			row = "a/gone,,true,"
+		}
+		if row != want[i] {
+			t.Errorf("row %q, want %q", rows[i], want[i])
+		}
+	}
+}
+
+func TestCrawlEnricherCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	e := NewCrawlEnricher(ctx, &buf, []string{"fake"}, []Enricher{fakeEnricher{}}, 1, false, 0)
+	cancel()
+	for _, name := range []string{"a/x", "a/y"} {
+		e.Add(ghsearch.Repository{NameWithOwner: name})
+	}
+	if left, err := e.Close(); left != 2 || err != nil {
+		t.Errorf("Close() after the crawl was canceled = %d, %v, want both left", left, err)
+	}
+}
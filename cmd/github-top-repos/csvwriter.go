@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CSVWriter writes CSV rows quoted the same as encoding/csv, but appends each row to one buffer reused between
+// rows and writes it with a single call, so a row encoded with CSVColumns doesn't allocate.
+type CSVWriter struct {
+	// UseCRLF terminates rows with \r\n, as csv.Writer.UseCRLF.
+	UseCRLF bool
+
+	w    io.Writer
+	line []byte
+	n    int
+}
+
+// NewCSVWriter returns a CSVWriter to w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: w}
+}
+
+// Field appends a field to the current row, which is copied so value may be reused.
+func (cw *CSVWriter) Field(value []byte) {
+	if cw.n > 0 {
+		cw.line = append(cw.line, ',')
+	}
+	cw.n++
+	if !csvNeedsQuotes(value) {
+		cw.line = append(cw.line, value...)
+		return
+	}
+	cw.line = append(cw.line, '"')
+	for len(value) > 0 {
+		i := bytes.IndexAny(value, "\"\r\n")
+		if i < 0 {
+			i = len(value)
+		}
+		cw.line = append(cw.line, value[:i]...)
+		value = value[i:]
+		if len(value) == 0 {
+			break
+		}
+		switch value[0] {
+		case '"':
+			cw.line = append(cw.line, '"', '"')
+		case '\r':
+			if !cw.UseCRLF {
+				cw.line = append(cw.line, '\r')
+			}
+		case '\n':
+			if cw.UseCRLF {
+				cw.line = append(cw.line, '\r', '\n')
+			} else {
+				cw.line = append(cw.line, '\n')
+			}
+		}
+		value = value[1:]
+	}
+	cw.line = append(cw.line, '"')
+}
+
+// EndRow terminates the current row and writes it.
+func (cw *CSVWriter) EndRow() error {
+	if cw.UseCRLF {
+		cw.line = append(cw.line, '\r', '\n')
+	} else {
+		cw.line = append(cw.line, '\n')
+	}
+	_, err := cw.w.Write(cw.line)
+	cw.line, cw.n = cw.line[:0], 0
+	return err
+}
+
+// Write writes record as a row, such as a header.
+func (cw *CSVWriter) Write(record []string) error {
+	for _, value := range record {
+		cw.Field([]byte(value))
+	}
+	return cw.EndRow()
+}
+
+// csvNeedsQuotes reports whether encoding/csv would quote value: if it contains a comma, quote or line break,
+// starts with a space, or is \. which PostgreSQL reads as the end of data.
+func csvNeedsQuotes(value []byte) bool {
+	if len(value) == 0 {
+		return false
+	} else if string(value) == `\.` {
+		return true
+	} else if bytes.ContainsAny(value, ",\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRune(value)
+	return unicode.IsSpace(r)
+}
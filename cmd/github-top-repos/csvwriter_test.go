@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// csvPieces are what the random fields are made of, weighted toward what needs quoting.
+var csvPieces = []string{"a", "bc", "é", ",", `"`, "\r", "\n", "\r\n", " ", "\t", " ", " ", `\`, ".", `\.`, "=", "\x00"}
+
+// randomCSVRecord returns a record of up to 5 fields of up to 6 pieces each.
+func randomCSVRecord(r *rand.Rand) []string {
+	record := make([]string, 1+r.Intn(5))
+	for i := range record {
+		var field strings.Builder
+		for n := r.Intn(7); n > 0; n-- {
+			field.WriteString(csvPieces[r.Intn(len(csvPieces))])
+		}
+		record[i] = field.String()
+	}
+	return record
+}
+
+func TestCSVWriterMatchesEncodingCSV(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, crlf := range []bool{false, true} {
+		for i := 0; i < 10000; i++ {
+			record := randomCSVRecord(r)
+			var want, got bytes.Buffer
+			cw := csv.NewWriter(&want)
+			cw.UseCRLF = crlf
+			if err := cw.Write(record); err != nil {
+				t.Fatal(err)
+			}
+			cw.Flush()
+			w := NewCSVWriter(&got)
+			w.UseCRLF = crlf
+			if err := w.Write(record); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("UseCRLF %t, record %q: got %q, encoding/csv wrote %q", crlf, record, got.Bytes(), want.Bytes())
+			}
+		}
+	}
+}
+
+func TestCSVWriterReusesValue(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	value := []byte("first")
+	w.Field(value)
+	copy(value, "other")
+	w.Field(value)
+	if err := w.EndRow(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "first,other\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSVOutputAllocs(t *testing.T) {
+	rows, err := fetchedRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every column, with a description that needs quoting
+	fields := OutputFields{SuspectedBot: true, Languages: true, License: true, Topics: true, Flags: true, Owner: true}
+	for _, safeCSV := range []bool{false, true} {
+		output := NewOutput(io.Discard, "csv", "stars", fields, false)
+		output.SafeCSV = safeCSV
+		i := 0
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := output.Write(rows[i%len(rows)]); err != nil {
+				t.Fatal(err)
+			}
+			i++
+		})
+		if allocs != 0 {
+			t.Errorf("SafeCSV %t: writing a CSV row allocated %.1f times, want 0", safeCSV, allocs)
+		}
+	}
+}
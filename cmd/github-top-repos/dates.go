@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// ParseDate parses an absolute date, 2006-01-02 or RFC 3339, or one relative to now in UTC:
+// now, today, yesterday, or an offset such as -12h from now or -30d, -2w, -3m (months)
+// or -1y from the start of today, so the same offset resolves the same all day.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	now = now.UTC()
+	today := now.Truncate(24 * time.Hour)
+	switch s {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if len(s) < 3 || s[0] != '-' {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected 2006-01-02, RFC 3339, now, today, yesterday or an offset such as -30d", s)
+	}
+	n, err := strconv.Atoi(s[1 : len(s)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("invalid date offset %q", s)
+	}
+	switch s[len(s)-1] {
+	case 'h':
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case 'd':
+		return today.AddDate(0, 0, -n), nil
+	case 'w':
+		return today.AddDate(0, 0, -7*n), nil
+	case 'm':
+		return addMonths(today, -n), nil
+	case 'y':
+		return addMonths(today, -12*n), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date offset %q, expected a unit of h, d, w, m or y", s)
+}
+
+// addMonths adds n months to the day t in UTC, keeping to the last day of a shorter month rather than
+// overflowing into the next as time.AddDate does, so a month before March 31 is the end of February.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+// ParseSpan parses a length of time as a Go duration, such as 12h, or a number of days or weeks, such as 2d or 1w.
+func ParseSpan(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") && n >= 0 {
+		return time.Duration(n) * 24 * time.Hour, nil
+	} else if n, err := strconv.Atoi(strings.TrimSuffix(s, "w")); err == nil && strings.HasSuffix(s, "w") && n >= 0 {
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid span %q, expected a duration such as 12h or a number of days or weeks such as 2d", s)
+	}
+	return d, nil
+}
+
+// LastMonth returns the start of the previous calendar month and of the current one in UTC.
+func LastMonth(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return end.AddDate(0, -1, 0), end
+}
+
+// InclusiveEnd returns the exclusive end of a range that includes end, the whole day if end is
+// midnight, as dates such as 2006-01-02 or yesterday are, otherwise the second of end.
+func InclusiveEnd(end time.Time) time.Time {
+	if end.Equal(end.Truncate(24 * time.Hour)) {
+		return end.AddDate(0, 0, 1)
+	}
+	return end.Truncate(time.Second).Add(time.Second)
+}
+
+// formatBound formats a bound of a created range, or unbounded if it is zero.
+func formatBound(t time.Time, unbounded string) string {
+	if t.IsZero() {
+		return unbounded
+	}
+	return t.Format(time.RFC3339)
+}
+
+// rangesFlag collects each -range flag.
+type rangesFlag []string
+
+func (f *rangesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *rangesFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// ParseRange parses a created range of start:end or start..end, with either date in the forms
+// of ParseDate. An empty start, or one before it, is GitHub's launch and an empty end is now
+// minus lag, and if inclusive the end is included as by InclusiveEnd.
+func ParseRange(s string, now time.Time, inclusive bool, lag time.Duration) (ghsearch.CreatedRange, error) {
+	start, end, ok := strings.Cut(s, "..")
+	if !ok {
+		// RFC 3339 times contain colons, so they need the .. form
+		if start, end, ok = strings.Cut(s, ":"); !ok {
+			return ghsearch.CreatedRange{}, fmt.Errorf("invalid range %q, expected start:end or start..end", s)
+		}
+	}
+	r := ghsearch.CreatedRange{After: ghsearch.GitHubLaunch, Before: now.Add(-lag).UTC().Truncate(time.Second)}
+	var err error
+	if start != "" {
+		if r.After, err = ParseDate(start, now); err != nil {
+			return r, err
+		}
+	}
+	if end != "" {
+		if r.Before, err = ParseDate(end, now); err != nil {
+			return r, err
+		}
+		if inclusive {
+			r.Before = InclusiveEnd(r.Before)
+		}
+	}
+	if !r.Before.After(ghsearch.GitHubLaunch) {
+		return r, fmt.Errorf("range %q ends before GitHub's launch on %s", s, ghsearch.GitHubLaunch.Format(time.DateOnly))
+	} else if r.After.Before(ghsearch.GitHubLaunch) {
+		r.After = ghsearch.GitHubLaunch
+	}
+	if !r.Before.After(r.After) {
+		return r, fmt.Errorf("range %q ends before it starts", s)
+	}
+	return r, nil
+}
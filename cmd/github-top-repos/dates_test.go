@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// date returns the time of an RFC 3339 string, or of 2006-01-02 at midnight UTC.
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	layout := time.RFC3339
+	if len(s) == len(time.DateOnly) {
+		layout = time.DateOnly
+	}
+	d, err := time.Parse(layout, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseDate(t *testing.T) {
+	now := date(t, "2024-03-31T15:04:05Z")
+	// The same instant, on the next day in Tokyo
+	tokyo := now.In(time.FixedZone("JST", 9*60*60))
+	for _, tt := range []struct {
+		s    string
+		now  time.Time
+		want string
+	}{
+		{"now", now, "2024-03-31T15:04:05Z"},
+		{"now", tokyo, "2024-03-31T15:04:05Z"},
+		{"today", now, "2024-03-31"},
+		// Relative dates are of the day in UTC, whatever the zone of now
+		{"today", tokyo, "2024-03-31"},
+		{"yesterday", tokyo, "2024-03-30"},
+		{"2024-02-29", now, "2024-02-29"},
+		{"2024-02-29T10:00:00Z", now, "2024-02-29T10:00:00Z"},
+		{"2024-02-29T01:00:00+02:00", now, "2024-02-28T23:00:00Z"},
+		{"-12h", now, "2024-03-31T03:04:05Z"},
+		{"-0d", now, "2024-03-31"},
+		{"-30d", now, "2024-03-01"},
+		{"-2w", now, "2024-03-17"},
+		// A month before the 31st is the end of a shorter month
+		{"-1m", now, "2024-02-29"},
+		{"-3m", now, "2023-12-31"},
+		{"-13m", now, "2023-02-28"},
+		{"-1y", now, "2023-03-31"},
+		{"-1y", date(t, "2024-02-29T12:00:00Z"), "2023-02-28"},
+	} {
+		got, err := ParseDate(tt.s, tt.now)
+		if err != nil {
+			t.Errorf("ParseDate(%q, %s): %v", tt.s, tt.now, err)
+		} else if want := date(t, tt.want); !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("ParseDate(%q, %s) = %s, want %s", tt.s, tt.now, got, want)
+		}
+	}
+	for _, s := range []string{"", "tomorrow", "2024-02-30", "2024-13-01", "2024-03-01 12:00", "5d", "-d", "--5d", "-1.5d", "-5s", "-5x"} {
+		if got, err := ParseDate(s, now); err == nil {
+			t.Errorf("ParseDate(%q) = %s, want an error", s, got)
+		}
+	}
+}
+
+func TestParseSpan(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"12h":   12 * time.Hour,
+		"1h30m": 90 * time.Minute,
+		// Unlike ParseDate, m is minutes as in a Go duration
+		"90m": 90 * time.Minute,
+		"0":   0,
+		"0d":  0,
+		"2d":  48 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+	} {
+		if got, err := ParseSpan(s); err != nil || got != want {
+			t.Errorf("ParseSpan(%q) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "d", "w", "-1d", "-1h", "1.5d", "2 days", "1y"} {
+		if got, err := ParseSpan(s); err == nil {
+			t.Errorf("ParseSpan(%q) = %s, want an error", s, got)
+		}
+	}
+}
+
+func TestInclusiveEnd(t *testing.T) {
+	for _, tt := range []struct {
+		end, want string
+	}{
+		// A date includes the whole day, including the last of a month or year
+		{"2024-01-01", "2024-01-02"},
+		{"2024-02-28", "2024-02-29"},
+		{"2024-02-29", "2024-03-01"},
+		{"2023-02-28", "2023-03-01"},
+		{"2024-12-31", "2025-01-01"},
+		// A time only includes its second
+		{"2024-02-29T12:30:45Z", "2024-02-29T12:30:46Z"},
+		{"2024-02-29T23:59:59Z", "2024-03-01T00:00:00Z"},
+		// Midnight elsewhere is not midnight in UTC
+		{"2024-03-01T00:00:00+09:00", "2024-02-29T15:00:01Z"},
+	} {
+		if got, want := InclusiveEnd(date(t, tt.end)), date(t, tt.want); !got.Equal(want) {
+			t.Errorf("InclusiveEnd(%s) = %s, want %s", tt.end, got, want)
+		}
+	}
+	fraction := date(t, "2024-02-29T12:30:45Z").Add(500 * time.Millisecond)
+	if got, want := InclusiveEnd(fraction), date(t, "2024-02-29T12:30:46Z"); !got.Equal(want) {
+		t.Errorf("InclusiveEnd(%s) = %s, want %s", fraction, got, want)
+	}
+}
+
+func TestLastMonth(t *testing.T) {
+	for _, tt := range []struct {
+		now, start, end string
+	}{
+		{"2024-03-31T15:04:05Z", "2024-02-01", "2024-03-01"},
+		{"2024-01-15T00:00:00Z", "2023-12-01", "2024-01-01"},
+		// Still March in UTC
+		{"2024-04-01T00:30:00+09:00", "2024-02-01", "2024-03-01"},
+	} {
+		start, end := LastMonth(date(t, tt.now))
+		if !start.Equal(date(t, tt.start)) || !end.Equal(date(t, tt.end)) {
+			t.Errorf("LastMonth(%s) = %s, %s, want %s, %s", tt.now, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	now := date(t, "2024-03-31T15:04:05.5Z")
+	launch := ghsearch.GitHubLaunch.Format(time.RFC3339)
+	for _, tt := range []struct {
+		s         string
+		inclusive bool
+		lag       time.Duration
+		// after and before are the range parsed, or empty for an error
+		after, before string
+	}{
+		{"2024-01-01:2024-01-31", false, 0, "2024-01-01", "2024-01-31"},
+		{"2024-01-01:2024-01-31", true, 0, "2024-01-01", "2024-02-01"},
+		{"2024-01-01..2024-01-31", true, 0, "2024-01-01", "2024-02-01"},
+		{"2024-02-01:2024-02-29", true, 0, "2024-02-01", "2024-03-01"},
+		{"2024-02-29:2024-02-29", true, 0, "2024-02-29", "2024-03-01"},
+		{"2024-02-29:2024-02-29", false, 0, "", ""},
+		// Open-ended ranges start at GitHub's launch and end now, less the lag
+		{":2024-01-01", false, 0, launch, "2024-01-01"},
+		{"..2024-01-01", true, 0, launch, "2024-01-02"},
+		{"2024-03-01:", true, 0, "2024-03-01", "2024-03-31T15:04:05Z"},
+		{"2024-03-01..", false, time.Hour, "2024-03-01", "2024-03-31T14:04:05Z"},
+		{":", false, 0, launch, "2024-03-31T15:04:05Z"},
+		// An open end isn't made inclusive, as it is already now
+		{"-1d:", true, 0, "2024-03-30", "2024-03-31T15:04:05Z"},
+		{"-1m:yesterday", true, 0, "2024-02-29", "2024-03-31"},
+		{"yesterday:today", false, 0, "2024-03-30", "2024-03-31"},
+		// RFC 3339 times, in any zone, need the .. form
+		{"2024-01-01T00:00:00Z..2024-01-01T12:00:00+02:00", true, 0, "2024-01-01", "2024-01-01T10:00:01Z"},
+		{"2024-01-01T00:00:00Z:2024-01-02T00:00:00Z", false, 0, "", ""},
+		// A start before GitHub's launch is its launch, but not an end
+		{"2000-01-01:2008-01-01", false, 0, launch, "2008-01-01"},
+		{"2000-01-01:2007-01-01", false, 0, "", ""},
+		{"2024-02-01:2024-01-01", true, 0, "", ""},
+		{"2024-01-01", false, 0, "", ""},
+		{"2024-01-01:tomorrow", false, 0, "", ""},
+		{"sometime:2024-01-01", false, 0, "", ""},
+	} {
+		r, err := ParseRange(tt.s, now, tt.inclusive, tt.lag)
+		if tt.after == "" {
+			if err == nil {
+				t.Errorf("ParseRange(%q, %t) = %+v, want an error", tt.s, tt.inclusive, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRange(%q, %t): %v", tt.s, tt.inclusive, err)
+		} else if after, before := date(t, tt.after), date(t, tt.before); !r.After.Equal(after) || !r.Before.Equal(before) {
+			t.Errorf("ParseRange(%q, %t) = %s..%s, want %s..%s", tt.s, tt.inclusive, r.After, r.Before, after, before)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// Days splits [after, before) into the UTC days it spans, the first and last clipped to the range.
+func Days(after, before time.Time) []ghsearch.CreatedRange {
+	var days []ghsearch.CreatedRange
+	for start := after.UTC(); start.Before(before); {
+		end := start.Truncate(24*time.Hour).AddDate(0, 0, 1)
+		if end.After(before) {
+			end = before.UTC()
+		}
+		days = append(days, ghsearch.CreatedRange{After: start, Before: end})
+		start = end
+	}
+	return days
+}
+
+// DayCrawl crawls each day of a created range with its own copy of a Crawler, several days at once, such as to
+// keep a pool of tokens busy. Each day is written to its own Daily file of Files and checkpointed to its own
+// file, so an interrupted crawl continues each unfinished day and skips those whose file was renamed into place.
+type DayCrawl struct {
+	// Crawler is copied for each day, with its Filters and Emit, which are called by one day at a time.
+	Crawler *ghsearch.Crawler
+	// Files are the Daily files the rows are written to through the Crawler's Emit.
+	Files *FileOutput
+	// Checkpoint, if set, is the path of the checkpoints, with the day inserted as by DayPath.
+	Checkpoint string
+	// Jobs is how many days are crawled at once.
+	Jobs int
+
+	// mu serializes the Filters, Emit and Files between the days
+	mu sync.Mutex
+}
+
+// Run crawls each of days, returning the first error after stopping the rest.
+func (d *DayCrawl) Run(ctx context.Context, days []ghsearch.CreatedRange) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	emit := d.Crawler.Emit
+	filters := make([]ghsearch.Filter, len(d.Crawler.Filters))
+	for i, filter := range d.Crawler.Filters {
+		filters[i] = func(repo ghsearch.Repository) bool {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return filter(repo)
+		}
+	}
+	var errMu sync.Mutex
+	var errs []error
+	forEachParallel(ctx, days, d.Jobs, 0, func(day ghsearch.CreatedRange) {
+		c := *d.Crawler
+		c.CreatedAfter, c.CreatedBefore, c.Ranges = day.After, day.Before, nil
+		c.Filters = filters
+		c.Emit = func(row ghsearch.Row) error {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return emit(row)
+		}
+		if err := d.crawl(ctx, &c); err != nil {
+			errMu.Lock()
+			errs = append(errs, err)
+			errMu.Unlock()
+			cancel()
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	// A day that never started was stopped too
+	return ctx.Err()
+}
+
+// crawl crawls the day of c, continuing from its checkpoint if any, and renames its file into place once done.
+func (d *DayCrawl) crawl(ctx context.Context, c *ghsearch.Crawler) error {
+	day := FormatDate(c.CreatedAfter)
+	path := DayPath(d.Files.Path, day)
+	if _, err := os.Stat(path); err == nil {
+		log.Printf("Skipping %s, already crawled to %s", day, path)
+		return nil
+	}
+	var checkpoint string
+	var cp *ghsearch.Checkpoint
+	if d.Checkpoint != "" {
+		checkpoint = DayPath(d.Checkpoint, day)
+		var err error
+		if cp, err = ghsearch.LoadCheckpoint(checkpoint); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	if cp == nil {
+		// Without a checkpoint the day starts over, rather than append to rows it may have already written
+		if err := os.Remove(path + ".partial"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			d.mu.Unlock()
+			return err
+		}
+	}
+	err := d.Files.OpenPath(path)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if cp != nil {
+		if err := c.Restore(cp); err != nil {
+			return err
+		}
+		log.Printf("Continuing %s from checkpoint at %s %d", day, c.Field, cp.LastValue)
+	}
+	if checkpoint != "" {
+		c.Completed = func() error {
+			d.mu.Lock()
+			err := d.Files.Commit()
+			d.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			return c.SaveCheckpoint(checkpoint)
+		}
+	}
+	if err := c.Run(ctx); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	err = d.Files.ClosePath(path, true)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote %s with %d repositories", path, c.Progress().Emitted)
+	if checkpoint != "" {
+		if err := ghsearch.RemoveCheckpoint(checkpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+func TestDays(t *testing.T) {
+	for _, tt := range []struct {
+		after, before string
+		// want are the days as after..before
+		want []string
+	}{
+		{"2024-02-28", "2024-03-01", []string{"2024-02-28..2024-02-29", "2024-02-29..2024-03-01"}},
+		// The first and last are clipped to the range
+		{"2024-02-28T12:00:00Z", "2024-03-01T06:00:00Z", []string{
+			"2024-02-28T12:00:00Z..2024-02-29",
+			"2024-02-29..2024-03-01",
+			"2024-03-01..2024-03-01T06:00:00Z",
+		}},
+		{"2024-02-28T12:00:00Z", "2024-02-28T13:00:00Z", []string{"2024-02-28T12:00:00Z..2024-02-28T13:00:00Z"}},
+		// Days are of UTC, whatever the zone of the range
+		{"2024-02-29T06:00:00+09:00", "2024-02-29T12:00:00+09:00", []string{"2024-02-28T21:00:00Z..2024-02-29", "2024-02-29..2024-02-29T03:00:00Z"}},
+		{"2024-02-28", "2024-02-28", nil},
+	} {
+		var got []string
+		for _, day := range Days(date(t, tt.after), date(t, tt.before)) {
+			got = append(got, day.After.Format(time.RFC3339)+".."+day.Before.Format(time.RFC3339))
+		}
+		var want []string
+		for _, day := range tt.want {
+			after, before, _ := strings.Cut(day, "..")
+			want = append(want, date(t, after).Format(time.RFC3339)+".."+date(t, before).Format(time.RFC3339))
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Days(%s, %s) = %q, want %q", tt.after, tt.before, got, want)
+		}
+	}
+}
+
+// createdQualifier matches the created range of a search.
+var createdQualifier = regexp.MustCompile(`created:(\S+)\.\.(\S+)`)
+
+// fakeCreatedServer serves searches of the repositories created at each of created, named after their index,
+// honoring only the created qualifier, recording the days searched.
+func fakeCreatedServer(t *testing.T, created []string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	searched := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				Query string `json:"query"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := createdQualifier.FindStringSubmatch(req.Variables.Query)
+		if m == nil {
+			t.Errorf("search %q has no created range", req.Variables.Query)
+			http.Error(w, "no created range", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		searched[m[1][:len(time.DateOnly)]] = true
+		mu.Unlock()
+		from, to := date(t, m[1]), date(t, m[2])
+		nodes := []map[string]any{}
+		for i, s := range created {
+			if at := date(t, s); !at.Before(from) && !at.After(to) {
+				nodes = append(nodes, map[string]any{
+					"databaseId":     i + 1,
+					"nameWithOwner":  fmt.Sprintf("owner/repo%d", i),
+					"stargazerCount": 10,
+					"createdAt":      s,
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"rateLimit": map[string]any{"cost": 1},
+			"search": map[string]any{
+				"repositoryCount": len(nodes),
+				"nodes":           nodes,
+				"pageInfo":        map[string]any{"endCursor": "", "hasNextPage": false},
+			},
+		}})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		days := make([]string, 0, len(searched))
+		for day := range searched {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		return days
+	}
+}
+
+func TestDayCrawl(t *testing.T) {
+	server, searched := fakeCreatedServer(t, []string{
+		"2024-03-01T01:00:00Z", "2024-03-01T23:59:59Z", "2024-03-02T12:00:00Z", "2024-03-04T00:00:00Z",
+	})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repos.csv")
+	// A day already crawled is skipped, and the partial file of an unfinished one without a checkpoint restarted
+	if err := os.WriteFile(DayPath(path, "2024-03-02"), []byte("done\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DayPath(path, "2024-03-03")+".partial", []byte("owner/stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := &FileOutput{Path: path, Daily: true, Append: true, New: func(f *AtomicFile) (*Output, error) {
+		return NewOutput(f, "csv", "stars", OutputFields{}, false), nil
+	}}
+	crawler := &ghsearch.Crawler{
+		Client:  NewClient(context.Background(), http.DefaultTransport, server.URL, "token"),
+		Field:   "stars",
+		SliceBy: ghsearch.SliceCreated,
+		Emit:    files.Write,
+	}
+	dc := &DayCrawl{Crawler: crawler, Files: files, Checkpoint: filepath.Join(dir, "cp.json"), Jobs: 2}
+	if err := dc.Run(context.Background(), Days(date(t, "2024-03-01"), date(t, "2024-03-04"))); err != nil {
+		t.Fatal(err)
+	}
+	for day, want := range map[string]string{
+		"2024-03-01": "owner/repo0,10\nowner/repo1,10\n",
+		"2024-03-02": "done\n",
+		"2024-03-03": "",
+	} {
+		b, err := os.ReadFile(DayPath(path, day))
+		if err != nil {
+			t.Errorf("day %s: %v", day, err)
+		} else if string(b) != want {
+			t.Errorf("day %s:\n%s\nwant:\n%s", day, b, want)
+		}
+	}
+	// Every day is renamed into place and its checkpoint removed
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.partial")); len(matches) != 0 {
+		t.Errorf("left partial files %q", matches)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "cp*")); len(matches) != 0 {
+		t.Errorf("left checkpoints %q", matches)
+	}
+	if got, want := strings.Join(searched(), " "), "2024-03-01 2024-03-03"; got != want {
+		t.Errorf("searched days %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// DepsDevPackage is a package published from a repository along with its dependents on deps.dev.
+type DepsDevPackage struct {
+	System             string
+	Name               string
+	DefaultVersion     string
+	Dependents         int
+	DirectDependents   int
+	IndirectDependents int
+}
+
+// errDepsDevNotFound is returned when deps.dev has no record of the requested resource.
+var errDepsDevNotFound = errors.New("not found on deps.dev")
+
+// DepsDevClient queries the deps.dev API, https://docs.deps.dev/api/
+type DepsDevClient struct {
+	Client  *http.Client
+	BaseURL string
+}
+
+// get decodes the JSON response of a deps.dev API path into v.
+func (c *DepsDevClient) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errDepsDevNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-200 OK status code: %v", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type depsDevVersionKey struct {
+	System  string `json:"system"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Packages returns the packages published from a GitHub repository with their dependent counts.
+func (c *DepsDevClient) Packages(ctx context.Context, nameWithOwner string) ([]DepsDevPackage, error) {
+	// Find the packages that declare the repository as their source
+	var project struct {
+		Versions []struct {
+			VersionKey depsDevVersionKey `json:"versionKey"`
+		} `json:"versions"`
+	}
+	projectID := url.PathEscape("github.com/" + nameWithOwner)
+	if err := c.get(ctx, "/v3alpha/projects/"+projectID+":packageversions", &project); errors.Is(err, errDepsDevNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	seen := make(map[depsDevVersionKey]bool)
+	var packages []DepsDevPackage
+	for _, version := range project.Versions {
+		key := depsDevVersionKey{System: version.VersionKey.System, Name: version.VersionKey.Name}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// Dependents are counted against the default version of the package
+		path := "/v3/systems/" + url.PathEscape(key.System) + "/packages/" + url.PathEscape(key.Name)
+		var pkg struct {
+			Versions []struct {
+				VersionKey depsDevVersionKey `json:"versionKey"`
+				IsDefault  bool              `json:"isDefault"`
+			} `json:"versions"`
+		}
+		if err := c.get(ctx, path, &pkg); err != nil {
+			return nil, err
+		}
+		result := DepsDevPackage{System: key.System, Name: key.Name}
+		for _, v := range pkg.Versions {
+			if v.IsDefault {
+				result.DefaultVersion = v.VersionKey.Version
+			}
+		}
+		if result.DefaultVersion != "" {
+			var dependents struct {
+				DependentCount         int `json:"dependentCount"`
+				DirectDependentCount   int `json:"directDependentCount"`
+				IndirectDependentCount int `json:"indirectDependentCount"`
+			}
+			path := "/v3alpha/systems/" + url.PathEscape(key.System) + "/packages/" + url.PathEscape(key.Name) + "/versions/" + url.PathEscape(result.DefaultVersion) + ":dependents"
+			if err := c.get(ctx, path, &dependents); err != nil {
+				return nil, err
+			}
+			result.Dependents = dependents.DependentCount
+			result.DirectDependents = dependents.DirectDependentCount
+			result.IndirectDependents = dependents.IndirectDependentCount
+		}
+		packages = append(packages, result)
+	}
+	return packages, nil
+}
+
+// depsDevMain implements the deps-dev subcommand.
+func depsDevMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("deps-dev", 4, 100*time.Millisecond)
+	baseURL := fs.String("deps-dev-url", "https://api.deps.dev", "base URL of the deps.dev API")
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	// deps.dev is unauthenticated, the GitHub token must not be sent to it
+	client := &DepsDevClient{Client: &http.Client{Transport: transports.Other}, BaseURL: *baseURL}
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name_with_owner", "system", "package", "default_version", "dependents", "direct_dependents", "indirect_dependents"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		packages, err := client.Packages(ctx, repo.NameWithOwner)
+		if err != nil {
+			log.Printf("Failed to query deps.dev for %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, pkg := range packages {
+			w.Write([]string{
+				repo.NameWithOwner, pkg.System, pkg.Name, pkg.DefaultVersion,
+				FormatInt(pkg.Dependents), FormatInt(pkg.DirectDependents), FormatInt(pkg.IndirectDependents),
+			})
+		}
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to query deps.dev for %d repositories", n)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorCheck prints the result of a check along with how to fix it, reporting whether it passed.
+func doctorCheck(name string, err error, fix string) bool {
+	if err != nil {
+		fmt.Printf("FAIL %s: %v\n     %s\n", name, err, fix)
+		return false
+	}
+	fmt.Printf("ok   %s\n", name)
+	return true
+}
+
+// rateLimits is the response of the REST rate_limit endpoint.
+// https://docs.github.com/en/rest/rate-limit/rate-limit#get-rate-limit-status-for-the-authenticated-user
+type rateLimits struct {
+	Resources map[string]struct {
+		Limit     int   `json:"limit"`
+		Remaining int   `json:"remaining"`
+		Reset     int64 `json:"reset"`
+	} `json:"resources"`
+}
+
+// doctorMain implements the doctor subcommand.
+func doctorMain(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	output := fs.String("output", "", "check that this output file can be written")
+	maxSkew := fs.Duration("max-skew", time.Minute, "largest tolerated difference between the local and GitHub clocks")
+	graphqlURL := fs.String("graphql-url", "", "send GraphQL requests to this URL, such as a caching proxy, defaults to GITHUB_GRAPHQL_URL")
+	githubURL := fs.String("github-url", "", "base URL of a GitHub Enterprise Server to check, such as https://github.example.com")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s doctor [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	healthy := true
+
+	// Every family falls back to GITHUB_TOKEN, so each must resolve to something
+	for _, family := range []string{"search", "graphql", "rest"} {
+		var err error
+		if Token(family) == "" {
+			err = errors.New("no token")
+		}
+		healthy = doctorCheck(family+" token", err, "set GITHUB_TOKEN (or GITHUB_TOKEN_"+strings.ToUpper(family)+") to a personal access token") && healthy
+	}
+
+	// A single authenticated request checks connectivity, the token and the clock
+	client := NewHTTPClient(ctx, http.DefaultTransport, Token("rest"))
+	client.Timeout = 30 * time.Second
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *restURL+"/rate_limit", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		healthy = doctorCheck("connectivity", err, "check DNS resolution of the API host, or -rest-url for GitHub Enterprise") && healthy
+	case err != nil:
+		healthy = doctorCheck("connectivity", err, "check network access to the API, including HTTPS_PROXY if behind a proxy") && healthy
+	default:
+		defer resp.Body.Close()
+		healthy = doctorCheck("connectivity", nil, "") && healthy
+		if resp.StatusCode == http.StatusUnauthorized {
+			err = fmt.Errorf("status code %d", resp.StatusCode)
+		}
+		healthy = doctorCheck("authentication", err, "the token is invalid or expired, generate a new one") && healthy
+
+		// The server's Date is compared with the local time at the midpoint of the request
+		err = nil
+		if date, dateErr := http.ParseTime(resp.Header.Get("Date")); dateErr != nil {
+			err = fmt.Errorf("no Date header: %w", dateErr)
+		} else if skew := date.Sub(start.Add(time.Since(start) / 2)).Round(time.Second); skew > *maxSkew || -skew > *maxSkew {
+			err = fmt.Errorf("local clock is off by %s", -skew)
+		}
+		healthy = doctorCheck("clock skew", err, "sync the system clock with NTP, rate limit reset times depend on it") && healthy
+
+		var limits rateLimits
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&limits)
+		} else {
+			err = fmt.Errorf("status code %d", resp.StatusCode)
+		}
+		for _, resource := range []string{"search", "graphql", "core"} {
+			limit, ok := limits.Resources[resource]
+			limitErr := err
+			if limitErr == nil && !ok {
+				limitErr = errors.New("not reported")
+			} else if limitErr == nil && limit.Remaining == 0 {
+				limitErr = fmt.Errorf("exhausted until %s", time.Unix(limit.Reset, 0).Format(time.RFC3339))
+			}
+			if doctorCheck(resource+" rate limit", limitErr, "wait for the reset or use another token, see -max-api-calls to stay within it") {
+				fmt.Printf("     %d/%d remaining\n", limit.Remaining, limit.Limit)
+			} else {
+				healthy = false
+			}
+		}
+	}
+
+	// The crawl searches over GraphQL with the search token, which may be served from elsewhere than -rest-url
+	endpoint := GraphQLEndpoint(*graphqlURL, *githubURL)
+	if endpoint == "" {
+		endpoint = "https://api.github.com/graphql"
+	}
+	graphqlCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	// https://docs.github.com/en/graphql/overview/rate-limits-and-node-limits-for-the-graphql-api#returning-the-state-of-the-primary-rate-limit
+	var q struct {
+		RateLimit struct {
+			Limit     int
+			Remaining int
+			ResetAt   time.Time
+		}
+	}
+	err = NewClient(graphqlCtx, http.DefaultTransport, endpoint, Token("search")).Query(graphqlCtx, &q, nil)
+	if err == nil && q.RateLimit.Remaining == 0 {
+		err = fmt.Errorf("exhausted until %s", q.RateLimit.ResetAt.Format(time.RFC3339))
+	}
+	if doctorCheck("graphql query at "+endpoint, err, "check -graphql-url or -github-url, and that the search token (GITHUB_TOKEN_SEARCH or GITHUB_TOKEN) is valid there") {
+		fmt.Printf("     %d/%d remaining\n", q.RateLimit.Remaining, q.RateLimit.Limit)
+	} else {
+		healthy = false
+	}
+
+	if *output != "" {
+		// Create a file alongside the output, as the output itself may not exist yet
+		f, err := os.CreateTemp(filepath.Dir(*output), ".doctor-*")
+		if err == nil {
+			f.Close()
+			err = os.Remove(f.Name())
+		}
+		healthy = doctorCheck("output "+*output, err, "choose a writable directory or fix its permissions") && healthy
+	}
+	if !healthy {
+		os.Exit(1)
+	}
+}
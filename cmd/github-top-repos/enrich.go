@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// enrichFlags are the flags shared by subcommands that enrich the output of a previous crawl.
+type enrichFlags struct {
+	*flag.FlagSet
+	API              *APIFlags
+	Jobs             *int
+	Interval         *time.Duration
+	GraphQLURL       *string
+	GitHubURL        *string
+	NameRegex        *string
+	ExcludeNameRegex *string
+	GraphQLInterval  *time.Duration
+	RESTInterval     *time.Duration
+	GraphQLPauseAt   *int
+	HeadroomInterval *time.Duration
+	RateConfig       *string
+	Pace             *bool
+
+	// built are the transports once built, with the func that closes them.
+	built *enrichTransports
+	done  func()
+}
+
+// newEnrichFlags returns the flag set of the named enrichment subcommand,
+// defaulting to jobs parallel requests at most one per interval.
+func newEnrichFlags(name string, jobs int, interval time.Duration) *enrichFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] (file.csv|file.ndjson|-)\n", os.Args[0], name)
+		fs.PrintDefaults()
+	}
+	return &enrichFlags{
+		FlagSet:          fs,
+		API:              AddAPIFlags(fs),
+		Jobs:             fs.Int("jobs", jobs, "number of repositories to fetch in parallel"),
+		Interval:         fs.Duration("interval", interval, "minimum time between requests (0 for no limit)"),
+		GraphQLURL:       fs.String("graphql-url", "", "send GraphQL requests to this URL, such as a caching proxy, defaults to GITHUB_GRAPHQL_URL"),
+		GitHubURL:        fs.String("github-url", "", "base URL of a GitHub Enterprise Server to send GraphQL requests to, such as https://github.example.com"),
+		NameRegex:        fs.String("name-regex", "", "only fetch repositories whose owner/name matches this regexp"),
+		ExcludeNameRegex: fs.String("exclude-name-regex", "", "skip repositories whose owner/name matches this regexp"),
+		GraphQLInterval:  fs.Duration("graphql-interval", 0, "minimum time between GraphQL requests, across all stages of enrich (0 for no limit), authenticated by GITHUB_TOKEN_GRAPHQL if set"),
+		RESTInterval:     fs.Duration("rest-interval", 0, "minimum time between REST requests, across all stages of enrich (0 for no limit), authenticated by GITHUB_TOKEN_REST if set"),
+		GraphQLPauseAt:   fs.Int("graphql-pause-at", 0, "pause GraphQL requests until the rate limit resets once the token has this many points or fewer left, leaving them to a concurrent crawl"),
+		HeadroomInterval: fs.Duration("headroom-interval", 0, "log the remaining rate limits, time slept and projected exhaustion on this interval (0 to disable)"),
+		RateConfig:       fs.String("rate-config", "", "file of family=interval lines, such as graphql=1s, overriding -graphql-interval and -rest-interval and reloaded on SIGHUP"),
+		Pace:             fs.Bool("pace", false, "space the requests of each family to use up its remaining rate limit exactly as it resets, going by the rate limit headers of each response"),
+	}
+}
+
+// parse parses args and reads the repositories to enrich, exiting on any error. Repositories of the input identified
+// only by an ID are resolved to their owner/name before filtering, with the transports of the subcommand.
+func (f *enrichFlags) parse(ctx context.Context, args []string) []ghsearch.Repository {
+	f.Parse(args)
+	if f.NArg() != 1 || *f.Jobs < 1 {
+		f.Usage()
+		os.Exit(1)
+	}
+	*f.GraphQLURL = GraphQLEndpoint(*f.GraphQLURL, *f.GitHubURL)
+	filters, err := nameFilters(*f.NameRegex, *f.ExcludeNameRegex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refs, err := readRepositoryRefs(f.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var client *githubv4.Client
+	for _, ref := range refs {
+		if ref.NameWithOwner == "" {
+			transports, _ := f.transports(ctx)
+			client = NewClient(ctx, transports.GraphQL, *f.GraphQLURL, Token("graphql"))
+			break
+		}
+	}
+	repos, err := ResolveRepositories(ctx, client, refs)
+	if err != nil {
+		fatal(err)
+	}
+	return filterRepositories(repos, filters)
+}
+
+// resolveBatchSize is the number of nodes looked up by each query of ResolveRepositories, the most GitHub allows.
+const resolveBatchSize = 100
+
+// LegacyNodeID returns the node ID of the repository of a database ID in the legacy format, which GitHub still
+// accepts as the ID of a node.
+// https://docs.github.com/en/graphql/guides/migrating-graphql-global-node-ids
+func LegacyNodeID(databaseID int) string {
+	return base64.StdEncoding.EncodeToString([]byte("010:Repository" + strconv.Itoa(databaseID)))
+}
+
+// ResolveRepositories returns the repositories of refs in order, looking up the owner/name of those identified only
+// by an ID with client, by their node ID if known. Those that no longer exist or can't be seen are logged and left out.
+func ResolveRepositories(ctx context.Context, client *githubv4.Client, refs []RepositoryRef) ([]ghsearch.Repository, error) {
+	repos := make([]ghsearch.Repository, 0, len(refs))
+	var unresolved []int
+	for i, ref := range refs {
+		if ref.NameWithOwner == "" {
+			unresolved = append(unresolved, i)
+		}
+	}
+	resolved := make(map[int]ghsearch.Repository, len(unresolved))
+	for len(unresolved) > 0 {
+		batch := unresolved[:min(len(unresolved), resolveBatchSize)]
+		unresolved = unresolved[len(batch):]
+		ids := make([]githubv4.ID, len(batch))
+		for i, index := range batch {
+			if ids[i] = refs[index].NodeID; refs[index].NodeID == "" {
+				ids[i] = LegacyNodeID(refs[index].DatabaseId)
+			}
+		}
+		// https://docs.github.com/en/graphql/reference/queries#nodes
+		var q struct {
+			Nodes []struct {
+				Repository struct {
+					DatabaseId    int
+					NameWithOwner string
+				} `graphql:"... on Repository"`
+			} `graphql:"nodes(ids: $ids)"`
+		}
+		if err := client.Query(ctx, &q, map[string]any{"ids": ids}); err != nil {
+			return nil, fmt.Errorf("resolving %d repositories from %v: %w", len(ids), ids[0], err)
+		}
+		for i, node := range q.Nodes {
+			if i < len(batch) && node.Repository.NameWithOwner != "" {
+				resolved[batch[i]] = ghsearch.Repository{NameWithOwner: node.Repository.NameWithOwner, DatabaseId: node.Repository.DatabaseId}
+			}
+		}
+	}
+	for i, ref := range refs {
+		if ref.NameWithOwner != "" {
+			repos = append(repos, ghsearch.Repository{NameWithOwner: ref.NameWithOwner, DatabaseId: ref.DatabaseId})
+		} else if repo, ok := resolved[i]; ok {
+			repos = append(repos, repo)
+		} else {
+			log.Printf("Skipping unresolvable repository of database ID %d, node ID %q", ref.DatabaseId, ref.NodeID)
+		}
+	}
+	return repos, nil
+}
+
+// enrichTransports are the transports of an enrichment subcommand, built by enrichFlags.transports.
+type enrichTransports struct {
+	// GraphQL and REST send to the GitHub APIs, each rate limited separately as GitHub limits them.
+	GraphQL http.RoundTripper
+	REST    http.RoundTripper
+	// Other sends to services other than GitHub, such as deps.dev, sharing only the audit log, budget and retries.
+	Other http.RoundTripper
+}
+
+// transports builds the transport stack shared by the enrichment subcommands: the traffic accounting, audit log
+// and budget of every request sent, then the headroom, pace and rate limit of each API family, then the retries.
+// The returned func logs the traffic and closes the audit log. The transports are only built once.
+func (f *enrichFlags) transports(ctx context.Context) (*enrichTransports, func()) {
+	if f.built != nil {
+		return f.built, f.done
+	}
+	accounting := &AccountingTransport{Base: http.DefaultTransport}
+	logTraffic := sync.OnceFunc(func() {
+		log.Printf("API traffic: %s", accounting.Summary())
+	})
+	fatalHooks = append(fatalHooks, logTraffic)
+	metered, err := f.API.Meter(accounting)
+	if err != nil {
+		fatal(err)
+	}
+	// Secondary rate limits are enforced per endpoint family, so each is limited separately
+	graphqlTransport, restTransport := metered, metered
+	var graphqlHeadroom, restHeadroom *Headroom
+	if *f.HeadroomInterval > 0 {
+		graphqlHeadroom, restHeadroom = &Headroom{Name: "graphql"}, &Headroom{Name: "rest"}
+		graphqlTransport = &HeadroomTransport{Base: graphqlTransport, Headroom: graphqlHeadroom}
+		restTransport = &HeadroomTransport{Base: restTransport, Headroom: restHeadroom}
+		go graphqlHeadroom.Log(ctx, *f.HeadroomInterval)
+		go restHeadroom.Log(ctx, *f.HeadroomInterval)
+	}
+	graphqlTransport = NewThresholdTransport(graphqlTransport, *f.GraphQLPauseAt, graphqlHeadroom)
+	if *f.Pace {
+		graphqlTransport = NewPaceTransport(graphqlTransport, graphqlHeadroom)
+		restTransport = NewPaceTransport(restTransport, restHeadroom)
+	}
+	if *f.RateConfig != "" {
+		// Always limit the rate so it can be changed by reloading the file
+		graphqlLimiter := &RateTransport{Base: graphqlTransport, Interval: *f.GraphQLInterval, Headroom: graphqlHeadroom}
+		restLimiter := &RateTransport{Base: restTransport, Interval: *f.RESTInterval, Headroom: restHeadroom}
+		config := &RateConfig{Path: *f.RateConfig, Transports: map[string]*RateTransport{
+			"graphql": graphqlLimiter,
+			"rest":    restLimiter,
+		}}
+		if err := config.Reload(); err != nil {
+			fatal(err)
+		}
+		config.ReloadOnSignal(ctx)
+		graphqlTransport, restTransport = graphqlLimiter, restLimiter
+	} else {
+		graphqlTransport = NewRateTransport(graphqlTransport, *f.GraphQLInterval, graphqlHeadroom)
+		restTransport = NewRateTransport(restTransport, *f.RESTInterval, restHeadroom)
+	}
+	partial := &PartialTransport{Base: f.API.Retry(ctx, graphqlTransport)}
+	t := &enrichTransports{
+		GraphQL: partial,
+		REST:    f.API.Retry(ctx, restTransport),
+		Other:   f.API.Retry(ctx, metered),
+	}
+	f.built, f.done = t, func() {
+		if skipped := partial.Skipped(); len(skipped) > 0 {
+			log.Printf("Skipped unresolvable repositories: %s", partial.Summary())
+		}
+		logTraffic()
+		f.API.Close()
+	}
+	return f.built, f.done
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+func TestLegacyNodeID(t *testing.T) {
+	// The ID of github/linguist in the GraphQL documentation
+	if got, want := LegacyNodeID(1296269), "MDEwOlJlcG9zaXRvcnkxMjk2MjY5"; got != want {
+		t.Errorf("LegacyNodeID() = %q, want %q", got, want)
+	}
+}
+
+func TestResolveRepositories(t *testing.T) {
+	// nodes are the repositories of the server by node ID
+	nodes := map[string]ghsearch.Repository{
+		LegacyNodeID(10): {NameWithOwner: "renamed/x", DatabaseId: 10},
+		"R_kgDOB":        {NameWithOwner: "b/y", DatabaseId: 20},
+	}
+	var queried [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables struct {
+				IDs []string `json:"ids"`
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !strings.Contains(req.Query, "nodes(ids: $ids)") {
+			t.Errorf("unexpected request %+v: %v", req, err)
+		}
+		queried = append(queried, req.Variables.IDs)
+		var data, errs []string
+		for i, id := range req.Variables.IDs {
+			if repo, ok := nodes[id]; ok {
+				data = append(data, fmt.Sprintf(`{"databaseId":%d,"nameWithOwner":%q}`, repo.DatabaseId, repo.NameWithOwner))
+			} else {
+				data = append(data, "null")
+				errs = append(errs, fmt.Sprintf(`{"type":"NOT_FOUND","path":["nodes",%d],"message":"Could not resolve to a node with the global id of '%s'"}`, i, id))
+			}
+		}
+		fmt.Fprintf(w, `{"data":{"nodes":[%s]}`, strings.Join(data, ","))
+		if len(errs) > 0 {
+			fmt.Fprintf(w, `,"errors":[%s]`, strings.Join(errs, ","))
+		}
+		fmt.Fprint(w, "}")
+	}))
+	defer server.Close()
+	client := NewClient(context.Background(), &PartialTransport{Base: http.DefaultTransport}, server.URL, "token")
+
+	refs := []RepositoryRef{
+		{NameWithOwner: "a/w", DatabaseId: 1},
+		{DatabaseId: 10},
+		{NodeID: "R_kgDOB", DatabaseId: 99},
+		{DatabaseId: 30},
+		{NameWithOwner: "c/z"},
+	}
+	repos, err := ResolveRepositories(context.Background(), client, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ghsearch.Repository{
+		{NameWithOwner: "a/w", DatabaseId: 1},
+		{NameWithOwner: "renamed/x", DatabaseId: 10},
+		{NameWithOwner: "b/y", DatabaseId: 20},
+		{NameWithOwner: "c/z"},
+	}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ResolveRepositories() = %+v, want %+v", repos, want)
+	}
+	// Only those without a name are looked up, by their node ID if known
+	if want := [][]string{{LegacyNodeID(10), "R_kgDOB", LegacyNodeID(30)}}; !reflect.DeepEqual(queried, want) {
+		t.Errorf("queried %q, want %q", queried, want)
+	}
+}
+
+func TestResolveRepositoriesBatches(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				IDs []string `json:"ids"`
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		batches = append(batches, len(req.Variables.IDs))
+		data := make([]string, len(req.Variables.IDs))
+		for i := range data {
+			data[i] = fmt.Sprintf(`{"databaseId":1,"nameWithOwner":"a/%d"}`, i)
+		}
+		fmt.Fprintf(w, `{"data":{"nodes":[%s]}}`, strings.Join(data, ","))
+	}))
+	defer server.Close()
+	client := NewClient(context.Background(), http.DefaultTransport, server.URL, "token")
+	refs := make([]RepositoryRef, 2*resolveBatchSize+1)
+	for i := range refs {
+		refs[i].DatabaseId = i + 1
+	}
+	repos, err := ResolveRepositories(context.Background(), client, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != len(refs) || !reflect.DeepEqual(batches, []int{resolveBatchSize, resolveBatchSize, 1}) {
+		t.Errorf("resolved %d repositories in batches of %v, want %d in batches of at most %d", len(repos), batches, len(refs), resolveBatchSize)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// MatchName keeps repositories whose NameWithOwner matches re.
+func MatchName(re *regexp.Regexp) ghsearch.Filter {
+	return func(repo ghsearch.Repository) bool {
+		return re.MatchString(repo.NameWithOwner)
+	}
+}
+
+// ExcludeName drops repositories whose NameWithOwner matches re.
+func ExcludeName(re *regexp.Regexp) ghsearch.Filter {
+	return func(repo ghsearch.Repository) bool {
+		return !re.MatchString(repo.NameWithOwner)
+	}
+}
+
+// DescriptionContains keeps repositories whose description contains substr, ignoring case.
+func DescriptionContains(substr string) ghsearch.Filter {
+	substr = strings.ToLower(substr)
+	return func(repo ghsearch.Repository) bool {
+		return strings.Contains(strings.ToLower(repo.Description), substr)
+	}
+}
+
+// MatchDescription keeps repositories whose description matches re.
+func MatchDescription(re *regexp.Regexp) ghsearch.Filter {
+	return func(repo ghsearch.Repository) bool {
+		return re.MatchString(repo.Description)
+	}
+}
+
+// owner returns the owner login of a NameWithOwner.
+func owner(nameWithOwner string) string {
+	owner, _, _ := strings.Cut(nameWithOwner, "/")
+	return owner
+}
+
+// OwnerCap keeps at most n repositories from each owner, in the order they are found.
+func OwnerCap(n int) ghsearch.Filter {
+	counts := make(map[string]int)
+	return func(repo ghsearch.Repository) bool {
+		login := owner(repo.NameWithOwner)
+		if counts[login] >= n {
+			return false
+		}
+		counts[login]++
+		return true
+	}
+}
+
+// TopPerOwner keeps the n highest-starred rows from each owner, preserving their order.
+func TopPerOwner(rows []ghsearch.Row, n int) []ghsearch.Row {
+	byOwner := make(map[string][]ghsearch.Row)
+	for _, row := range rows {
+		login := owner(row.NameWithOwner)
+		byOwner[login] = append(byOwner[login], row)
+	}
+	keep := make(map[string]bool)
+	for _, owned := range byOwner {
+		sort.SliceStable(owned, func(i, j int) bool {
+			return owned[i].StargazerCount > owned[j].StargazerCount
+		})
+		for _, row := range owned[:min(n, len(owned))] {
+			keep[row.NameWithOwner] = true
+		}
+	}
+	var kept []ghsearch.Row
+	for _, row := range rows {
+		if keep[row.NameWithOwner] {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
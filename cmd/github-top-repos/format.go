@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// The values of every text output (CSV, SQLite scripts and the subcommands' CSVs) are formatted here, the same
+// regardless of the locale or a future option, so a warehouse loading them never sees a different form.
+// Numbers have no grouping separators, a leading - if negative, and a . decimal point without an exponent.
+
+// FormatInt formats n in decimal, ex: 1234567.
+func FormatInt(n int) string {
+	return strconv.Itoa(n)
+}
+
+// FormatFloat formats f in decimal with as many digits as needed to represent it exactly, ex: 0.000001 or 1234.5.
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// FormatBool formats b as true or false.
+func FormatBool(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// FormatTime formats t as RFC 3339 in UTC to the second, ex: 2006-01-02T15:04:05Z.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// FormatDate formats the UTC day of t, ex: 2006-01-02.
+func FormatDate(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// FormatLanguages formats the sizes of languages in bytes in their order, largest first as GitHub returns them,
+// ex: Go=1234;Shell=56. Language names have no = or ; in them.
+func FormatLanguages(languages []ghsearch.LanguageEdge) string {
+	return string(AppendLanguages(nil, languages))
+}
+
+// AppendInt appends FormatInt of n to dst, for encoding a row into a reused buffer without allocating.
+func AppendInt(dst []byte, n int) []byte {
+	return strconv.AppendInt(dst, int64(n), 10)
+}
+
+// AppendBool appends FormatBool of b to dst.
+func AppendBool(dst []byte, b bool) []byte {
+	return strconv.AppendBool(dst, b)
+}
+
+// AppendTime appends FormatTime of t to dst.
+func AppendTime(dst []byte, t time.Time) []byte {
+	return t.UTC().AppendFormat(dst, time.RFC3339)
+}
+
+// AppendLanguages appends FormatLanguages of languages to dst.
+func AppendLanguages(dst []byte, languages []ghsearch.LanguageEdge) []byte {
+	for i, language := range languages {
+		if i > 0 {
+			dst = append(dst, ';')
+		}
+		dst = append(append(dst, language.Node.Name...), '=')
+		dst = AppendInt(dst, language.Size)
+	}
+	return dst
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+func TestFormatInt(t *testing.T) {
+	for n, want := range map[int]string{
+		0:             "0",
+		-5:            "-5",
+		1234567:       "1234567",
+		math.MaxInt64: "9223372036854775807",
+		math.MinInt64: "-9223372036854775808",
+	} {
+		if got := FormatInt(n); got != want {
+			t.Errorf("FormatInt(%d) = %q, want %q", n, got, want)
+		}
+		if got := string(AppendInt([]byte("x"), n)); got != "x"+want {
+			t.Errorf("AppendInt(%d) = %q, want %q", n, got, "x"+want)
+		}
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	for f, want := range map[float64]string{
+		0:                   "0",
+		-0.5:                "-0.5",
+		0.000001:            "0.000001",
+		1234.5:              "1234.5",
+		0.30000000000000004: "0.30000000000000004",
+		1e21:                "1000000000000000000000",
+		math.MaxInt32 + 1:   "2147483648",
+	} {
+		if got := FormatFloat(f); got != want {
+			t.Errorf("FormatFloat(%v) = %q, want %q", f, got, want)
+		}
+	}
+}
+
+func TestFormatBool(t *testing.T) {
+	for b, want := range map[bool]string{true: "true", false: "false"} {
+		if got := FormatBool(b); got != want {
+			t.Errorf("FormatBool(%t) = %q, want %q", b, got, want)
+		}
+		if got := string(AppendBool(nil, b)); got != want {
+			t.Errorf("AppendBool(%t) = %q, want %q", b, got, want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	for _, tt := range []struct {
+		t          time.Time
+		time, date string
+	}{
+		{time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), "2006-01-02T15:04:05Z", "2006-01-02"},
+		// Converted to UTC, crossing the day
+		{time.Date(2024, 1, 1, 1, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)), "2023-12-31T23:30:00Z", "2023-12-31"},
+		// Truncated to the second
+		{time.Date(2012, 3, 4, 5, 6, 7, 891000000, time.UTC), "2012-03-04T05:06:07Z", "2012-03-04"},
+		{time.Time{}, "0001-01-01T00:00:00Z", "0001-01-01"},
+	} {
+		if got := FormatTime(tt.t); got != tt.time {
+			t.Errorf("FormatTime(%v) = %q, want %q", tt.t, got, tt.time)
+		}
+		if got := string(AppendTime(nil, tt.t)); got != tt.time {
+			t.Errorf("AppendTime(%v) = %q, want %q", tt.t, got, tt.time)
+		}
+		if got := FormatDate(tt.t); got != tt.date {
+			t.Errorf("FormatDate(%v) = %q, want %q", tt.t, got, tt.date)
+		}
+	}
+}
+
+func TestFormatLanguages(t *testing.T) {
+	language := func(name string, size int) ghsearch.LanguageEdge {
+		var edge ghsearch.LanguageEdge
+		edge.Node.Name, edge.Size = name, size
+		return edge
+	}
+	for _, tt := range []struct {
+		languages []ghsearch.LanguageEdge
+		want      string
+	}{
+		{nil, ""},
+		{[]ghsearch.LanguageEdge{language("Go", 1234)}, "Go=1234"},
+		// In the order given, as GitHub returns them largest first
+		{[]ghsearch.LanguageEdge{language("Go", 1234), language("Shell", 56), language("C++", 0)}, "Go=1234;Shell=56;C++=0"},
+		{[]ghsearch.LanguageEdge{language("Vim Script", 7), language("Ren'Py", 3)}, "Vim Script=7;Ren'Py=3"},
+	} {
+		if got := FormatLanguages(tt.languages); got != tt.want {
+			t.Errorf("FormatLanguages(%+v) = %q, want %q", tt.languages, got, tt.want)
+		}
+		if got := string(AppendLanguages([]byte("x,"), tt.languages)); got != "x,"+tt.want {
+			t.Errorf("AppendLanguages(%+v) = %q, want %q", tt.languages, got, "x,"+tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// http://www.softwareishard.com/blog/har-12-spec/
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	} `json:"timings"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	PostData    *struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	} `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	} `json:"content"`
+	RedirectURL string `json:"redirectURL"`
+	HeadersSize int    `json:"headersSize"`
+	BodySize    int    `json:"bodySize"`
+}
+
+// harHeaders converts headers to HAR name/value pairs, redacting credentials.
+func harHeaders(h http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for name, values := range h {
+		for _, value := range values {
+			switch http.CanonicalHeaderKey(name) {
+			case "Authorization", "Cookie", "Set-Cookie":
+				value = "REDACTED"
+			}
+			pairs = append(pairs, harNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// HARTransport is a http.RoundTripper that captures the first Limit request/response pairs into a HAR file.
+type HARTransport struct {
+	Base  http.RoundTripper
+	Path  string
+	Limit int
+
+	mu  sync.Mutex
+	har harLog
+}
+
+// NewHARTransport captures up to limit requests made via base to the HAR file at path.
+func NewHARTransport(base http.RoundTripper, path string, limit int) *HARTransport {
+	t := &HARTransport{Base: base, Path: path, Limit: limit}
+	t.har.Log.Version = "1.2"
+	t.har.Log.Creator.Name = "github-top-repos"
+	t.har.Log.Creator.Version = "1.0"
+	t.har.Log.Entries = []harEntry{}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HARTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	full := len(t.har.Log.Entries) >= t.Limit
+	t.mu.Unlock()
+	if full {
+		return t.Base.RoundTrip(req)
+	}
+
+	var entry harEntry
+	entry.StartedDateTime = time.Now()
+	entry.Request = harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Headers:     harHeaders(req.Header),
+		QueryString: []harNameValue{},
+		Cookies:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			text, _ := io.ReadAll(body)
+			body.Close()
+			entry.Request.BodySize = len(text)
+			entry.Request.PostData = &struct {
+				MimeType string `json:"mimeType"`
+				Text     string `json:"text"`
+			}{MimeType: req.Header.Get("Content-Type"), Text: string(text)}
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	wait := time.Since(entry.StartedDateTime)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	entry.Time = float64(time.Since(entry.StartedDateTime).Microseconds()) / 1000
+	entry.Timings.Wait = float64(wait.Microseconds()) / 1000
+	entry.Timings.Receive = entry.Time - entry.Timings.Wait
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	entry.Response.Content.Size = len(body)
+	entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+	entry.Response.Content.Text = string(body)
+
+	// Rewrite the whole file each time so a crash still leaves a usable capture
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.har.Log.Entries) >= t.Limit {
+		return resp, nil
+	}
+	t.har.Log.Entries = append(t.har.Log.Entries, entry)
+	if err := t.write(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// write saves the captured entries to Path.
+func (t *HARTransport) write() error {
+	b, err := json.MarshalIndent(&t.har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.Path, b, 0600)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headroom tracks the primary rate limit of a token from the X-RateLimit-* response headers.
+type Headroom struct {
+	// Name identifies the token in the log, such as the API family.
+	Name string
+
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	reset     time.Time
+	// since and sinceRemaining are the first observation of the current rate limit window
+	since          time.Time
+	sinceRemaining int
+	slept          time.Duration
+}
+
+// Observe records the rate limit headers of resp, if any.
+func (h *Headroom) Observe(resp *http.Response) {
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	reset := time.Unix(unix, 0)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !reset.Equal(h.reset) {
+		h.since, h.sinceRemaining = time.Now(), remaining
+	}
+	h.limit, h.remaining, h.reset = limit, remaining, reset
+}
+
+// Slept records time spent waiting on a rate limit.
+func (h *Headroom) Slept(d time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.slept += d
+}
+
+// String summarizes the remaining quota and when it will run out at the current rate.
+func (h *Headroom) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.reset.IsZero() {
+		return fmt.Sprintf("%s: no rate limit seen yet, slept %s", h.Name, h.slept.Round(time.Second))
+	}
+	s := fmt.Sprintf("%s: %d/%d remaining until %s, slept %s", h.Name, h.remaining, h.limit,
+		h.reset.Format(time.RFC3339), h.slept.Round(time.Second))
+	// Project the exhaustion time from the rate of use in this window
+	used, elapsed := h.sinceRemaining-h.remaining, time.Since(h.since)
+	if used > 0 && elapsed > 0 {
+		exhausted := time.Now().Add(time.Duration(float64(elapsed) * float64(h.remaining) / float64(used)))
+		if exhausted.Before(h.reset) {
+			s += ", projected to run out at " + exhausted.Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+// Log logs the headroom every interval until ctx is done.
+func (h *Headroom) Log(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Printf("Rate limit %s", h)
+		}
+	}
+}
+
+// HeadroomTransport is a http.RoundTripper that records the rate limit of every response.
+type HeadroomTransport struct {
+	Base     http.RoundTripper
+	Headroom *Headroom
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HeadroomTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.Headroom.Observe(resp)
+	return resp, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// prompter asks questions on stdout, reading the answers from stdin.
+type prompter struct {
+	in *bufio.Reader
+}
+
+// ask prints question with the default answer def, returning the answer or def if empty.
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		log.Fatal("Aborted, no config was written")
+	} else if err != nil && err != io.EOF {
+		log.Fatal(err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// confirm asks a yes or no question, defaulting to yes.
+func (p *prompter) confirm(question string) bool {
+	answer := strings.ToLower(p.ask(question+" (y/n)", "y"))
+	return answer == "y" || answer == "yes"
+}
+
+// viewerLogin returns the login of the user authenticated by client.
+func viewerLogin(ctx context.Context, client *githubv4.Client) (string, error) {
+	// https://docs.github.com/en/graphql/reference/queries#viewer
+	var q struct {
+		Viewer struct {
+			Login string
+		}
+	}
+	if err := client.Query(ctx, &q, nil); err != nil {
+		return "", err
+	}
+	return q.Viewer.Login, nil
+}
+
+// initMain implements the init subcommand, interactively writing the config file.
+func initMain(ctx context.Context, config *Config, args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s init\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Interactively writes the config file, %s (set GITHUB_TOP_REPOS_CONFIG to change)\n", ConfigPath())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if config.Path == "" {
+		log.Fatal("No config directory, set GITHUB_TOP_REPOS_CONFIG to the file to write")
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin)}
+	fmt.Printf("Writing %s, press enter to accept the [default] of each question.\n\n", config.Path)
+
+	// Search requires authentication, preferring a token in the environment over storing one
+	fmt.Println("Authentication")
+	githubURL := p.ask("GitHub Enterprise Server URL, such as https://github.example.com (or none for github.com)", config.Values["github-url"])
+	if githubURL == "none" {
+		githubURL = ""
+	}
+	if githubURL != "" {
+		config.Values["github-url"] = githubURL
+	} else {
+		delete(config.Values, "github-url")
+	}
+	graphqlURL := GraphQLEndpoint(config.Values["graphql-url"], githubURL)
+	tokensHost := "https://github.com"
+	if githubURL != "" {
+		tokensHost = strings.TrimSuffix(githubURL, "/")
+	}
+	var client *githubv4.Client
+	for client == nil {
+		token := os.Getenv("GITHUB_TOKEN")
+		if token != "" {
+			fmt.Println("Using the token in GITHUB_TOKEN.")
+		} else if config.Token != "" && p.confirm("Keep the token stored in the config?") {
+			token = config.Token
+		} else {
+			fmt.Println("GITHUB_TOKEN is not set, a personal access token with no scopes can be stored in the config instead.")
+			fmt.Printf("Create one at %s/settings/tokens\n", tokensHost)
+			token = p.ask("Token (empty to set GITHUB_TOKEN later)", "")
+			config.Token = token
+		}
+		if token == "" {
+			break
+		}
+		client = NewClient(ctx, http.DefaultTransport, graphqlURL, token)
+		login, err := viewerLogin(ctx, client)
+		if err != nil {
+			fmt.Printf("The token did not work: %v\n", err)
+			if os.Getenv("GITHUB_TOKEN") != "" {
+				log.Fatal("Fix GITHUB_TOKEN and run init again")
+			}
+			client, config.Token = nil, ""
+			continue
+		}
+		fmt.Printf("Authenticated as %s.\n", login)
+	}
+
+	fmt.Println("\nQuery")
+	field := config.Field
+	if field == "" {
+		field = "stars"
+	}
+	for {
+		field = p.ask("Rank repositories by stars, forks or size", field)
+		if field == "stars" || field == "forks" || field == "size" {
+			break
+		}
+		fmt.Printf("Unsupported field %q.\n", field)
+	}
+	config.Field = field
+	fmt.Println("Narrow the search with qualifiers, such as language:go topic:cli, or leave it empty for every repository.")
+	fmt.Println("https://docs.github.com/en/search-github/searching-on-github/searching-for-repositories")
+	if len(config.Queries) > 0 {
+		fmt.Printf("Or use a saved query: @%s\n", strings.Join(sortedKeys(config.Queries), ", @"))
+	}
+	query := config.Query
+	for {
+		query = p.ask("Search query", query)
+		resolved, err := config.ResolveQuery(query)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		} else if client == nil {
+			break
+		}
+		// The count of all matches is a preview of how large the crawl will be,
+		// the range qualifier also makes an empty query valid
+		_, count, err := ghsearch.Search(ctx, client, resolved+" "+field+":>=0", 1)
+		if err != nil {
+			fmt.Printf("The search failed: %v\n", err)
+			continue
+		}
+		fmt.Printf("%d repositories match.\n", count)
+		if p.confirm("Use this query?") {
+			break
+		}
+	}
+	config.Query = query
+
+	fmt.Println("\nOutput")
+	format := config.Values["output-format"]
+	if format == "" {
+		format = "csv"
+	}
+	for {
+		format = p.ask("Format: csv, ndjson, parquet or sqlite", format)
+		if format == "csv" || format == "ndjson" || format == "parquet" || format == "sqlite" {
+			config.Values["output-format"] = format
+			break
+		}
+		fmt.Printf("Unsupported format %q.\n", format)
+	}
+	for {
+		fields := p.ask("Optional fields, comma-separated: languages, license, topics, flags, owner (or none)", config.Values["fields"])
+		if fields == "none" {
+			fields = ""
+		}
+		if _, err := ParseOutputFields(fields); err != nil {
+			fmt.Printf("Invalid fields: %v\n", err)
+			continue
+		}
+		if fields != "" {
+			config.Values["fields"] = fields
+		} else {
+			delete(config.Values, "fields")
+		}
+		break
+	}
+
+	if err := config.Save(); err != nil {
+		log.Fatalf("Failed to write config: %v", err)
+	}
+	fmt.Printf("\nWrote %s, start the crawl with:\n  %s > top-repos.%s\n", config.Path, os.Args[0], config.Values["output-format"])
+	if config.Token == "" && os.Getenv("GITHUB_TOKEN") == "" {
+		fmt.Println("after setting GITHUB_TOKEN to a personal access token.")
+	}
+}
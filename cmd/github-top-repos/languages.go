@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// FetchLanguages returns the database ID of a repository and up to 10 of its languages, largest first.
+func FetchLanguages(ctx context.Context, client *githubv4.Client, nameWithOwner string) (int, []ghsearch.LanguageEdge, error) {
+	owner, name, _ := strings.Cut(nameWithOwner, "/")
+	// https://docs.github.com/en/graphql/reference/objects#languageconnection
+	var q struct {
+		Repository struct {
+			DatabaseId int
+			Languages  struct {
+				Edges []ghsearch.LanguageEdge
+			} `graphql:"languages(first: 10, orderBy: {field: SIZE, direction: DESC})"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	if err := client.Query(ctx, &q, map[string]any{
+		"owner": githubv4.String(owner),
+		"name":  githubv4.String(name),
+	}); err != nil {
+		return 0, nil, err
+	}
+	return q.Repository.DatabaseId, q.Repository.Languages.Edges, nil
+}
+
+// languagesMain implements the languages subcommand.
+func languagesMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("languages", 4, 100*time.Millisecond)
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql"))
+
+	// Output is a languages table keyed by the database ID, one row per language rather than the FormatLanguages
+	// column of a crawl or the enrich languages stage, so it can be loaded as is
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"database_id", "name_with_owner", "language", "bytes"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		id, languages, err := FetchLanguages(ctx, client, repo.NameWithOwner)
+		if err != nil {
+			log.Printf("Failed to fetch languages of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, language := range languages {
+			w.Write([]string{FormatInt(id), repo.NameWithOwner, language.Node.Name, FormatInt(language.Size)})
+		}
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to fetch languages of %d repositories", n)
+	}
+}
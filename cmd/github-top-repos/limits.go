@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrResponseTooLarge is returned when a single response exceeds the size limit.
+var ErrResponseTooLarge = errors.New("response exceeds size limit")
+
+// ErrMemoryLimit is returned when the response bodies being read exceed the memory limit.
+var ErrMemoryLimit = errors.New("in-flight response memory limit exceeded")
+
+// LimitTransport is a http.RoundTripper that bounds the size of response bodies.
+type LimitTransport struct {
+	Base http.RoundTripper
+	// MaxResponseSize is the largest permitted single response body in bytes, 0 for unlimited.
+	MaxResponseSize int64
+	// MaxInFlight is the largest total of response bytes read but not yet closed, 0 for unlimited.
+	MaxInFlight int64
+
+	inFlight atomic.Int64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *LimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// Fail early if the server already told us it is too large
+	if t.MaxResponseSize > 0 && resp.ContentLength > t.MaxResponseSize {
+		resp.Body.Close()
+		return nil, ErrResponseTooLarge
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, t: t}
+	return resp, nil
+}
+
+// limitedBody enforces the limits of a LimitTransport as it is read.
+type limitedBody struct {
+	io.ReadCloser
+	t    *LimitTransport
+	read int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	inFlight := b.t.inFlight.Add(int64(n))
+	if b.t.MaxResponseSize > 0 && b.read > b.t.MaxResponseSize {
+		return n, ErrResponseTooLarge
+	}
+	if b.t.MaxInFlight > 0 && inFlight > b.t.MaxInFlight {
+		return n, ErrMemoryLimit
+	}
+	return n, err
+}
+
+// Close implements io.Closer, releasing the bytes read from the in-flight total.
+func (b *limitedBody) Close() error {
+	b.t.inFlight.Add(-b.read)
+	b.read = 0
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,1054 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+	"golang.org/x/oauth2"
+)
+
+// ErrBudgetExhausted is returned for any API call beyond the budget.
+var ErrBudgetExhausted = errors.New("API call budget exhausted")
+
+// BudgetTransport is a http.RoundTripper that only permits a fixed number of requests.
+type BudgetTransport struct {
+	Base      http.RoundTripper
+	Remaining atomic.Int64
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *BudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Remaining.Add(-1) < 0 {
+		return nil, ErrBudgetExhausted
+	}
+	return t.Base.RoundTrip(req)
+}
+
+// NewHTTPClient returns a HTTP client using transport authenticated by token.
+func NewHTTPClient(ctx context.Context, transport http.RoundTripper, token string) *http.Client {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	return oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	))
+}
+
+// NewClient returns a GraphQL client authenticated by token.
+// Requests are made via transport to graphqlURL, or the public GitHub API if empty.
+func NewClient(ctx context.Context, transport http.RoundTripper, graphqlURL, token string) *githubv4.Client {
+	httpClient := NewHTTPClient(ctx, transport, token)
+	if graphqlURL != "" {
+		return githubv4.NewEnterpriseClient(graphqlURL, httpClient)
+	}
+	return githubv4.NewClient(httpClient)
+}
+
+// GraphQLEndpoint returns the GraphQL URL to use: graphqlURL if set, otherwise the
+// endpoint of the GitHub Enterprise Server at githubURL if set, otherwise GITHUB_GRAPHQL_URL.
+// Empty is the public GitHub API.
+func GraphQLEndpoint(graphqlURL, githubURL string) string {
+	if graphqlURL != "" {
+		return graphqlURL
+	} else if githubURL != "" {
+		// https://docs.github.com/en/enterprise-server@latest/graphql/guides/forming-calls-with-graphql#the-graphql-endpoint
+		return strings.TrimSuffix(githubURL, "/") + "/api/graphql"
+	}
+	return os.Getenv("GITHUB_GRAPHQL_URL")
+}
+
+// fatalHooks are run by fatal and fatalf once the error is logged, before exiting, such as to log the traffic
+// of a failed crawl, which a deferred call would miss.
+var fatalHooks []func()
+
+// fatal is log.Fatal, running fatalHooks before exiting.
+func fatal(v ...any) {
+	log.Print(v...)
+	exitFatal()
+}
+
+// fatalf is log.Fatalf, running fatalHooks before exiting.
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	exitFatal()
+}
+
+// exitFatal runs fatalHooks, last added first, and exits.
+func exitFatal() {
+	for i := len(fatalHooks) - 1; i >= 0; i-- {
+		fatalHooks[i]()
+	}
+	os.Exit(1)
+}
+
+// Entry Point
+func main() {
+	ctx, cancel := stopContext(context.Background())
+	defer cancel()
+
+	// Subcommands operate on the output of a previous crawl
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "clone-list":
+			cloneListMain(os.Args[2:])
+			return
+		case "clone":
+			cloneMain(ctx, os.Args[2:])
+			return
+		case "download-archives":
+			downloadArchivesMain(ctx, os.Args[2:])
+			return
+		case "readmes":
+			readmesMain(ctx, os.Args[2:])
+			return
+		case "languages":
+			languagesMain(ctx, os.Args[2:])
+			return
+		case "advisories":
+			advisoriesMain(ctx, os.Args[2:])
+			return
+		case "deps-dev":
+			depsDevMain(ctx, os.Args[2:])
+			return
+		case "registries":
+			registriesMain(ctx, os.Args[2:])
+			return
+		case "citations":
+			citationsMain(ctx, os.Args[2:])
+			return
+		case "commit-activity":
+			commitActivityMain(ctx, os.Args[2:])
+			return
+		case "workflow-runs":
+			workflowRunsMain(ctx, os.Args[2:])
+			return
+		case "enrich":
+			enrichMain(ctx, os.Args[2:])
+			return
+		case "refresh":
+			refreshMain(ctx, os.Args[2:])
+			return
+		case "self-update":
+			selfUpdateMain(ctx, os.Args[2:])
+			return
+		case "version":
+			versionMain(os.Args[2:])
+			return
+		case "doctor":
+			doctorMain(ctx, os.Args[2:])
+			return
+		case "query":
+			queryMain(ctx, mustLoadConfig(), os.Args[2:])
+			return
+		case "init":
+			// A broken config is replaced rather than stopping init from fixing it
+			config, err := loadConfig()
+			if err != nil {
+				log.Printf("Replacing the unreadable config: %v", err)
+				config = NewConfig(ConfigPath())
+			}
+			initMain(ctx, config, os.Args[2:])
+			return
+		case "crawl":
+			crawlMain(ctx, mustLoadConfig(), os.Args[2:])
+			return
+		case "merge":
+			mergeMain(os.Args[2:])
+			return
+		case "stats":
+			statsMain(os.Args[2:])
+			return
+		}
+	}
+	// Crawling is the default, so crawl is optional
+	crawlMain(ctx, mustLoadConfig(), os.Args[1:])
+}
+
+// crawlMain implements the crawl subcommand.
+func crawlMain(ctx context.Context, config *Config, args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+
+	// Parse the CLI args
+	api := AddAPIFlags(fs)
+	harFile := fs.String("har", "", "debug: capture HTTP requests/responses (token redacted) to this HAR file")
+	pprofAddr := fs.String("pprof-addr", "", "debug: serve runtime profiles and metrics (/debug/vars) at this address, ex: localhost:6060 for go tool pprof http://localhost:6060/debug/pprof/profile")
+	harLimit := fs.Int("har-limit", 50, "debug: maximum number of requests to capture with -har")
+	var transportOpts TransportOptions
+	fs.IntVar(&transportOpts.MaxIdleConnsPerHost, "max-idle-conns-per-host", http.DefaultMaxIdleConnsPerHost, "maximum idle HTTP connections kept per host")
+	fs.BoolVar(&transportOpts.HTTP2, "http2", true, "attempt to use HTTP/2")
+	fs.BoolVar(&transportOpts.DisableKeepAlives, "disable-keep-alives", false, "disable HTTP keep-alives, using each connection for a single request")
+	fs.DurationVar(&transportOpts.KeepAlive, "keep-alive", 30*time.Second, "interval between TCP keep-alive probes")
+	fs.DurationVar(&transportOpts.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "how long an idle HTTP connection is kept open")
+	fs.DurationVar(&transportOpts.DNSCacheTTL, "dns-cache", 0, "cache DNS lookups for this long (0 to disable)")
+	graphqlURL := fs.String("graphql-url", "", "send GraphQL requests to this URL, such as a caching proxy, defaults to GITHUB_GRAPHQL_URL")
+	githubURL := fs.String("github-url", "", "base URL of a GitHub Enterprise Server to crawl, such as https://github.example.com")
+	maxResponseSize := fs.Int64("max-response-size", 64<<20, "skip a batch if a single response exceeds this many bytes (0 for unlimited)")
+	maxInFlight := fs.Int64("max-in-flight", 0, "skip a batch if response bodies being read exceed this many bytes in total (0 for unlimited)")
+	outputPath := fs.String("output", "", "write the output to this file instead of stdout, as a .partial file renamed into place once the crawl completes, or upsert it into the SQLite database of sqlite://path, ex: sqlite://repos.db")
+	update := fs.String("update", "", "append the repositories created since the latest one in this CSV output of a previous crawl, written with -header and a created_at column, skipping those already in it (see -settle)")
+	rotateDaily := fs.Bool("rotate-daily", false, "with -output, write one file per day the repositories were created, ex: repos-2006-01-02.csv for -output repos.csv")
+	compress := fs.String("compress", "", "compress the output as it is written: gzip or zstd (name -output accordingly, ex: repos.csv.gz)")
+	parallelDays := fs.Int("parallel-days", 0, "with -rotate-daily, crawl this many days of the created range at once, each checkpointed to its own -checkpoint file (ex: cp-2006-01-02.json) and renamed into place when done, so a re-run skips the finished days (0 to crawl the range as one)")
+	sinkQueue := fs.Int("sink-queue", 0, "write rows in the background through a queue of this many, so fetching continues while a slow output catches up, blocking once it is full (0 to write each row as it is found)")
+	flushInterval := fs.Duration("flush-interval", 0, "buffer output rows and flush them on this interval, to stdout or each -output file (0 to write each row immediately)")
+	outputFormat := fs.String("output-format", "csv", "output format, csv, ndjson (one JSON object per line), parquet (typed columns of every field) or sqlite (upserts to pipe into sqlite3, see -output sqlite://)")
+	header := fs.Bool("header", false, "write a CSV header row of the column names")
+	columns := fs.String("columns", "", "comma-separated CSV columns in order, instead of the owner/name, the field and -fields: name_with_owner, owner, name, database_id, stars, forks, size, description, created_at, suspected_bot, primary_language, languages, license, topics, is_fork, is_mirror, is_template, is_archived, is_disabled, owner_type, owner_id, owner_verified")
+	bom := fs.Bool("bom", false, "write a UTF-8 byte order mark before the CSV output (for Excel)")
+	crlf := fs.Bool("crlf", false, "terminate CSV rows with CRLF (for Excel)")
+	maxDescription := fs.Int("max-description", 0, "cut descriptions longer than this many characters, ending them with … (0 for no limit)")
+	safeCSV := fs.Bool("safe-csv", false, "prefix CSV values starting with =, +, -, @, a tab or carriage return with ' so spreadsheets don't evaluate them as formulas")
+	implicitQualifiers := fs.String("implicit-qualifiers", "", "comma-separated qualifiers appended to every query, ex: fork:false,mirror:false,is:public")
+	doublePass := fs.Bool("double-pass", false, "search each batch twice and union the results, as search is eventually consistent")
+	sortFanOut := fs.Bool("sort-fan-out", false, "re-run batches stuck above 1000 results on a single value with alternate sort orders")
+	order := fs.String("order", "desc", "order to walk the field values in, desc or asc")
+	sliceBy := fs.String("slice-by", "", "search independent slices instead of walking the field in sorted batches: stars (ranges such as stars:100..199, split while over 1000 results, requires the stars field) pushed (a -granularity of pushes at a time, with -start, -end and -range bounding the push time instead) or created (a -granularity of creation times at a time)")
+	var granularity string
+	fs.StringVar(&granularity, "granularity", "day", "size of the windows searched by -slice-by pushed or created: "+strings.Join(ghsearch.Granularities, ", ")+" (coarser saves queries on selective queries, as only windows over 1000 results are split, finer saves splitting every window of dense ones) or auto (sized by the density of the previous window, starting from a day)")
+	fs.StringVar(&granularity, "window", "day", "deprecated alias of -granularity")
+	fields := fs.String("fields", "", "comma-separated optional fields to output: languages (primary language and largest languages), license (SPDX identifier), topics (up to 20), flags (whether it is a fork, mirror, template, archived or disabled), owner (User or Organization, its database ID and whether an organization is verified)")
+	languages := fs.Int("languages", 10, "number of the largest languages to output with -fields languages")
+	concurrency := fs.Int("concurrency", 1, "number of fan-out searches to run in parallel, sharing the rate limits")
+	limit := fs.Int("limit", 0, "stop after this many repositories, ex: the top 100 (0 for no limit)")
+	perWindowLimit := fs.Int("per-window-limit", 0, "stop each window of -slice-by pushed or created after this many repositories, at most 1000, ex: the top 100 created each day with -slice-by created (0 for no limit)")
+	minStars := fs.Int("min-stars", 0, "exclude repositories with fewer stars than this")
+	languageFanOut := fs.String("language-fan-out", "", "comma-separated languages to partition batches stuck above 1000 results on a single value")
+	createdFanOut := fs.Bool("created-fan-out", false, "bisect batches stuck above 1000 results on a single value by creation time, down to the second (always done if no other fan-out is set)")
+	botThreshold := fs.Int("bot-threshold", 0, "add a suspected_bot column flagging groups of at least this many near-identical repos (0 to disable)")
+	filterSpam := fs.Bool("filter-spam", false, "drop zero-size, placeholder and bot-owner repositories")
+	spamDescriptions := fs.String("spam-descriptions", DefaultSpamDescriptions, "regexp of placeholder descriptions dropped by -filter-spam")
+	spamOwnerRepos := fs.Int("spam-owner-repos", 100, "drop repositories with -filter-spam whose owner was created the same day with at least this many repositories (0 to disable)")
+	nameRegex := fs.String("name-regex", "", "only keep repositories whose owner/name matches this regexp")
+	excludeNameRegex := fs.String("exclude-name-regex", "", "drop repositories whose owner/name matches this regexp")
+	descriptionContains := fs.String("description-contains", "", "only keep repositories whose description contains this text, ignoring case")
+	descriptionRegex := fs.String("description-regex", "", "only keep repositories whose description matches this regexp")
+	maxPerOwner := fs.Int("max-per-owner", 0, "keep at most this many of the highest-starred repositories from each owner (0 for no limit)")
+	ownersOutput := fs.String("owners-output", "", "write a leaderboard of owners by repositories and total stars to this CSV file")
+	pace := fs.Bool("pace", false, "space requests to use up the remaining rate limit exactly as it resets, going by the rate limit headers of each response, separately for each token of -token-file or GITHUB_TOKENS")
+	searchInterval := fs.Duration("search-interval", 0, "minimum time between search requests (0 for no limit), authenticated by GITHUB_TOKEN_SEARCH if set")
+	headroomInterval := fs.Duration("headroom-interval", 0, "log the remaining rate limit, time slept and projected exhaustion on this interval (0 to disable), separately for each token of -token-file or GITHUB_TOKENS")
+	checkpoint := fs.String("checkpoint", "", "save progress after each batch to this file and continue from it when re-run with the same command (append the output with >>, or use -output which continues its partial file)")
+	rateConfig := fs.String("rate-config", "", "file of family=interval lines, such as search=2s, overriding -search-interval, and concurrency=N overriding -concurrency, reloaded on SIGHUP")
+	start := fs.String("start", "", "only crawl repositories created at or after this date: 2006-01-02, RFC 3339, now, today, yesterday or an offset such as -30d, -12h, -2w, -3m or -1y")
+	end := fs.String("end", "", "only crawl repositories created before this date (exclusive, see -end-inclusive), in the same forms as -start, defaults to now minus -end-lag if -start is set")
+	endInclusive := fs.Bool("end-inclusive", false, "also crawl repositories created on -end, the whole day if it is a date or the second if it is a time")
+	endLag := fs.Duration("end-lag", 0, "with -start but no -end, stop this long before now, ex: 24h to skip repositories whose counts are still settling")
+	var ranges rangesFlag
+	fs.Var(&ranges, "range", "crawl repositories created in this range of start:end (or start..end for times), repeatable to fill several gaps in one run with one checkpoint, with dates as for -start and -end")
+	lastMonth := fs.Bool("last-month", false, "only crawl repositories created in the previous calendar month (UTC), instead of -start and -end")
+	progress := fs.Bool("progress", false, "draw a progress bar on stderr with the batches done, repositories found of the estimated total, request rate and time left")
+	runsDir := fs.String("runs-dir", "", "record each completed run in this directory, skipping a run identical to a completed one (same query, range, fields and filters) unless its range is open-ended or relative to now, such as without -end")
+	rerun := fs.Bool("rerun", false, "with -runs-dir, run even if an identical run has completed, only warning")
+	settle := fs.String("settle", "", "also re-crawl this long before -start, ex: 2d, catching repositories that search indexed late since the previous run (duplicates are upserted by -output-format sqlite)")
+	tokenFile := fs.String("token-file", "", "file of tokens, one per line, to rotate between as each exhausts its rate limit, instead of the comma-separated GITHUB_TOKENS")
+	resume := fs.Int("resume", 0, "resume a previous run from this value of the field")
+	enrichStages := fs.String("enrich", "", "comma-separated enrich stages to run on each repository as it is found, from "+strings.Join(GraphQLEnrichers, ", ")+", writing their CSV to -enrich-output, with the same token as the searches, which are scheduled first")
+	enrichOutput := fs.String("enrich-output", "", "with -enrich, write the enrich output to this CSV file, appended to when continuing from -checkpoint")
+	enrichJobs := fs.Int("enrich-jobs", 4, "with -enrich, number of repositories to enrich in parallel")
+	graphqlCeiling := fs.Int("graphql-ceiling", 0, "with -enrich, the most GraphQL points the searches and enrichment use in an hour, including those of other processes sharing the token (0 for the token's limit)")
+	searchReserve := fs.Int("search-reserve", 500, "with -enrich, the GraphQL points below -graphql-ceiling that enrichment leaves to the searches, so the crawl can complete in the same hour")
+	dryRun := fs.Bool("dry-run", false, "print the search query each range (or window of -slice-by pushed or created) starts with and the fewest requests the crawl makes, without sending any")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [crawl] [flags] (stars|forks|size) [query|@name]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s clone-list [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s clone [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s download-archives [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s readmes [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s languages [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s advisories [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s deps-dev [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s registries [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s citations [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s commit-activity [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s workflow-runs [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s enrich -stages (stage,...) [flags] (file.csv|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s refresh [flags] (file.csv|file.ndjson|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s merge [flags] (file.csv|file.ndjson)...\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s stats [flags] (file.csv|file.ndjson|-)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s self-update [flags]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s version\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s doctor [flags]\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s init\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s query lint [flags] (\"query\"|@name)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s query list\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := config.Apply(fs); err != nil {
+		log.Fatal(err)
+	}
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 && config.Field != "" {
+		args = []string{config.Field, config.Query}
+	}
+	var field, query string
+	switch len(args) {
+	case 2:
+		saved, err := config.ResolveQuery(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		query = saved + " "
+		fallthrough
+	case 1:
+		field = args[0]
+		switch field {
+		default:
+			log.Fatalf("Unsupported field: %q", field)
+		case "stars", "forks", "size":
+		}
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch *order {
+	default:
+		log.Fatalf("Unsupported order: %q", *order)
+	case "desc", "asc":
+	}
+	switch *sliceBy {
+	default:
+		log.Fatalf("Unsupported -slice-by: %q", *sliceBy)
+	case ghsearch.SliceStars:
+		if field != "stars" {
+			log.Fatalf("-slice-by %s requires the stars field", *sliceBy)
+		}
+	case ghsearch.SlicePushed, ghsearch.SliceCreated, "":
+	}
+	if !slices.Contains(ghsearch.Granularities, granularity) && granularity != ghsearch.GranularityAuto {
+		log.Fatalf("Unsupported -granularity: %q", granularity)
+	} else if granularity != "day" && *sliceBy != ghsearch.SlicePushed && *sliceBy != ghsearch.SliceCreated {
+		log.Fatalf("-granularity requires -slice-by %s or %s", ghsearch.SlicePushed, ghsearch.SliceCreated)
+	}
+	if *perWindowLimit < 0 || *perWindowLimit > 1000 {
+		log.Fatalf("-per-window-limit must be between 0 and 1000, the most a search returns")
+	} else if *perWindowLimit > 0 && *sliceBy != ghsearch.SlicePushed && *sliceBy != ghsearch.SliceCreated {
+		log.Fatalf("-per-window-limit requires -slice-by %s or %s", ghsearch.SlicePushed, ghsearch.SliceCreated)
+	} else if *perWindowLimit > 0 && granularity == ghsearch.GranularityAuto {
+		log.Fatalf("-per-window-limit requires a fixed -granularity, not %s", ghsearch.GranularityAuto)
+	}
+	var enrichNames []string
+	if *enrichStages != "" {
+		enrichNames = strings.Split(*enrichStages, ",")
+		for _, name := range enrichNames {
+			if !slices.Contains(GraphQLEnrichers, name) {
+				log.Fatalf("Unsupported -enrich stage: %q, a crawl only runs %s (run enrich on its output for the others)", name, strings.Join(GraphQLEnrichers, ", "))
+			}
+		}
+		if *enrichOutput == "" {
+			log.Fatal("-enrich requires -enrich-output")
+		} else if *enrichJobs < 1 {
+			log.Fatalf("Invalid -enrich-jobs: %d", *enrichJobs)
+		}
+	}
+	switch *outputFormat {
+	default:
+		log.Fatalf("Unsupported output format: %q", *outputFormat)
+	case "csv", "ndjson", "parquet", "sqlite":
+	}
+	// A sqlite:// output is the database itself rather than a file of -output-format
+	database, toDatabase := strings.CutPrefix(*outputPath, "sqlite://")
+	if toDatabase {
+		if *outputFormat != "csv" && *outputFormat != "sqlite" {
+			log.Fatalf("-output sqlite:// writes a SQLite database, not -output-format %s", *outputFormat)
+		} else if *rotateDaily || *compress != "" || *flushInterval > 0 || *bom {
+			log.Fatal("-output sqlite:// can't be combined with -rotate-daily, -compress, -flush-interval or -bom, which apply to files")
+		}
+		*outputFormat = "sqlite"
+	}
+	if (*header || *columns != "" || *safeCSV) && *outputFormat != "csv" {
+		log.Fatal("-header, -columns and -safe-csv only apply to -output-format csv")
+	}
+	var err error
+	var previous *PreviousOutput
+	if *update != "" {
+		if *outputPath != "" || *rotateDaily || *compress != "" || *columns != "" {
+			log.Fatal("-update can't be combined with -output, -rotate-daily, -compress or -columns, as it appends to the file in its columns")
+		} else if *start != "" || len(ranges) > 0 || *lastMonth {
+			log.Fatal("-update can't be combined with -start, -range or -last-month, as it starts from the latest repository of the file")
+		} else if *outputFormat != "csv" {
+			log.Fatal("-update only applies to -output-format csv")
+		}
+		if previous, err = ReadPreviousOutput(*update); err != nil {
+			log.Fatalf("Invalid -update: %v", err)
+		}
+	}
+	if *rotateDaily && *outputPath == "" {
+		log.Fatal("-rotate-daily requires -output")
+	}
+	if *parallelDays > 0 {
+		if !*rotateDaily {
+			log.Fatal("-parallel-days requires -rotate-daily, as each day is written to its own file")
+		} else if *sliceBy == ghsearch.SlicePushed {
+			log.Fatalf("-parallel-days can't be combined with -slice-by %s, as its days are of pushes rather than of the files", ghsearch.SlicePushed)
+		} else if *limit > 0 || *maxPerOwner > 0 || len(ranges) > 0 {
+			log.Fatal("-parallel-days can't be combined with -limit, -max-per-owner or -range, which span the whole crawl")
+		} else if *sinkQueue > 0 || *progress {
+			log.Fatal("-parallel-days can't be combined with -sink-queue or -progress")
+		} else if *outputFormat == "parquet" && *checkpoint != "" {
+			log.Fatal("-checkpoint can't be used with -output-format parquet, which can't be appended to")
+		}
+	}
+	switch *compress {
+	default:
+		log.Fatalf("Unsupported -compress: %q", *compress)
+	case "gzip", "zstd":
+		if *outputFormat == "parquet" {
+			log.Fatal("-compress can't be used with -output-format parquet")
+		}
+	case "":
+	}
+
+	build := ReadBuildInfo()
+	log.Printf("Running %s", build)
+	if *pprofAddr != "" {
+		ServePprof(*pprofAddr)
+	}
+
+	// Relative dates are resolved once, against the same time
+	var createdAfter, createdBefore time.Time
+	now := time.Now()
+	var createdRanges []ghsearch.CreatedRange
+	if len(ranges) > 0 {
+		if *start != "" || *end != "" || *lastMonth || *settle != "" {
+			log.Fatal("-range can't be combined with -start, -end, -last-month or -settle")
+		}
+		for _, s := range ranges {
+			r, err := ParseRange(s, now, *endInclusive, *endLag)
+			if err != nil {
+				log.Fatalf("Invalid -range: %v", err)
+			}
+			createdRanges = append(createdRanges, r)
+		}
+	}
+	if *lastMonth {
+		if *start != "" || *end != "" {
+			log.Fatal("-last-month can't be combined with -start or -end")
+		}
+		createdAfter, createdBefore = LastMonth(now)
+	}
+	if *start != "" {
+		if createdAfter, err = ParseDate(*start, now); err != nil {
+			log.Fatalf("Invalid -start: %v", err)
+		}
+	}
+	if previous != nil {
+		// The latest second may not have been complete, so it is crawled again and deduplicated
+		log.Printf("Updating %s of %d repositories, the latest created at %s", *update, previous.Rows, previous.Latest.Format(time.RFC3339))
+		createdAfter = previous.Latest
+	}
+	if *settle != "" {
+		if createdAfter.IsZero() {
+			log.Fatal("-settle requires -start, -last-month or -update")
+		}
+		span, err := ParseSpan(*settle)
+		if err != nil {
+			log.Fatalf("Invalid -settle: %v", err)
+		}
+		createdAfter = createdAfter.Add(-span)
+	}
+	if *end != "" {
+		if createdBefore, err = ParseDate(*end, now); err != nil {
+			log.Fatalf("Invalid -end: %v", err)
+		}
+		if *endInclusive {
+			createdBefore = InclusiveEnd(createdBefore)
+		}
+	} else if *start != "" || previous != nil {
+		// Fix the end when the crawl starts, rather than chasing repositories created during it
+		createdBefore = now.Add(-*endLag).UTC().Truncate(time.Second)
+	}
+	if *parallelDays > 0 && createdAfter.IsZero() {
+		log.Fatal("-parallel-days requires -start or -last-month, the first day to crawl")
+	}
+	// No repository predates GitHub, so searching before its launch would only waste queries
+	if !createdAfter.IsZero() && createdAfter.Before(ghsearch.GitHubLaunch) {
+		log.Printf("Starting from GitHub's launch on %s instead of %s", ghsearch.GitHubLaunch.Format(time.DateOnly), createdAfter.Format(time.RFC3339))
+		createdAfter = ghsearch.GitHubLaunch
+	}
+	if !createdBefore.IsZero() && !createdBefore.After(ghsearch.GitHubLaunch) {
+		log.Fatalf("-end %s is before GitHub's launch on %s", createdBefore.Format(time.RFC3339), ghsearch.GitHubLaunch.Format(time.DateOnly))
+	}
+	if !createdAfter.IsZero() || !createdBefore.IsZero() {
+		if !createdBefore.IsZero() && !createdBefore.After(createdAfter) {
+			log.Fatalf("-end %s is not after -start %s", createdBefore.Format(time.RFC3339), createdAfter.Format(time.RFC3339))
+		}
+		verb := "created"
+		if *sliceBy == ghsearch.SlicePushed {
+			verb = "pushed to"
+		}
+		log.Printf("Crawling repositories %s from %s (inclusive) until %s (exclusive)", verb, formatBound(createdAfter, "the start"), formatBound(createdBefore, "now"))
+	}
+
+	// Append any implicit qualifiers so the dataset definition is explicit
+	if *implicitQualifiers != "" {
+		qualifiers := strings.Join(strings.Split(*implicitQualifiers, ","), " ")
+		log.Printf("Using implicit qualifiers: %s", qualifiers)
+		query += qualifiers + " "
+	}
+
+	if *dryRun {
+		planned := &ghsearch.Crawler{
+			Field:         field,
+			Ascending:     *order == "asc",
+			SliceBy:       *sliceBy,
+			Window:        granularity,
+			Query:         query,
+			DoublePass:    *doublePass,
+			MinStars:      *minStars,
+			CreatedAfter:  createdAfter,
+			CreatedBefore: createdBefore,
+			Ranges:        createdRanges,
+			LastValue:     *resume,
+		}
+		queries, requests := planned.Plan()
+		for _, q := range queries {
+			fmt.Println(q)
+		}
+		log.Printf("Dry run: %d searches, at least %d requests (up to 10 for each 1000 repositories, more for any search over 1000)", len(queries), requests)
+		return
+	}
+
+	// Don't spend the quota on a dataset that already exists
+	run := RunRecord{Started: time.Now().UTC(), Build: build, Config: RunConfig{
+		Field:        field,
+		Order:        *order,
+		SliceBy:      *sliceBy,
+		Query:        query,
+		Start:        *start,
+		End:          *end,
+		EndInclusive: *endInclusive,
+		EndLag:       *endLag,
+		Ranges:       ranges,
+		Settle:       *settle,
+		Update:       *update,
+		OutputFormat: *outputFormat,
+		Fields:       *fields,
+		Columns:      *columns,
+		Languages:    *languages,
+		Limit:        *limit,
+		WindowLimit:  *perWindowLimit,
+		MinStars:     *minStars,
+		Filters:      make(map[string]string),
+	}}
+	for _, name := range []string{"name-regex", "exclude-name-regex", "description-contains", "description-regex", "filter-spam", "spam-descriptions", "spam-owner-repos", "max-per-owner", "bot-threshold"} {
+		run.Config.Filters[name] = fs.Lookup(name).Value.String()
+	}
+	if *perWindowLimit > 0 {
+		run.Config.Window = granularity
+	}
+	if *lastMonth {
+		run.Config.LastMonth = createdAfter.Format("2006-01")
+	}
+	run.Ranges = createdRanges
+	if len(createdRanges) == 0 {
+		run.Ranges = []ghsearch.CreatedRange{{After: createdAfter, Before: createdBefore}}
+	}
+	run.ID = run.Config.ID()
+	if *runsDir != "" {
+		previous, err := LoadRunRecord(*runsDir, run.ID)
+		if err != nil {
+			log.Fatalf("Failed to read previous runs: %v", err)
+		} else if previous != nil && !run.Config.Bounded() {
+			// An open-ended crawl finds whatever was created since, so it is never the same run
+			log.Printf("Running again as run %s is open-ended, last completed at %s", run.ID, previous.Completed.Format(time.RFC3339))
+		} else if previous != nil && !*rerun {
+			log.Printf("Skipping, identical run %s completed at %s (use -rerun to run it again)", run.ID, previous.Completed.Format(time.RFC3339))
+			return
+		} else if previous != nil {
+			log.Printf("Warning: identical run %s already completed at %s", run.ID, previous.Completed.Format(time.RFC3339))
+		}
+	}
+
+	// Record every API request that is actually sent
+	var transport http.RoundTripper = NewTransport(transportOpts)
+	accounting := &AccountingTransport{Base: transport}
+	logTraffic := sync.OnceFunc(func() {
+		log.Printf("API traffic: %s", accounting.Summary())
+	})
+	defer logTraffic()
+	fatalHooks = append(fatalHooks, logTraffic)
+	transport = accounting
+	// Spread the crawl over a pool of tokens, each with its own rate limit
+	token := Token("search")
+	var pool *TokenPool
+	tokens, err := LoadTokens(*tokenFile)
+	if err != nil {
+		fatalf("Failed to load tokens: %v", err)
+	} else if len(tokens) > 0 && enrichNames != nil {
+		fatal("-enrich can't be used with -token-file or GITHUB_TOKENS, as each token has its own GraphQL points")
+	} else if len(tokens) > 0 {
+		log.Printf("Rotating between %d tokens", len(tokens))
+		pool = NewTokenPool(transport, tokens)
+		defer func() {
+			log.Printf("Token pool: %s", pool.Status())
+		}()
+		transport, token = pool, tokens[0]
+	}
+	if *maxResponseSize > 0 || *maxInFlight > 0 {
+		transport = &LimitTransport{
+			Base:            transport,
+			MaxResponseSize: *maxResponseSize,
+			MaxInFlight:     *maxInFlight,
+		}
+	}
+	if *harFile != "" {
+		transport = NewHARTransport(transport, *harFile, *harLimit)
+	}
+	// Optionally audit and cap the API calls made with the token
+	if transport, err = api.Meter(transport); err != nil {
+		fatal(err)
+	}
+	defer api.Close()
+	// With -enrich the searches and enrichment share the GraphQL points of the token, searches first
+	var scheduler *Scheduler
+	metered := transport
+	if enrichNames != nil {
+		scheduler = &Scheduler{Ceiling: *graphqlCeiling, Reserve: *searchReserve}
+		transport = scheduler.Transport(transport, SearchPriority)
+	}
+	paced := func(base http.RoundTripper, name string) (http.RoundTripper, *Headroom) {
+		var headroom *Headroom
+		if *headroomInterval > 0 {
+			headroom = &Headroom{Name: name}
+			base = &HeadroomTransport{Base: base, Headroom: headroom}
+			go headroom.Log(ctx, *headroomInterval)
+		}
+		if *pace {
+			base = NewPaceTransport(base, headroom)
+		}
+		return base, headroom
+	}
+	var headroom *Headroom
+	if pool != nil {
+		// Each token of the pool has its own rate limit, so is tracked and paced on its own
+		pool.Wrap(func(i int, base http.RoundTripper) http.RoundTripper {
+			base, _ = paced(base, fmt.Sprintf("search token #%d", i+1))
+			return base
+		})
+	} else {
+		transport, headroom = paced(transport, "search")
+		if scheduler != nil {
+			scheduler.Headroom = headroom
+		}
+	}
+	// searches, if set, limits the searches in place of -concurrency so it can be changed by reloading the file
+	var searches *ghsearch.Limiter
+	if *rateConfig != "" {
+		// Always limit the rate so it can be changed by reloading the file
+		limiter := &RateTransport{Base: transport, Interval: *searchInterval, Headroom: headroom}
+		rates := &RateConfig{Path: *rateConfig, Transports: map[string]*RateTransport{"search": limiter}}
+		// The searches of every day crawled at once share the slots, which the concurrency is of each
+		searches = ghsearch.NewLimiter(*concurrency * max(*parallelDays, 1))
+		rates.Concurrency = func(n int) {
+			searches.SetLimit(n * max(*parallelDays, 1))
+		}
+		if err := rates.Reload(); err != nil {
+			fatal(err)
+		}
+		rates.ReloadOnSignal(ctx)
+		transport = limiter
+	} else {
+		transport = NewRateTransport(transport, *searchInterval, headroom)
+	}
+	transport = api.Retry(ctx, transport)
+	partial := &PartialTransport{Base: transport}
+	defer func() {
+		if skipped := partial.Skipped(); len(skipped) > 0 {
+			log.Printf("Skipped unresolvable repositories: %s", partial.Summary())
+		}
+	}()
+	transport = partial
+	client := NewClient(ctx, transport, GraphQLEndpoint(*graphqlURL, *githubURL), token)
+
+	// A crawl continuing from a checkpoint also continues its partial -output, each day's with -parallel-days
+	var cp *ghsearch.Checkpoint
+	if *checkpoint != "" && *parallelDays == 0 {
+		if cp, err = ghsearch.LoadCheckpoint(*checkpoint); err != nil {
+			fatal(err)
+		}
+	}
+
+	outputFields, err := ParseOutputFields(*fields)
+	if err != nil {
+		fatalf("Invalid -fields: %v", err)
+	}
+	outputFields.SuspectedBot = *botThreshold > 0
+	var outputColumns []string
+	if *columns != "" || previous != nil {
+		var needed OutputFields
+		if previous != nil {
+			if outputColumns, needed, err = ParseColumns(strings.Join(previous.Columns, ",")); err != nil {
+				fatalf("Invalid -update: %v", err)
+			} else if needed.SuspectedBot && *botThreshold == 0 {
+				fatal("-update of a file with a suspected_bot column requires -bot-threshold")
+			}
+		} else if outputColumns, needed, err = ParseColumns(*columns); err != nil {
+			fatalf("Invalid -columns: %v", err)
+		} else if needed.SuspectedBot && *botThreshold == 0 {
+			fatal("-columns suspected_bot requires -bot-threshold")
+		}
+		// Fetch whatever the columns need, even if not in -fields
+		outputFields.Languages = outputFields.Languages || needed.Languages
+		outputFields.License = outputFields.License || needed.License
+		outputFields.Topics = outputFields.Topics || needed.Topics
+		outputFields.Flags = outputFields.Flags || needed.Flags
+		outputFields.Owner = outputFields.Owner || needed.Owner
+	}
+	newOutput := func(w io.Writer, fresh bool) (*Output, error) {
+		// Optionally buffer the output between flushes
+		var buffer *IntervalWriter
+		if *flushInterval > 0 {
+			buffer = NewIntervalWriter(w, *flushInterval)
+			w = buffer
+		}
+		var compressor Compressor
+		if *compress != "" {
+			var err error
+			if compressor, err = NewCompressor(w, *compress); err != nil {
+				return nil, err
+			}
+			w = compressor
+		}
+		// Excel on Windows needs a BOM and CRLF to open the CSV correctly
+		if *bom && *outputFormat == "csv" && fresh {
+			if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+				return nil, err
+			}
+		}
+		output := NewOutput(w, *outputFormat, field, outputFields, *crlf)
+		output.Compressor = compressor
+		output.Buffer = buffer
+		output.SafeCSV = *safeCSV
+		output.MaxDescription = *maxDescription
+		if outputColumns != nil {
+			output.Columns = outputColumns
+		}
+		if *header && fresh {
+			if err := output.WriteHeader(); err != nil {
+				return nil, err
+			}
+		}
+		return output, nil
+	}
+	var rows RowWriter
+	var output *Output
+	var files *FileOutput
+	var db *SQLiteDatabase
+	if *update != "" {
+		// The rows are appended to a copy renamed over the file once complete, so an interrupted update
+		// doesn't leave the file with some of the new repositories and skip the rest when run again
+		if cp == nil {
+			if err := CopyFile(*update+".partial", *update); err != nil {
+				fatal(err)
+			}
+		}
+		files = &FileOutput{Path: *update, Append: true, New: func(f *AtomicFile) (*Output, error) {
+			return newOutput(f, f.Fresh)
+		}}
+		if err := files.Open(); err != nil {
+			fatal(err)
+		}
+		rows = files
+	} else if toDatabase {
+		if db, err = OpenSQLiteDatabase(database, outputFields); err != nil {
+			fatal(err)
+		}
+		rows = db
+	} else if *outputPath != "" {
+		files = &FileOutput{Path: *outputPath, Daily: *rotateDaily, Append: cp != nil || *parallelDays > 0, New: func(f *AtomicFile) (*Output, error) {
+			return newOutput(f, f.Fresh)
+		}}
+		if err := files.Open(); err != nil {
+			fatal(err)
+		}
+		rows = files
+	} else {
+		if output, err = newOutput(os.Stdout, true); err != nil {
+			fatal(err)
+		}
+		rows = output
+	}
+	var queue *RowQueue
+	if *sinkQueue > 0 {
+		queue = NewRowQueue(rows, *sinkQueue)
+		defer func() {
+			log.Printf("Sink queue: %s", queue.Summary())
+		}()
+		rows = queue
+	}
+	// finish ends the output, renaming any files into place if the crawl is complete
+	finish := func(complete bool) error {
+		if queue != nil {
+			if err := queue.Close(); err != nil {
+				return err
+			}
+		}
+		if db != nil {
+			// Upserted rows are kept even if incomplete, the next run merges with them
+			if err := db.Close(); err != nil {
+				return err
+			}
+			log.Printf("Wrote to %s", database)
+			return nil
+		} else if files == nil {
+			return output.Close()
+		}
+		paths, err := files.Close(complete)
+		if complete && len(paths) > 0 {
+			log.Printf("Wrote %s", strings.Join(paths, ", "))
+		} else if len(paths) > 0 {
+			log.Printf("Left the incomplete output in %s.partial, continued by re-running with -checkpoint", strings.Join(paths, ".partial, "))
+		}
+		return err
+	}
+
+	crawler := &ghsearch.Crawler{
+		Client:        client,
+		Field:         field,
+		Ascending:     *order == "asc",
+		SliceBy:       *sliceBy,
+		Window:        granularity,
+		Query:         query,
+		DoublePass:    *doublePass,
+		SortFanOut:    *sortFanOut,
+		MinStars:      *minStars,
+		CreatedFanOut: *createdFanOut,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		Ranges:        createdRanges,
+		BotThreshold:  *botThreshold,
+		Concurrency:   *concurrency,
+		Limiter:       searches,
+		Limit:         *limit,
+		WindowLimit:   *perWindowLimit,
+		LastValue:     *resume,
+		Emit:          rows.Write,
+	}
+	// A response too large to read loses its batch rather than the rest of the crawl
+	var oversized atomic.Int64
+	crawler.Skip = func(err error) bool {
+		if errors.Is(err, ErrResponseTooLarge) || errors.Is(err, ErrMemoryLimit) {
+			oversized.Add(1)
+			return true
+		}
+		return false
+	}
+	// Enrich each repository written, with the GraphQL requests the searches leave room for
+	var enricher *CrawlEnricher
+	if enrichNames != nil {
+		transport := &PartialTransport{Base: api.Retry(ctx, scheduler.Transport(metered, EnrichPriority))}
+		env := EnrichEnv{GraphQL: NewClient(ctx, transport, GraphQLEndpoint(*graphqlURL, *githubURL), token)}
+		stages := make([]Enricher, len(enrichNames))
+		for i, name := range enrichNames {
+			stages[i] = Enrichers[name](env)
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if cp != nil {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(*enrichOutput, flags, 0644)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		enricher = NewCrawlEnricher(ctx, f, enrichNames, stages, *enrichJobs, cp == nil, 0)
+		next := crawler.Emit
+		crawler.Emit = func(row ghsearch.Row) error {
+			if err := next(row); err != nil {
+				return err
+			}
+			enricher.Add(row.Repository)
+			return nil
+		}
+	}
+	if outputFields.Languages {
+		crawler.Languages = *languages
+	}
+	crawler.Topics = outputFields.Topics
+	crawler.Flags, crawler.Owner = outputFields.Flags, outputFields.Owner
+	if *languageFanOut != "" {
+		crawler.FanOutLanguages = strings.Split(*languageFanOut, ",")
+	}
+	if *nameRegex != "" {
+		re, err := regexp.Compile(*nameRegex)
+		if err != nil {
+			fatalf("Invalid -name-regex: %v", err)
+		}
+		crawler.Filters = append(crawler.Filters, MatchName(re))
+	}
+	if *excludeNameRegex != "" {
+		re, err := regexp.Compile(*excludeNameRegex)
+		if err != nil {
+			fatalf("Invalid -exclude-name-regex: %v", err)
+		}
+		crawler.Filters = append(crawler.Filters, ExcludeName(re))
+	}
+	if previous != nil {
+		crawler.Filters = append(crawler.Filters, previous.Unseen)
+	}
+	if *descriptionContains != "" {
+		crawler.Filters = append(crawler.Filters, DescriptionContains(*descriptionContains))
+	}
+	if *descriptionRegex != "" {
+		re, err := regexp.Compile(*descriptionRegex)
+		if err != nil {
+			fatalf("Invalid -description-regex: %v", err)
+		}
+		crawler.Filters = append(crawler.Filters, MatchDescription(re))
+	}
+	var spam *SpamFilter
+	if *filterSpam {
+		spam = &SpamFilter{OwnerRepos: *spamOwnerRepos}
+		// Only the owner heuristic needs the history of each owner
+		crawler.OwnerHistory = *spamOwnerRepos > 0
+		if *spamDescriptions != "" {
+			re, err := regexp.Compile(*spamDescriptions)
+			if err != nil {
+				fatalf("Invalid -spam-descriptions: %v", err)
+			}
+			spam.Descriptions = re
+		}
+		crawler.Filters = append(crawler.Filters, spam.Keep)
+		defer func() {
+			log.Printf("Dropped spam repositories: %s", spam.Summary())
+		}()
+	}
+	// Count the rows actually written towards the owners leaderboard
+	if *ownersOutput != "" {
+		stats := NewOwnerStats()
+		next := crawler.Emit
+		crawler.Emit = func(row ghsearch.Row) error {
+			stats.Add(row.Repository)
+			return next(row)
+		}
+		defer func() {
+			f, err := os.Create(*ownersOutput)
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			if err := stats.WriteCSV(f); err != nil {
+				fatal(err)
+			}
+		}()
+	}
+	// A descending stars crawl finds the highest-starred repos of each owner first,
+	// otherwise every row has to be buffered until the crawl is complete
+	var buffered []ghsearch.Row
+	emit := crawler.Emit
+	if *maxPerOwner > 0 {
+		if field == "stars" && !crawler.Ascending {
+			crawler.Filters = append(crawler.Filters, OwnerCap(*maxPerOwner))
+		} else {
+			crawler.Emit = func(row ghsearch.Row) error {
+				buffered = append(buffered, row)
+				return nil
+			}
+		}
+	}
+	// Continue where a previous run of the same crawl left off
+	if *checkpoint != "" {
+		if *maxPerOwner > 0 {
+			fatal("-checkpoint can't be used with -max-per-owner, which needs the whole crawl")
+		} else if *outputFormat == "parquet" {
+			fatal("-checkpoint can't be used with -output-format parquet, which can't be appended to")
+		}
+		if cp != nil {
+			if err := crawler.Restore(cp); err != nil {
+				fatal(err)
+			}
+			if len(createdRanges) == 0 && (!cp.CreatedAfter.Equal(createdAfter) || !cp.CreatedBefore.Equal(createdBefore)) {
+				log.Printf("Keeping the checkpoint's created range, %s until %s", formatBound(cp.CreatedAfter, "the start"), formatBound(cp.CreatedBefore, "now"))
+			}
+			log.Printf("Continuing from checkpoint at %s %d", field, cp.LastValue)
+		}
+		crawler.Completed = func() error {
+			// The rows must be written before the checkpoint skips past them
+			if err := rows.Commit(); err != nil {
+				return err
+			}
+			return crawler.SaveCheckpoint(*checkpoint)
+		}
+	}
+	var bar *ProgressBar
+	if *progress {
+		bar = NewProgressBar(os.Stderr, time.Second, crawler.Progress(), accounting.Requests)
+		crawler.OnBatch = bar.Update
+		log.SetOutput(bar)
+	}
+	hint := fmt.Sprintf("continue with -resume %d", crawler.LastValue)
+	if *parallelDays > 0 {
+		days := Days(createdAfter, createdBefore)
+		log.Printf("Crawling %d days, %d at a time", len(days), *parallelDays)
+		dc := &DayCrawl{Crawler: crawler, Files: files, Checkpoint: *checkpoint, Jobs: *parallelDays}
+		err = dc.Run(ctx, days)
+		hint = "continue the unfinished days by running it again"
+		if *checkpoint == "" {
+			hint += " (from their start, without -checkpoint)"
+		}
+	} else {
+		err = crawler.Run(ctx)
+	}
+	if bar != nil {
+		bar.Finish()
+		log.SetOutput(os.Stderr)
+	}
+	if errors.Is(err, ErrBudgetExhausted) {
+		log.Printf("Stopping after %d API calls, %s", *api.MaxAPICalls, hint)
+	} else if errors.Is(err, context.Canceled) {
+		log.Printf("Stopping: %v, %s", err, hint)
+	} else if err != nil {
+		finish(false)
+		fatal(err)
+	}
+	if n := oversized.Load(); n > 0 {
+		log.Printf("Skipped %d batches over -max-response-size or -max-in-flight, their repositories are missing", n)
+	}
+	if err == nil && *checkpoint != "" {
+		// The crawl is complete, so running it again starts over
+		if err := ghsearch.RemoveCheckpoint(*checkpoint); err != nil {
+			fatal(err)
+		}
+	}
+	if buffered != nil {
+		for _, row := range TopPerOwner(buffered, *maxPerOwner) {
+			if err := emit(row); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	if enricher != nil {
+		left, err := enricher.Close()
+		if err != nil {
+			fatalf("Failed to write -enrich-output: %v", err)
+		} else if left > 0 {
+			log.Printf("Stopped with %d repositories left to enrich", left)
+		}
+	}
+	complete := err == nil
+	if err := finish(complete); err != nil {
+		fatal(err)
+	}
+	// A run missing skipped batches is worth running again
+	if complete && *runsDir != "" && oversized.Load() == 0 {
+		run.Completed = time.Now().UTC()
+		run.Skipped = partial.Skipped()
+		if err := run.Save(*runsDir); err != nil {
+			fatalf("Failed to record the run: %v", err)
+		}
+		log.Printf("Recorded run %s", run.ID)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Merger deduplicates the rows of several CSV or NDJSON outputs by the database ID of each repository, or its
+// owner/name in outputs without one, keeping the position of its first row and the values of its first or last.
+// A repository whose owner/name changed between the outputs, as it was renamed or transferred, is kept once and
+// recorded in Renames.
+type Merger struct {
+	// KeepLast keeps the last row of each repository rather than the first, such as the most recent of dated outputs.
+	KeepLast bool
+	// Renames are the repositories found under another owner/name than in an earlier output, in the order found.
+	Renames []Rename
+
+	json   bool
+	header []string
+	// csv rows are records and json rows are lines
+	rows  [][]string
+	lines [][]byte
+	// names and ids are the owner/name and database ID, 0 if unknown, of each row
+	names []string
+	ids   []int
+	index map[string]int
+	byID  map[int]int
+	read  int
+	files int
+	path  string
+}
+
+// Rename is a repository found under a new owner/name by Merger.
+type Rename struct {
+	DatabaseID int
+	From, To   string
+	// Path is the output it was first found under To in.
+	Path string
+}
+
+// Repositories returns how many unique repositories were merged.
+func (m *Merger) Repositories() int {
+	return len(m.names)
+}
+
+// add counts a row of nameWithOwner and databaseID, 0 if unknown, returning its index in rows or lines, past the
+// end if it is new, or -1 to drop it.
+func (m *Merger) add(nameWithOwner string, databaseID int) int {
+	m.read++
+	if m.index == nil {
+		m.index, m.byID = make(map[string]int), make(map[int]int)
+	}
+	i, ok := m.byID[databaseID]
+	if !ok {
+		// Without an ID to tell them apart, a repository is the one last known by the name, unless both have
+		// IDs that differ, such as a name taken by a new repository after the old one was renamed
+		if i, ok = m.index[nameWithOwner]; ok && databaseID != 0 && m.ids[i] != 0 && m.ids[i] != databaseID {
+			ok = false
+		}
+	}
+	if !ok {
+		i = len(m.names)
+		m.names, m.ids = append(m.names, nameWithOwner), append(m.ids, databaseID)
+		m.index[nameWithOwner] = i
+		if databaseID != 0 {
+			m.byID[databaseID] = i
+		}
+		return i
+	}
+	if databaseID != 0 && m.ids[i] == 0 {
+		m.ids[i], m.byID[databaseID] = databaseID, i
+	}
+	if m.names[i] != nameWithOwner {
+		m.Renames = append(m.Renames, Rename{DatabaseID: m.ids[i], From: m.names[i], To: nameWithOwner, Path: m.path})
+		m.names[i] = nameWithOwner
+		m.index[nameWithOwner] = i
+	}
+	if m.KeepLast {
+		return i
+	}
+	return -1
+}
+
+// WriteRenames writes the Renames to w as CSV.
+func (m *Merger) WriteRenames(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"database_id", "from", "to", "path"})
+	for _, r := range m.Renames {
+		cw.Write([]string{strconv.Itoa(r.DatabaseID), r.From, r.To, r.Path})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Add reads the rows of the output at path, which must be of the same format, and columns if CSV, as the others.
+func (m *Merger) Add(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer func() { m.files++ }()
+	m.path = path
+	br := bufio.NewReader(f)
+	b, _ := br.Peek(1)
+	isJSON := len(b) == 1 && b[0] == '{'
+	if m.files > 0 && isJSON != m.json {
+		return fmt.Errorf("%s: can't merge CSV and NDJSON outputs", path)
+	}
+	m.json = isJSON
+	if isJSON {
+		return m.addJSON(path, br)
+	}
+	return m.addCSV(path, br)
+}
+
+// addJSON reads the lines of NDJSON output.
+func (m *Merger) addJSON(path string, r *bufio.Reader) error {
+	scanner := bufio.NewScanner(r)
+	// A line is a single row, but may have long descriptions and topics
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row JSONRow
+		if err := json.Unmarshal(line, &row); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		line = bytes.Clone(line)
+		if i := m.add(row.NameWithOwner, row.DatabaseID); i == len(m.lines) {
+			m.lines = append(m.lines, line)
+		} else if i >= 0 {
+			m.lines[i] = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// addCSV reads the records of CSV output, with or without a header row.
+func (m *Merger) addCSV(path string, r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	nameWithOwner := func(record []string) string { return record[0] }
+	databaseID := func(record []string) int { return 0 }
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if first {
+			// Tolerate output written with -bom
+			record[0] = strings.TrimPrefix(record[0], "\uFEFF")
+			fn, isHeader := csvNameWithOwner(record)
+			if m.files > 0 && !slices.Equal(record, m.header) && (isHeader || m.header != nil) {
+				return fmt.Errorf("%s: the columns differ from the previous files", path)
+			}
+			if isHeader {
+				m.header, nameWithOwner = record, fn
+				if j := slices.Index(record, "database_id"); j >= 0 {
+					databaseID = func(record []string) int {
+						id, _ := strconv.Atoi(record[j])
+						return id
+					}
+				}
+				continue
+			}
+		}
+		if i := m.add(nameWithOwner(record), databaseID(record)); i == len(m.rows) {
+			m.rows = append(m.rows, record)
+		} else if i >= 0 {
+			m.rows[i] = record
+		}
+	}
+}
+
+// Write writes the merged rows to w, after any CSV header.
+func (m *Merger) Write(w io.Writer) error {
+	if m.json {
+		bw := bufio.NewWriter(w)
+		for _, line := range m.lines {
+			bw.Write(line)
+			bw.WriteByte('\n')
+		}
+		return bw.Flush()
+	}
+	cw := csv.NewWriter(w)
+	if m.header != nil {
+		cw.Write(m.header)
+	}
+	// WriteAll flushes
+	return cw.WriteAll(m.rows)
+}
+
+// mergeMain implements the merge subcommand.
+func mergeMain(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	keep := fs.String("keep", "last", "which row of a repository in several files to keep, first or last (such as the most recent of files in date order)")
+	renames := fs.String("renames", "", "write the repositories renamed between the files, matched by their database_id, as CSV to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [flags] (file.csv|file.ndjson)...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	m := &Merger{}
+	switch *keep {
+	default:
+		log.Fatalf("Unsupported -keep: %q", *keep)
+	case "first":
+	case "last":
+		m.KeepLast = true
+	}
+	for _, path := range fs.Args() {
+		if err := m.Add(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := m.Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if *renames != "" {
+		f, err := os.Create(*renames)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := m.WriteRenames(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Merged %d rows of %d files into %d repositories, %d renamed", m.read, fs.NArg(), m.Repositories(), len(m.Renames))
+}
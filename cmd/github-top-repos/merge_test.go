@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergeFiles merges files of the given contents, written in order, returning the merged output.
+func mergeFiles(t *testing.T, m *Merger, contents ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for i, content := range contents {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Add(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestMerger(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		keepLast bool
+		files    []string
+		want     string
+		// renames are the renames found as from>to
+		renames []string
+	}{
+		{
+			name:     "by name",
+			keepLast: true,
+			files:    []string{"a/x,1\nb/y,2\n", "b/y,3\nc/z,4\n"},
+			want:     "a/x,1\nb/y,3\nc/z,4\n",
+		},
+		{
+			name:  "by name keeping the first",
+			files: []string{"a/x,1\nb/y,2\n", "b/y,3\nc/z,4\n"},
+			want:  "a/x,1\nb/y,2\nc/z,4\n",
+		},
+		{
+			name:     "renamed",
+			keepLast: true,
+			files: []string{
+				"name_with_owner,database_id,stars\na/x,1,10\nb/y,2,20\n",
+				"name_with_owner,database_id,stars\nb/y,2,21\nnew-owner/x,1,11\n",
+			},
+			want:    "name_with_owner,database_id,stars\nnew-owner/x,1,11\nb/y,2,21\n",
+			renames: []string{"a/x>new-owner/x"},
+		},
+		{
+			name: "renamed keeping the first",
+			files: []string{
+				"name_with_owner,database_id,stars\na/x,1,10\n",
+				"name_with_owner,database_id,stars\na/renamed,1,11\n",
+				"name_with_owner,database_id,stars\na/renamed-again,1,12\n",
+			},
+			want:    "name_with_owner,database_id,stars\na/x,1,10\n",
+			renames: []string{"a/x>a/renamed", "a/renamed>a/renamed-again"},
+		},
+		{
+			name:     "name taken by another repository",
+			keepLast: true,
+			files: []string{
+				"name_with_owner,database_id\na/x,1\n",
+				"name_with_owner,database_id\na/y,1\na/x,2\n",
+			},
+			want:    "name_with_owner,database_id\na/y,1\na/x,2\n",
+			renames: []string{"a/x>a/y"},
+		},
+		{
+			name:     "renamed ndjson",
+			keepLast: true,
+			files: []string{
+				`{"name_with_owner":"a/x","database_id":1,"stars":10}` + "\n" + `{"name_with_owner":"b/y","stars":20}` + "\n",
+				`{"name_with_owner":"a/z","database_id":1,"stars":11}` + "\n" + `{"name_with_owner":"b/y","database_id":2,"stars":21}` + "\n",
+			},
+			want:    `{"name_with_owner":"a/z","database_id":1,"stars":11}` + "\n" + `{"name_with_owner":"b/y","database_id":2,"stars":21}` + "\n",
+			renames: []string{"a/x>a/z"},
+		},
+		{
+			name:     "older ndjson without IDs",
+			keepLast: true,
+			files: []string{
+				`{"name_with_owner":"a/x","stars":10}` + "\n",
+				`{"name_with_owner":"a/x","database_id":1,"stars":11}` + "\n",
+				`{"name_with_owner":"a/z","database_id":1,"stars":12}` + "\n",
+			},
+			want:    `{"name_with_owner":"a/z","database_id":1,"stars":12}` + "\n",
+			renames: []string{"a/x>a/z"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Merger{KeepLast: tt.keepLast}
+			if got := mergeFiles(t, m, tt.files...); got != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", got, tt.want)
+			}
+			var renames []string
+			for _, r := range m.Renames {
+				renames = append(renames, r.From+">"+r.To)
+			}
+			if !reflect.DeepEqual(renames, tt.renames) {
+				t.Errorf("renames %q, want %q", renames, tt.renames)
+			}
+		})
+	}
+}
+
+func TestMergerWriteRenames(t *testing.T) {
+	m := &Merger{KeepLast: true}
+	mergeFiles(t, m, "name_with_owner,database_id\na/x,1\n", "name_with_owner,database_id\n\"b/x,\",1\n")
+	var buf bytes.Buffer
+	if err := m.WriteRenames(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "database_id,from,to,path\n1,a/x,\"b/x,\"," + m.Renames[0].Path + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("renames:\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.HasSuffix(m.Renames[0].Path, "b") {
+		t.Errorf("renamed in %s, want the second file", m.Renames[0].Path)
+	}
+}
+
+func TestMergerMixedFormats(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, jsonPath := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.ndjson")
+	os.WriteFile(csvPath, []byte("a/x,1\n"), 0644)
+	os.WriteFile(jsonPath, []byte(`{"name_with_owner":"a/x"}`+"\n"), 0644)
+	m := &Merger{}
+	if err := m.Add(csvPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(jsonPath); err == nil {
+		t.Error("merged CSV with NDJSON")
+	}
+}
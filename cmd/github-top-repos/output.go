@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/klauspost/compress/zstd"
+)
+
+// IntervalWriter buffers writes and flushes them to the underlying writer on a fixed interval.
+type IntervalWriter struct {
+	mu   sync.Mutex
+	buf  *bufio.Writer
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewIntervalWriter flushes writes to w every interval until closed.
+func NewIntervalWriter(w io.Writer, interval time.Duration) *IntervalWriter {
+	iw := &IntervalWriter{
+		buf:  bufio.NewWriter(w),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(iw.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				iw.Flush()
+			case <-iw.stop:
+				return
+			}
+		}
+	}()
+	return iw
+}
+
+// Write implements io.Writer, returning any error from a previous background flush.
+func (iw *IntervalWriter) Write(p []byte) (int, error) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.err != nil {
+		return 0, iw.err
+	}
+	return iw.buf.Write(p)
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (iw *IntervalWriter) Flush() error {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.err == nil {
+		iw.err = iw.buf.Flush()
+	}
+	return iw.err
+}
+
+// Close stops the background flushing and flushes any remaining data.
+func (iw *IntervalWriter) Close() error {
+	close(iw.stop)
+	<-iw.done
+	return iw.Flush()
+}
+
+// OutputFields are the optional fields of each row in the output.
+type OutputFields struct {
+	// SuspectedBot is whether the repository appears to be part of a bot wave, set by -bot-threshold.
+	SuspectedBot bool
+	// Languages are the primary language and the largest languages by size.
+	Languages bool
+	// License is the SPDX identifier of the detected license.
+	License bool
+	// Topics are the first 20 topics of the repository.
+	Topics bool
+	// Flags are whether the repository is a fork, mirror or template and whether it is archived or disabled.
+	Flags bool
+	// Owner is the type (User or Organization) and database ID of the owner, and whether an organization is verified.
+	Owner bool
+}
+
+// ParseOutputFields parses a comma-separated list of optional field names.
+func ParseOutputFields(s string) (OutputFields, error) {
+	var fields OutputFields
+	if s == "" {
+		return fields, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		switch name {
+		case "languages":
+			fields.Languages = true
+		case "license":
+			fields.License = true
+		case "topics":
+			fields.Topics = true
+		case "flags":
+			fields.Flags = true
+		case "owner":
+			fields.Owner = true
+		default:
+			return fields, fmt.Errorf("unknown field %q", name)
+		}
+	}
+	return fields, nil
+}
+
+// topicNames returns the topics of repo.
+func topicNames(repo ghsearch.Repository) []string {
+	names := make([]string, 0, len(repo.RepositoryTopics.Nodes))
+	for _, node := range repo.RepositoryTopics.Nodes {
+		names = append(names, node.Topic.Name)
+	}
+	return names
+}
+
+// CSVColumns are the columns of the CSV output by name, each appending its value for a row to dst
+// so a row is encoded into one reused buffer without allocating.
+var CSVColumns = map[string]func(dst []byte, row ghsearch.Row) []byte{
+	"name_with_owner": func(dst []byte, row ghsearch.Row) []byte { return append(dst, row.NameWithOwner...) },
+	"owner": func(dst []byte, row ghsearch.Row) []byte {
+		owner, _, _ := strings.Cut(row.NameWithOwner, "/")
+		return append(dst, owner...)
+	},
+	"name": func(dst []byte, row ghsearch.Row) []byte {
+		_, name, _ := strings.Cut(row.NameWithOwner, "/")
+		return append(dst, name...)
+	},
+	"database_id": func(dst []byte, row ghsearch.Row) []byte { return AppendInt(dst, row.DatabaseId) },
+	"stars":       func(dst []byte, row ghsearch.Row) []byte { return AppendInt(dst, row.StargazerCount) },
+	"forks":       func(dst []byte, row ghsearch.Row) []byte { return AppendInt(dst, row.ForkCount) },
+	"size":        func(dst []byte, row ghsearch.Row) []byte { return AppendInt(dst, row.DiskUsage) },
+	"description": func(dst []byte, row ghsearch.Row) []byte { return append(dst, row.Description...) },
+	"created_at": func(dst []byte, row ghsearch.Row) []byte {
+		if !row.HasCreatedAt() {
+			return dst
+		}
+		return AppendTime(dst, row.CreatedAt)
+	},
+	"suspected_bot":    func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.SuspectedBot) },
+	"primary_language": func(dst []byte, row ghsearch.Row) []byte { return append(dst, row.PrimaryLanguage.Name...) },
+	"languages":        func(dst []byte, row ghsearch.Row) []byte { return AppendLanguages(dst, row.Languages.Edges) },
+	"license":          func(dst []byte, row ghsearch.Row) []byte { return append(dst, row.LicenseInfo.SpdxId...) },
+	"topics": func(dst []byte, row ghsearch.Row) []byte {
+		// The same as joining the topicNames with ;
+		for i, node := range row.RepositoryTopics.Nodes {
+			if i > 0 {
+				dst = append(dst, ';')
+			}
+			dst = append(dst, node.Topic.Name...)
+		}
+		return dst
+	},
+	"is_fork":     func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.IsFork) },
+	"is_mirror":   func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.IsMirror) },
+	"is_template": func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.IsTemplate) },
+	"is_archived": func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.IsArchived) },
+	"is_disabled": func(dst []byte, row ghsearch.Row) []byte { return AppendBool(dst, row.IsDisabled) },
+	"owner_type":  func(dst []byte, row ghsearch.Row) []byte { return append(dst, row.Owner.Typename...) },
+	"owner_id":    func(dst []byte, row ghsearch.Row) []byte { return AppendInt(dst, row.OwnerDatabaseId()) },
+	// Only organizations can be verified, so it is empty for users
+	"owner_verified": func(dst []byte, row ghsearch.Row) []byte {
+		if row.Owner.Typename != "Organization" {
+			return dst
+		}
+		return AppendBool(dst, row.Owner.Organization.IsVerified)
+	},
+}
+
+// DefaultColumns returns the CSV columns unless chosen: the owner/name, the value of field, then any optional fields.
+func DefaultColumns(field string, fields OutputFields) []string {
+	columns := []string{"name_with_owner", field}
+	if fields.SuspectedBot {
+		columns = append(columns, "suspected_bot")
+	}
+	if fields.Languages {
+		columns = append(columns, "primary_language", "languages")
+	}
+	if fields.License {
+		columns = append(columns, "license")
+	}
+	if fields.Topics {
+		columns = append(columns, "topics")
+	}
+	if fields.Flags {
+		columns = append(columns, "is_fork", "is_mirror", "is_template", "is_archived", "is_disabled")
+	}
+	if fields.Owner {
+		columns = append(columns, "owner_type", "owner_id", "owner_verified")
+	}
+	return columns
+}
+
+// ParseColumns parses a comma-separated list of CSVColumns, also returning the optional fields they need fetched.
+func ParseColumns(s string) ([]string, OutputFields, error) {
+	var fields OutputFields
+	columns := strings.Split(s, ",")
+	for _, column := range columns {
+		if _, ok := CSVColumns[column]; !ok {
+			return nil, fields, fmt.Errorf("unknown column %q", column)
+		}
+		switch column {
+		case "suspected_bot":
+			fields.SuspectedBot = true
+		case "primary_language", "languages":
+			fields.Languages = true
+		case "license":
+			fields.License = true
+		case "topics":
+			fields.Topics = true
+		case "is_fork", "is_mirror", "is_template", "is_archived", "is_disabled":
+			fields.Flags = true
+		case "owner_type", "owner_id", "owner_verified":
+			fields.Owner = true
+		}
+	}
+	return columns, fields, nil
+}
+
+// TruncateText shortens s to at most n characters, ending it with … if it is cut, or leaves it as is if n is 0.
+func TruncateText(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// SafeCSVValue neutralizes a value that a spreadsheet would evaluate as a formula, one starting with =, +, -, @,
+// a tab or carriage return, or their fullwidth forms which Excel also accepts, by prefixing it with a quote.
+// https://owasp.org/www-community/attacks/CSV_Injection
+func SafeCSVValue(s string) string {
+	if r, _ := utf8.DecodeRuneInString(s); isFormulaStart(r) {
+		return "'" + s
+	}
+	return s
+}
+
+// appendSafeCSV prefixes value, which has spare capacity if it was appended to, as SafeCSVValue does.
+func appendSafeCSV(value []byte) []byte {
+	if r, _ := utf8.DecodeRune(value); !isFormulaStart(r) {
+		return value
+	}
+	value = append(value, 0)
+	copy(value[1:], value)
+	value[0] = '\''
+	return value
+}
+
+// isFormulaStart reports whether a value starting with r would be evaluated as a formula.
+func isFormulaStart(r rune) bool {
+	switch r {
+	case '=', '+', '-', '@', '\t', '\r', '\uFF1D', '\uFF0B', '\uFF0D', '\uFF20':
+		return true
+	}
+	return false
+}
+
+// JSONLanguage is the size of a language in a repository.
+type JSONLanguage struct {
+	Name  string `json:"name"`
+	Bytes int    `json:"bytes"`
+}
+
+// JSONRow is a single line of the ndjson output format.
+type JSONRow struct {
+	NameWithOwner   string         `json:"name_with_owner"`
+	DatabaseID      int            `json:"database_id,omitempty"`
+	Stars           *int           `json:"stars,omitempty"`
+	Forks           *int           `json:"forks,omitempty"`
+	Size            *int           `json:"size,omitempty"`
+	SuspectedBot    *bool          `json:"suspected_bot,omitempty"`
+	PrimaryLanguage *string        `json:"primary_language,omitempty"`
+	Languages       []JSONLanguage `json:"languages,omitempty"`
+	License         *string        `json:"license,omitempty"`
+	Topics          []string       `json:"topics,omitempty"`
+	IsFork          *bool          `json:"is_fork,omitempty"`
+	IsMirror        *bool          `json:"is_mirror,omitempty"`
+	IsTemplate      *bool          `json:"is_template,omitempty"`
+	IsArchived      *bool          `json:"is_archived,omitempty"`
+	IsDisabled      *bool          `json:"is_disabled,omitempty"`
+	OwnerType       string         `json:"owner_type,omitempty"`
+	OwnerID         *int           `json:"owner_id,omitempty"`
+	// OwnerVerified is only set for organizations.
+	OwnerVerified *bool `json:"owner_verified,omitempty"`
+}
+
+// NewJSONRow returns the columns of the CSV output for row as named fields.
+func NewJSONRow(row ghsearch.Row, field string, fields OutputFields) JSONRow {
+	out := JSONRow{NameWithOwner: row.NameWithOwner, DatabaseID: row.DatabaseId}
+	value := row.Value(field)
+	switch field {
+	case "stars":
+		out.Stars = &value
+	case "forks":
+		out.Forks = &value
+	case "size":
+		out.Size = &value
+	}
+	if fields.SuspectedBot {
+		out.SuspectedBot = &row.SuspectedBot
+	}
+	if fields.Languages {
+		out.PrimaryLanguage = &row.PrimaryLanguage.Name
+		for _, edge := range row.Languages.Edges {
+			out.Languages = append(out.Languages, JSONLanguage{Name: edge.Node.Name, Bytes: edge.Size})
+		}
+	}
+	if fields.License {
+		out.License = &row.LicenseInfo.SpdxId
+	}
+	if fields.Topics {
+		out.Topics = topicNames(row.Repository)
+	}
+	if fields.Flags {
+		out.IsFork, out.IsMirror, out.IsTemplate = &row.IsFork, &row.IsMirror, &row.IsTemplate
+		out.IsArchived, out.IsDisabled = &row.IsArchived, &row.IsDisabled
+	}
+	if fields.Owner {
+		id := row.OwnerDatabaseId()
+		out.OwnerType, out.OwnerID = row.Owner.Typename, &id
+		if row.Owner.Typename == "Organization" {
+			out.OwnerVerified = &row.Owner.Organization.IsVerified
+		}
+	}
+	return out
+}
+
+// RowWriter is where the crawl writes its rows, an Output or FileOutput.
+type RowWriter interface {
+	Write(row ghsearch.Row) error
+	// Commit makes every row written so far complete in the output.
+	Commit() error
+}
+
+// Compressor compresses the output as it is written.
+type Compressor interface {
+	io.WriteCloser
+	// Flush writes everything written so far, so it can be decompressed.
+	Flush() error
+}
+
+// NewCompressor returns a Compressor to w of compression, gzip or zstd.
+// Concatenated streams of either decompress as one, so a partial file can be appended to.
+func NewCompressor(w io.Writer, compression string) (Compressor, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
+
+// Output writes rows to a writer in one of the output formats: csv, ndjson, parquet or sqlite.
+type Output struct {
+	// Compressor, if set, is what the Output writes to, flushed with each Commit and closed with the Output.
+	Compressor Compressor
+	// Buffer, if set, is what the Output or its Compressor writes to, flushed with each Commit and closed with the Output.
+	Buffer *IntervalWriter
+	// Columns are the CSV columns, DefaultColumns unless changed before the first row is written.
+	Columns []string
+	// SafeCSV is whether to neutralize CSV values that could be evaluated as formulas, see SafeCSVValue.
+	SafeCSV bool
+	// MaxDescription is the most characters of a description written, see TruncateText.
+	MaxDescription int
+
+	field  string
+	fields OutputFields
+	csv    *CSVWriter
+	// value is the buffer each CSV value is encoded into
+	value   []byte
+	json    *json.Encoder
+	parquet *ParquetWriter
+	sqlite  *SQLiteWriter
+}
+
+// NewOutput returns an Output to w in format of the value of field and the optional fields,
+// terminating CSV rows with CRLF if crlf is set.
+func NewOutput(w io.Writer, format, field string, fields OutputFields, crlf bool) *Output {
+	o := &Output{field: field, fields: fields, Columns: DefaultColumns(field, fields)}
+	switch format {
+	case "ndjson":
+		o.json = json.NewEncoder(w)
+		o.json.SetEscapeHTML(false)
+	case "parquet":
+		o.parquet = NewParquetWriter(w, fields)
+	case "sqlite":
+		o.sqlite = NewSQLiteWriter(w, fields)
+	default:
+		o.csv = NewCSVWriter(w)
+		o.csv.UseCRLF = crlf
+	}
+	return o
+}
+
+// Write writes row.
+func (o *Output) Write(row ghsearch.Row) error {
+	row.Description = TruncateText(row.Description, o.MaxDescription)
+	switch {
+	case o.json != nil:
+		return o.json.Encode(NewJSONRow(row, o.field, o.fields))
+	case o.parquet != nil:
+		return o.parquet.Write(row)
+	case o.sqlite != nil:
+		return o.sqlite.Write(row)
+	}
+	for _, column := range o.Columns {
+		o.value = CSVColumns[column](o.value[:0], row)
+		if o.SafeCSV {
+			o.value = appendSafeCSV(o.value)
+		}
+		o.csv.Field(o.value)
+	}
+	return o.csv.EndRow()
+}
+
+// WriteHeader writes a CSV row of the names of the Columns. It does nothing in the other formats.
+func (o *Output) WriteHeader() error {
+	if o.csv == nil {
+		return nil
+	}
+	return o.csv.Write(o.Columns)
+}
+
+// Commit ends any open transaction, so every row written so far is complete in the output.
+func (o *Output) Commit() error {
+	if o.sqlite != nil {
+		if err := o.sqlite.Commit(); err != nil {
+			return err
+		}
+	}
+	if o.Compressor != nil {
+		if err := o.Compressor.Flush(); err != nil {
+			return err
+		}
+	}
+	if o.Buffer != nil {
+		return o.Buffer.Flush()
+	}
+	return nil
+}
+
+// Close writes the parquet footer or commits and closes any Compressor and Buffer, without closing the underlying writer.
+func (o *Output) Close() error {
+	if o.parquet != nil {
+		if err := o.parquet.Close(); err != nil {
+			return err
+		}
+	} else if o.sqlite != nil {
+		if err := o.sqlite.Commit(); err != nil {
+			return err
+		}
+	}
+	if o.Compressor != nil {
+		if err := o.Compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if o.Buffer != nil {
+		return o.Buffer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the current output")
+
+// testRows returns the rows of testdata/rows.json, picked to cover the quoting, NULLs and edge values of each
+// output format.
+func testRows(t testing.TB) []ghsearch.Row {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "rows.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []ghsearch.Row
+	if err := json.Unmarshal(b, &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// testFields are the optional fields the outputs are tested with: every field, and none.
+var testFields = map[string]OutputFields{
+	"all":  {SuspectedBot: true, Languages: true, License: true, Topics: true, Flags: true, Owner: true},
+	"none": {},
+}
+
+// golden compares got to testdata/golden/name, or rewrites it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run go test -update to accept it:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// writeOutput writes rows to an Output of format, with a header for CSV, returning what it wrote.
+func writeOutput(t testing.TB, rows []ghsearch.Row, format string, fields OutputFields) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	output := NewOutput(&buf, format, "stars", fields, false)
+	if err := output.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := output.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOutputGolden(t *testing.T) {
+	rows := testRows(t)
+	for name, fields := range testFields {
+		for format, ext := range map[string]string{"csv": "csv", "ndjson": "ndjson", "sqlite": "sql"} {
+			t.Run(format+"/"+name, func(t *testing.T) {
+				golden(t, name+"."+ext, writeOutput(t, rows, format, fields))
+			})
+		}
+	}
+}
+
+func TestOutputColumnsGolden(t *testing.T) {
+	columns, fields, err := ParseColumns("owner,name,forks,size,description,created_at,owner_verified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name          string
+		safeCSV, crlf bool
+	}{
+		{"columns.csv", false, false},
+		{"columns-safe-crlf.csv", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			output := NewOutput(&buf, "csv", "stars", fields, tt.crlf)
+			output.Columns, output.SafeCSV = columns, tt.safeCSV
+			if err := output.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range testRows(t) {
+				if err := output.Write(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := output.Close(); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, buf.Bytes())
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// AtomicFile is written as path with a .partial suffix and renamed to path once complete,
+// so path never holds the truncated output of a run that died part way through.
+type AtomicFile struct {
+	*os.File
+	path string
+	// Fresh is whether the file was empty when opened.
+	Fresh bool
+}
+
+// CreateAtomic creates the partial file of path, or if appending continues any existing one.
+func CreateAtomic(path string, appending bool) (*AtomicFile, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path+".partial", flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &AtomicFile{File: f, path: path, Fresh: info.Size() == 0}, nil
+}
+
+// Commit syncs and closes the file, then renames it into place.
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// DailyPath returns path with the day of repo's creation inserted before its extension, ex: repos-2006-01-02.csv
+// or repos-2006-01-02.csv.gz, or unknown if it has no valid creation time.
+func DailyPath(path string, repo ghsearch.Repository) string {
+	day := "unknown"
+	if repo.HasCreatedAt() {
+		day = FormatDate(repo.CreatedAt)
+	}
+	return DayPath(path, day)
+}
+
+// DayPath returns path with day inserted before its extension, ex: repos-2006-01-02.csv or repos-2006-01-02.csv.gz.
+func DayPath(path, day string) string {
+	ext := filepath.Ext(path)
+	if ext == ".gz" || ext == ".zst" {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext)) + ext
+	}
+	return strings.TrimSuffix(path, ext) + "-" + day + ext
+}
+
+// outputFile is an AtomicFile and the Output written to it.
+type outputFile struct {
+	file   *AtomicFile
+	output *Output
+}
+
+// FileOutput writes rows to an AtomicFile at Path, or if Daily to one per day the repositories were created.
+type FileOutput struct {
+	Path  string
+	Daily bool
+	// Append continues the partial files of an interrupted run.
+	Append bool
+	// New returns the Output of a file.
+	New func(f *AtomicFile) (*Output, error)
+
+	files map[string]*outputFile
+}
+
+// open returns the file at path, opening it if it has not been yet.
+func (fo *FileOutput) open(path string) (*outputFile, error) {
+	if of, ok := fo.files[path]; ok {
+		return of, nil
+	}
+	f, err := CreateAtomic(path, fo.Append)
+	if err != nil {
+		return nil, err
+	}
+	output, err := fo.New(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fo.files == nil {
+		fo.files = make(map[string]*outputFile)
+	}
+	of := &outputFile{file: f, output: output}
+	fo.files[path] = of
+	return of, nil
+}
+
+// Open opens the file at Path, so it exists even if no rows are written. Daily files are opened as needed.
+func (fo *FileOutput) Open() error {
+	if fo.Daily {
+		return nil
+	}
+	_, err := fo.open(fo.Path)
+	return err
+}
+
+// Write writes row to its file.
+func (fo *FileOutput) Write(row ghsearch.Row) error {
+	path := fo.Path
+	if fo.Daily {
+		path = DailyPath(fo.Path, row.Repository)
+	}
+	of, err := fo.open(path)
+	if err != nil {
+		return err
+	}
+	return of.output.Write(row)
+}
+
+// Commit commits the Output of each file.
+func (fo *FileOutput) Commit() error {
+	for _, of := range fo.files {
+		if err := of.output.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenPath opens the file at path, such as one of the Daily files, so it exists even if no rows are written.
+func (fo *FileOutput) OpenPath(path string) error {
+	_, err := fo.open(path)
+	return err
+}
+
+// ClosePath closes the file at path, if open, before the others, renaming it into place if complete.
+func (fo *FileOutput) ClosePath(path string, complete bool) error {
+	of, ok := fo.files[path]
+	if !ok {
+		return nil
+	}
+	delete(fo.files, path)
+	if err := of.output.Close(); err != nil {
+		of.file.Close()
+		return err
+	} else if complete {
+		return of.file.Commit()
+	}
+	return of.file.Close()
+}
+
+// Close closes every file, renaming them into place if complete, otherwise leaving them partial.
+// The paths of the files are returned in order.
+func (fo *FileOutput) Close(complete bool) ([]string, error) {
+	paths := make([]string, 0, len(fo.files))
+	var errs []error
+	for path, of := range fo.files {
+		paths = append(paths, path)
+		if err := of.output.Close(); err != nil {
+			errs = append(errs, err)
+			of.file.Close()
+		} else if complete {
+			errs = append(errs, of.file.Commit())
+		} else {
+			errs = append(errs, of.file.Close())
+		}
+	}
+	sort.Strings(paths)
+	return paths, errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// OwnerStats accumulates the number of repositories and total stars of each owner.
+type OwnerStats struct {
+	repos map[string]int
+	stars map[string]int
+}
+
+// NewOwnerStats returns an empty OwnerStats.
+func NewOwnerStats() *OwnerStats {
+	return &OwnerStats{
+		repos: make(map[string]int),
+		stars: make(map[string]int),
+	}
+}
+
+// Add counts repo towards its owner.
+func (s *OwnerStats) Add(repo ghsearch.Repository) {
+	login := owner(repo.NameWithOwner)
+	s.repos[login]++
+	s.stars[login] += repo.StargazerCount
+}
+
+// WriteCSV writes the owners ranked by number of repositories then total stars.
+func (s *OwnerStats) WriteCSV(w io.Writer) error {
+	owners := make([]string, 0, len(s.repos))
+	for login := range s.repos {
+		owners = append(owners, login)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		a, b := owners[i], owners[j]
+		if s.repos[a] != s.repos[b] {
+			return s.repos[a] > s.repos[b]
+		}
+		if s.stars[a] != s.stars[b] {
+			return s.stars[a] > s.stars[b]
+		}
+		return a < b
+	})
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"owner", "repos", "stars"})
+	for _, login := range owners {
+		cw.Write([]string{login, FormatInt(s.repos[login]), FormatInt(s.stars[login])})
+	}
+	cw.Flush()
+	return cw.Error()
+}
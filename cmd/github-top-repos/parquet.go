@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetRequired = 0
+	parquetOptional = 1
+)
+
+// parquetColumn is a column of the Parquet output, required unless present is set.
+type parquetColumn struct {
+	name string
+	typ  int32
+	// converted is the ConvertedType of the column, or -1 for none.
+	converted int32
+	// encode returns the PLAIN encoding of the column of rows.
+	encode func(rows []ghsearch.Row) []byte
+	// present, if set, makes the column optional, null for the rows it returns false for.
+	present func(row ghsearch.Row) bool
+}
+
+// parquetChunk is where a column of a row group was written.
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+// ParquetWriter writes rows to an uncompressed Parquet file, buffering RowGroupSize rows per row group.
+// The file is written sequentially so it may be streamed, but it is not valid until closed.
+type ParquetWriter struct {
+	RowGroupSize int
+
+	w       io.Writer
+	offset  int64
+	columns []parquetColumn
+	rows    []ghsearch.Row
+	groups  [][]parquetChunk
+	counts  []int
+}
+
+// NewParquetWriter returns a ParquetWriter to w with typed columns of each repository and the optional fields.
+func NewParquetWriter(w io.Writer, fields OutputFields) *ParquetWriter {
+	columns := []parquetColumn{
+		{name: "name_with_owner", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return row.NameWithOwner
+		})},
+		{name: "stars", typ: parquetInt64, converted: -1, encode: parquetInt64s(func(row ghsearch.Row) int64 {
+			return int64(row.StargazerCount)
+		})},
+		{name: "forks", typ: parquetInt64, converted: -1, encode: parquetInt64s(func(row ghsearch.Row) int64 {
+			return int64(row.ForkCount)
+		})},
+		{name: "size", typ: parquetInt64, converted: -1, encode: parquetInt64s(func(row ghsearch.Row) int64 {
+			return int64(row.DiskUsage)
+		})},
+		{name: "description", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return row.Description
+		})},
+		{name: "created_at", typ: parquetInt64, converted: parquetTimestampMillis, encode: parquetInt64s(func(row ghsearch.Row) int64 {
+			return row.CreatedAt.UnixMilli()
+		}), present: ghsearch.Row.HasCreatedAt},
+	}
+	if fields.SuspectedBot {
+		columns = append(columns, parquetColumn{name: "suspected_bot", typ: parquetBoolean, converted: -1, encode: parquetBooleans(func(row ghsearch.Row) bool {
+			return row.SuspectedBot
+		})})
+	}
+	if fields.Languages {
+		columns = append(columns, parquetColumn{name: "primary_language", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return row.PrimaryLanguage.Name
+		})}, parquetColumn{name: "languages", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return FormatLanguages(row.Languages.Edges)
+		})})
+	}
+	if fields.License {
+		columns = append(columns, parquetColumn{name: "license", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return row.LicenseInfo.SpdxId
+		})})
+	}
+	if fields.Topics {
+		columns = append(columns, parquetColumn{name: "topics", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return strings.Join(topicNames(row.Repository), ";")
+		})})
+	}
+	if fields.Flags {
+		for _, flag := range []struct {
+			name  string
+			value func(row ghsearch.Row) bool
+		}{
+			{"is_fork", func(row ghsearch.Row) bool { return row.IsFork }},
+			{"is_mirror", func(row ghsearch.Row) bool { return row.IsMirror }},
+			{"is_template", func(row ghsearch.Row) bool { return row.IsTemplate }},
+			{"is_archived", func(row ghsearch.Row) bool { return row.IsArchived }},
+			{"is_disabled", func(row ghsearch.Row) bool { return row.IsDisabled }},
+		} {
+			columns = append(columns, parquetColumn{name: flag.name, typ: parquetBoolean, converted: -1, encode: parquetBooleans(flag.value)})
+		}
+	}
+	if fields.Owner {
+		columns = append(columns, parquetColumn{name: "owner_type", typ: parquetByteArray, converted: parquetUTF8, encode: parquetStrings(func(row ghsearch.Row) string {
+			return row.Owner.Typename
+		})}, parquetColumn{name: "owner_id", typ: parquetInt64, converted: -1, encode: parquetInt64s(func(row ghsearch.Row) int64 {
+			return int64(row.OwnerDatabaseId())
+		})}, parquetColumn{name: "owner_verified", typ: parquetBoolean, converted: -1, encode: parquetBooleans(func(row ghsearch.Row) bool {
+			// The column is required, so users are not verified
+			return row.Owner.Organization.IsVerified
+		})})
+	}
+	return &ParquetWriter{RowGroupSize: 100000, w: w, columns: columns}
+}
+
+// parquetStrings returns the PLAIN encoder of a BYTE_ARRAY column.
+func parquetStrings(value func(ghsearch.Row) string) func([]ghsearch.Row) []byte {
+	return func(rows []ghsearch.Row) []byte {
+		var b []byte
+		for _, row := range rows {
+			s := value(row)
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+			b = append(b, s...)
+		}
+		return b
+	}
+}
+
+// parquetBooleans returns the PLAIN encoder of a BOOLEAN column.
+func parquetBooleans(value func(ghsearch.Row) bool) func([]ghsearch.Row) []byte {
+	return func(rows []ghsearch.Row) []byte {
+		// Booleans are bit-packed, least significant bit first
+		b := make([]byte, (len(rows)+7)/8)
+		for i, row := range rows {
+			if value(row) {
+				b[i/8] |= 1 << (i % 8)
+			}
+		}
+		return b
+	}
+}
+
+// parquetInt64s returns the PLAIN encoder of an INT64 column.
+func parquetInt64s(value func(ghsearch.Row) int64) func([]ghsearch.Row) []byte {
+	return func(rows []ghsearch.Row) []byte {
+		b := make([]byte, 0, 8*len(rows))
+		for _, row := range rows {
+			b = binary.LittleEndian.AppendUint64(b, uint64(value(row)))
+		}
+		return b
+	}
+}
+
+// parquetLevels returns the definition levels of an optional column of rows, as a length-prefixed RLE run of each
+// stretch of null or present values, and the rows that are present.
+func parquetLevels(rows []ghsearch.Row, present func(ghsearch.Row) bool) ([]byte, []ghsearch.Row) {
+	levels := make([]byte, 4)
+	var values []ghsearch.Row
+	for start := 0; start < len(rows); {
+		level := present(rows[start])
+		end := start + 1
+		for end < len(rows) && present(rows[end]) == level {
+			end++
+		}
+		// A run's header is its length shifted left by one, followed by the level in a byte, as the bit width is 1
+		levels = binary.AppendUvarint(levels, uint64(end-start)<<1)
+		if level {
+			levels = append(levels, 1)
+			values = append(values, rows[start:end]...)
+		} else {
+			levels = append(levels, 0)
+		}
+		start = end
+	}
+	binary.LittleEndian.PutUint32(levels, uint32(len(levels)-4))
+	return levels, values
+}
+
+// write writes b to the file, tracking the offset.
+func (pw *ParquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// Write buffers row, writing a row group once RowGroupSize rows are buffered.
+func (pw *ParquetWriter) Write(row ghsearch.Row) error {
+	pw.rows = append(pw.rows, row)
+	if len(pw.rows) >= pw.RowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group of a single data page per column.
+func (pw *ParquetWriter) flush() error {
+	if pw.offset == 0 {
+		if err := pw.write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+	if len(pw.rows) == 0 {
+		return nil
+	}
+	chunks := make([]parquetChunk, len(pw.columns))
+	for i, column := range pw.columns {
+		var data []byte
+		if column.present != nil {
+			levels, rows := parquetLevels(pw.rows, column.present)
+			data = append(levels, column.encode(rows)...)
+		} else {
+			data = column.encode(pw.rows)
+		}
+		var t thriftWriter
+		t.begin()
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(len(data)))
+		t.i32(3, int32(len(data)))
+		t.structField(5)
+		t.i32(1, int32(len(pw.rows)))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.end()
+		t.end()
+		chunks[i] = parquetChunk{offset: pw.offset, size: int64(t.buf.Len() + len(data))}
+		if err := pw.write(t.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+	}
+	pw.groups = append(pw.groups, chunks)
+	pw.counts = append(pw.counts, len(pw.rows))
+	pw.rows = pw.rows[:0]
+	return nil
+}
+
+// Close writes any buffered rows and the file footer, without closing the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	var total int64
+	for _, count := range pw.counts {
+		total += int64(count)
+	}
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1)
+	// The schema is a root with every column as a child
+	t.list(2, thriftStruct, len(pw.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.end()
+	for _, column := range pw.columns {
+		t.begin()
+		t.i32(1, column.typ)
+		if column.present != nil {
+			t.i32(3, parquetOptional)
+		} else {
+			t.i32(3, parquetRequired)
+		}
+		t.binary(4, column.name)
+		if column.converted >= 0 {
+			t.i32(6, column.converted)
+		}
+		t.end()
+	}
+	t.i64(3, total)
+	t.list(4, thriftStruct, len(pw.groups))
+	for g, chunks := range pw.groups {
+		var size int64
+		for _, chunk := range chunks {
+			size += chunk.size
+		}
+		t.begin()
+		t.list(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			column := pw.columns[i]
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, column.typ)
+			t.list(2, thriftI32, 2)
+			t.element(parquetPlain)
+			t.element(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.string(column.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(pw.counts[g]))
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(pw.counts[g]))
+		t.end()
+	}
+	// Record the binary that produced the file for provenance
+	t.binary(6, ReadBuildInfo().String())
+	t.end()
+	if err := pw.write(t.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(t.buf.Len()))); err != nil {
+		return err
+	}
+	return pw.write([]byte("PAR1"))
+}
+
+// Thrift compact protocol types.
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol needed for Parquet metadata.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last is the last field id written in each open struct
+	last []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// field writes the header of field id, as a delta from the previous field if possible.
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// begin starts a struct, either at the top level or as an element of a list.
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+// end ends the current struct.
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.string(s)
+}
+
+// structField starts a struct valued field, ended by end.
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list writes the header of a list of n elements, which follow as element, string or begin/end.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xF0 | elem)
+		t.varint(uint64(n))
+	}
+}
+
+// element writes an i32 element of a list.
+func (t *thriftWriter) element(v int32) {
+	t.zigzag(int64(v))
+}
+
+// string writes a binary list element or field value.
+func (t *thriftWriter) string(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
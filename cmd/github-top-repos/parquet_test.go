@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// The file is read back with a decoder written from parquet.thrift and the Thrift compact protocol spec rather
+// than from the writer, so a field id, type or offset the writer gets wrong doesn't decode the way it was written.
+// https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+// https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+
+// thriftStructValue is a decoded Thrift struct, its fields by id: int64 for the integer types, bool, []byte for
+// binary, []any for a list and thriftStructValue for a nested struct.
+type thriftStructValue map[int16]any
+
+// thriftReader decodes the Thrift compact protocol.
+type thriftReader struct {
+	b   []byte
+	off int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.off >= len(r.b) {
+		panic("thrift: unexpected end of input")
+	}
+	c := r.b[r.off]
+	r.off++
+	return c
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.off:])
+	if n <= 0 {
+		panic("thrift: invalid varint")
+	}
+	r.off += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// value decodes a value of the compact type typ.
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		// In a list a bool is a byte, as a field it is the type itself
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		r.off += 8
+		return nil
+	case 8:
+		n := int(r.uvarint())
+		if r.off+n > len(r.b) {
+			panic("thrift: binary past the end of input")
+		}
+		v := r.b[r.off : r.off+n]
+		r.off += n
+		return v
+	case 9, 10:
+		header := r.byte()
+		n, elem := int(header>>4), header&0x0F
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			if elem == 1 || elem == 2 {
+				list[i] = r.byte() == 1
+			} else {
+				list[i] = r.value(elem)
+			}
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("thrift: unsupported type %d", typ))
+}
+
+// readStruct decodes a struct up to its stop field.
+func (r *thriftReader) readStruct() thriftStructValue {
+	s := thriftStructValue{}
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return s
+		}
+		typ := header & 0x0F
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(r.zigzag())
+		}
+		s[id] = r.value(typ)
+	}
+}
+
+// parquetFile is a Parquet file read back: its schema and the values of each column, nil for null.
+type parquetFile struct {
+	// names are the columns in order.
+	names []string
+	// schema is the repetition, type and converted type (-1 for none) of each column by name.
+	schema map[string][3]int64
+	values map[string][]any
+	// groups is the number of rows of each row group.
+	groups []int64
+	// createdBy is the created_by of the footer.
+	createdBy string
+}
+
+// readParquet decodes file, failing t on anything a reader would reject.
+func readParquet(t *testing.T, file []byte) (pf *parquetFile) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("invalid Parquet file: %v", r)
+		}
+	}()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footerStart := len(file) - 8 - footerLen
+	if footerStart < 4 {
+		t.Fatalf("footer length %d is longer than the file", footerLen)
+	}
+	fr := &thriftReader{b: file[footerStart : len(file)-8]}
+	meta := fr.readStruct()
+	if fr.off != footerLen {
+		t.Fatalf("FileMetaData is %d bytes, the footer length is %d", fr.off, footerLen)
+	}
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v, want 1", meta[1])
+	}
+	pf = &parquetFile{schema: map[string][3]int64{}, values: map[string][]any{}}
+	if createdBy, ok := meta[6].([]byte); ok {
+		pf.createdBy = string(createdBy)
+	}
+
+	// The root of the schema is followed by each column as its child
+	schema := meta[2].([]any)
+	root := schema[0].(thriftStructValue)
+	if root[5] != int64(len(schema)-1) {
+		t.Fatalf("root num_children = %v, the schema has %d columns", root[5], len(schema)-1)
+	}
+	for _, e := range schema[1:] {
+		element := e.(thriftStructValue)
+		name := string(element[4].([]byte))
+		converted := int64(-1)
+		if v, ok := element[6]; ok {
+			converted = v.(int64)
+		}
+		pf.names = append(pf.names, name)
+		pf.schema[name] = [3]int64{element[3].(int64), element[1].(int64), converted}
+	}
+
+	var total int64
+	end := int64(4)
+	for _, g := range meta[4].([]any) {
+		group := g.(thriftStructValue)
+		rows := group[3].(int64)
+		pf.groups = append(pf.groups, rows)
+		total += rows
+		chunks := group[1].([]any)
+		if len(chunks) != len(pf.names) {
+			t.Fatalf("row group has %d column chunks, the schema has %d columns", len(chunks), len(pf.names))
+		}
+		var groupSize int64
+		for i, c := range chunks {
+			chunk := c.(thriftStructValue)
+			name := pf.names[i]
+			column := chunk[3].(thriftStructValue)
+			if path := column[3].([]any); len(path) != 1 || string(path[0].([]byte)) != name {
+				t.Fatalf("column chunk %d path_in_schema = %q, want %q", i, path, name)
+			}
+			if column[1] != pf.schema[name][1] {
+				t.Fatalf("column %s chunk type %v, the schema has %v", name, column[1], pf.schema[name][1])
+			}
+			if column[4] != int64(0) {
+				t.Fatalf("column %s codec = %v, want UNCOMPRESSED", name, column[4])
+			}
+			if column[5] != rows {
+				t.Fatalf("column %s num_values = %v, the row group has %d rows", name, column[5], rows)
+			}
+			offset := column[9].(int64)
+			if offset != end {
+				t.Fatalf("column %s starts at %d, the previous chunk ended at %d", name, offset, end)
+			}
+			size := column[7].(int64)
+			if column[6] != size {
+				t.Fatalf("column %s is uncompressed but its sizes differ: %v, %v", name, column[6], size)
+			}
+			end += size
+			groupSize += size
+
+			// A single data page of PLAIN values, definition levels first if the column is optional
+			pr := &thriftReader{b: file[offset : offset+size]}
+			page := pr.readStruct()
+			if page[1] != int64(0) {
+				t.Fatalf("column %s page type = %v, want DATA_PAGE", name, page[1])
+			}
+			data := file[offset+int64(pr.off) : offset+size]
+			if page[2] != int64(len(data)) || page[3] != int64(len(data)) {
+				t.Fatalf("column %s page sizes = %v, %v, the page has %d bytes", name, page[2], page[3], len(data))
+			}
+			header := page[5].(thriftStructValue)
+			if header[1] != rows || header[2] != int64(0) {
+				t.Fatalf("column %s data page num_values = %v, encoding = %v", name, header[1], header[2])
+			}
+			present := make([]bool, rows)
+			for i := range present {
+				present[i] = true
+			}
+			if pf.schema[name][0] == parquetOptional {
+				n := int(binary.LittleEndian.Uint32(data))
+				present = decodeLevels(t, data[4:4+n], int(rows))
+				data = data[4+n:]
+			}
+			values, rest := decodePlain(t, pf.schema[name][1], data, present)
+			if len(rest) != 0 {
+				t.Fatalf("column %s has %d bytes after its values", name, len(rest))
+			}
+			pf.values[name] = append(pf.values[name], values...)
+		}
+		if group[2] != groupSize {
+			t.Errorf("row group total_byte_size = %v, its chunks are %d bytes", group[2], groupSize)
+		}
+	}
+	if end != int64(footerStart) {
+		t.Errorf("the column chunks end at %d, the footer starts at %d", end, footerStart)
+	}
+	if meta[3] != total {
+		t.Errorf("num_rows = %v, the row groups have %d", meta[3], total)
+	}
+	return pf
+}
+
+// decodeLevels decodes n definition levels of bit width 1 in the RLE/bit-packed hybrid encoding.
+func decodeLevels(t *testing.T, b []byte, n int) []bool {
+	r := &thriftReader{b: b}
+	var levels []bool
+	for r.off < len(b) {
+		header := r.uvarint()
+		if header&1 == 0 {
+			// An RLE run of one value in a byte
+			value := r.byte()
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, value == 1)
+			}
+		} else {
+			// Groups of 8 bit-packed values
+			for i := uint64(0); i < header>>1; i++ {
+				c := r.byte()
+				for bit := 0; bit < 8; bit++ {
+					levels = append(levels, c&(1<<bit) != 0)
+				}
+			}
+		}
+	}
+	if len(levels) < n {
+		t.Fatalf("%d definition levels, want %d", len(levels), n)
+	}
+	return levels[:n]
+}
+
+// decodePlain decodes a PLAIN value of typ for each present row, returning them with nil for the absent rows and
+// what follows them.
+func decodePlain(t *testing.T, typ int64, b []byte, present []bool) ([]any, []byte) {
+	values := make([]any, len(present))
+	var bit int
+	for i, ok := range present {
+		if !ok {
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			values[i] = b[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case parquetInt64:
+			values[i] = int64(binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case parquetByteArray:
+			n := binary.LittleEndian.Uint32(b)
+			values[i] = string(b[4 : 4+n])
+			b = b[4+n:]
+		default:
+			t.Fatalf("unexpected physical type %d", typ)
+		}
+	}
+	if typ == parquetBoolean {
+		b = b[(bit+7)/8:]
+	}
+	return values, b
+}
+
+func TestParquetReadBack(t *testing.T) {
+	rows := testRows(t)
+	fields := testFields["all"]
+	var buf bytes.Buffer
+	pw := NewParquetWriter(&buf, fields)
+	// Several row groups, the last smaller
+	pw.RowGroupSize = 2
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pf := readParquet(t, buf.Bytes())
+
+	if want := []int64{2, 2, 1}; !reflect.DeepEqual(pf.groups, want) {
+		t.Errorf("row groups of %v rows, want %v", pf.groups, want)
+	}
+	if want := ReadBuildInfo().String(); pf.createdBy != want {
+		t.Errorf("created_by = %q, want %q", pf.createdBy, want)
+	}
+
+	utf8 := func(name string, value func(ghsearch.Row) any) parquetTestColumn {
+		return parquetTestColumn{name, parquetRequired, parquetByteArray, parquetUTF8, value}
+	}
+	int64s := func(name string, value func(ghsearch.Row) any) parquetTestColumn {
+		return parquetTestColumn{name, parquetRequired, parquetInt64, -1, value}
+	}
+	bools := func(name string, value func(ghsearch.Row) any) parquetTestColumn {
+		return parquetTestColumn{name, parquetRequired, parquetBoolean, -1, value}
+	}
+	want := []parquetTestColumn{
+		utf8("name_with_owner", func(row ghsearch.Row) any { return row.NameWithOwner }),
+		int64s("stars", func(row ghsearch.Row) any { return int64(row.StargazerCount) }),
+		int64s("forks", func(row ghsearch.Row) any { return int64(row.ForkCount) }),
+		int64s("size", func(row ghsearch.Row) any { return int64(row.DiskUsage) }),
+		utf8("description", func(row ghsearch.Row) any { return row.Description }),
+		{"created_at", parquetOptional, parquetInt64, parquetTimestampMillis, func(row ghsearch.Row) any {
+			if !row.HasCreatedAt() {
+				return nil
+			}
+			return row.CreatedAt.UnixMilli()
+		}},
+		bools("suspected_bot", func(row ghsearch.Row) any { return row.SuspectedBot }),
+		utf8("primary_language", func(row ghsearch.Row) any { return row.PrimaryLanguage.Name }),
+		utf8("languages", func(row ghsearch.Row) any { return FormatLanguages(row.Languages.Edges) }),
+		utf8("license", func(row ghsearch.Row) any { return row.LicenseInfo.SpdxId }),
+		utf8("topics", func(row ghsearch.Row) any { return strings.Join(topicNames(row.Repository), ";") }),
+		bools("is_fork", func(row ghsearch.Row) any { return row.IsFork }),
+		bools("is_mirror", func(row ghsearch.Row) any { return row.IsMirror }),
+		bools("is_template", func(row ghsearch.Row) any { return row.IsTemplate }),
+		bools("is_archived", func(row ghsearch.Row) any { return row.IsArchived }),
+		bools("is_disabled", func(row ghsearch.Row) any { return row.IsDisabled }),
+		utf8("owner_type", func(row ghsearch.Row) any { return row.Owner.Typename }),
+		int64s("owner_id", func(row ghsearch.Row) any { return int64(row.OwnerDatabaseId()) }),
+		bools("owner_verified", func(row ghsearch.Row) any { return row.Owner.Organization.IsVerified }),
+	}
+	var names []string
+	for _, column := range want {
+		names = append(names, column.name)
+	}
+	if !reflect.DeepEqual(pf.names, names) {
+		t.Fatalf("columns = %q, want %q", pf.names, names)
+	}
+	for _, column := range want {
+		if got, want := pf.schema[column.name], [3]int64{column.repetition, column.typ, column.converted}; got != want {
+			t.Errorf("column %s repetition, type and converted type = %v, want %v", column.name, got, want)
+		}
+		for i, row := range rows {
+			if got, want := pf.values[column.name][i], column.value(row); got != want {
+				t.Errorf("column %s of %s = %#v, want %#v", column.name, row.NameWithOwner, got, want)
+			}
+		}
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewParquetWriter(&buf, OutputFields{}).Close(); err != nil {
+		t.Fatal(err)
+	}
+	pf := readParquet(t, buf.Bytes())
+	if len(pf.groups) != 0 || len(pf.names) != 6 {
+		t.Errorf("empty file has %d row groups and %d columns, want 0 and 6", len(pf.groups), len(pf.names))
+	}
+}
+
+// parquetTestColumn is a column the Parquet file should have, and its value for a row.
+type parquetTestColumn struct {
+	name                       string
+	repetition, typ, converted int64
+	value                      func(ghsearch.Row) any
+}
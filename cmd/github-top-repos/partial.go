@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GraphQLError is an error of a GraphQL response.
+// https://docs.github.com/en/graphql/guides/forming-calls-with-graphql#about-errors
+type GraphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// Path is the field that failed to resolve, as names and list indices.
+	Path []any `json:"path"`
+}
+
+// InList reports whether the error is of a single element of a list, such as one node of a search.
+func (e GraphQLError) InList() bool {
+	for _, elem := range e.Path {
+		if _, ok := elem.(float64); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PathString returns the Path joined by dots, ex: search.nodes.3.owner.
+func (e GraphQLError) PathString() string {
+	parts := make([]string, len(e.Path))
+	for i, elem := range e.Path {
+		parts[i] = fmt.Sprint(elem)
+	}
+	return strings.Join(parts, ".")
+}
+
+// PartialTransport is a http.RoundTripper that keeps the data of a GraphQL response whose errors are all of
+// single elements of a list, which GitHub returns as null, by logging, counting and removing the errors.
+// Otherwise the client would discard the whole response for a single repository it failed to resolve,
+// such as one made private (FORBIDDEN) or taken down (NOT_FOUND) since it was indexed. It reads each response
+// into memory, which a LimitTransport below it still counts as in flight until the response is closed.
+type PartialTransport struct {
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	skipped map[string]int
+}
+
+// Skipped returns the number of elements skipped by error type.
+func (t *PartialTransport) Skipped() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	skipped := make(map[string]int, len(t.skipped))
+	for typ, count := range t.skipped {
+		skipped[typ] = count
+	}
+	return skipped
+}
+
+// Summary describes how many elements were skipped by each error type, such as FORBIDDEN=1 NOT_FOUND=2.
+func (t *PartialTransport) Summary() string {
+	var parts []string
+	for typ, count := range t.Skipped() {
+		parts = append(parts, typ+"="+strconv.Itoa(count))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// bufferedBody is a response body read into memory, closing the one it was read from when closed.
+type bufferedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *PartialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	// The body read is only closed with the buffer, so a LimitTransport below still counts it as in flight
+	raw := resp.Body
+	body, err := io.ReadAll(raw)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	resp.Body = bufferedBody{bytes.NewReader(body), raw}
+	if !bytes.Contains(body, []byte(`"errors"`)) {
+		return resp, nil
+	}
+	var out map[string]json.RawMessage
+	var errs []GraphQLError
+	if json.Unmarshal(body, &out) != nil || json.Unmarshal(out["errors"], &errs) != nil || len(errs) == 0 {
+		return resp, nil
+	} else if data := out["data"]; len(data) == 0 || string(data) == "null" {
+		return resp, nil
+	}
+	for _, e := range errs {
+		if !e.InList() {
+			return resp, nil
+		}
+	}
+	t.mu.Lock()
+	if t.skipped == nil {
+		t.skipped = make(map[string]int)
+	}
+	for _, e := range errs {
+		log.Printf("Skipping %s: %s (%s)", e.PathString(), e.Message, e.Type)
+		typ := e.Type
+		if typ == "" {
+			typ = "unknown"
+		}
+		t.skipped[typ]++
+	}
+	t.mu.Unlock()
+	delete(out, "errors")
+	if body, err = json.Marshal(out); err != nil {
+		return nil, err
+	}
+	resp.Body = bufferedBody{bytes.NewReader(body), raw}
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPartialTransport(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		// want is the body returned, the same as sent if empty
+		want    string
+		skipped map[string]int
+	}{
+		{
+			name:   "data",
+			status: http.StatusOK,
+			body:   `{"data":{"search":{"nodes":[{"name":"a"}]}}}`,
+		},
+		{
+			name:    "errors of list elements",
+			status:  http.StatusOK,
+			body:    `{"data":{"search":{"nodes":[null,{"name":"b"},null]}},"errors":[{"type":"NOT_FOUND","message":"gone","path":["search","nodes",0]},{"type":"FORBIDDEN","message":"private","path":["search","nodes",2,"owner"]}]}`,
+			want:    `{"data":{"search":{"nodes":[null,{"name":"b"},null]}}}`,
+			skipped: map[string]int{"FORBIDDEN": 1, "NOT_FOUND": 1},
+		},
+		{
+			name:    "error without a type",
+			status:  http.StatusOK,
+			body:    `{"data":{"nodes":[null]},"errors":[{"message":"?","path":["nodes",0]}]}`,
+			want:    `{"data":{"nodes":[null]}}`,
+			skipped: map[string]int{"unknown": 1},
+		},
+		{
+			name:   "error of a field",
+			status: http.StatusOK,
+			body:   `{"data":{"search":null},"errors":[{"type":"NOT_FOUND","path":["search"]},{"type":"NOT_FOUND","path":["search","nodes",0]}]}`,
+		},
+		{
+			name:   "errors without data",
+			status: http.StatusOK,
+			body:   `{"data":null,"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`,
+		},
+		{
+			name:   "not GraphQL",
+			status: http.StatusOK,
+			body:   `"errors"`,
+		},
+		{
+			name:   "error response",
+			status: http.StatusBadGateway,
+			body:   `{"data":{"nodes":[null]},"errors":[{"type":"NOT_FOUND","path":["nodes",0]}]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			partial := &PartialTransport{Base: http.DefaultTransport}
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := partial.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.body
+			}
+			if string(body) != want {
+				t.Errorf("body %s, want %s", body, want)
+			}
+			if tt.want != "" && resp.ContentLength != int64(len(body)) {
+				t.Errorf("Content-Length %d of a body of %d", resp.ContentLength, len(body))
+			}
+			if skipped := partial.Skipped(); len(skipped) > 0 || tt.skipped != nil {
+				if !reflect.DeepEqual(skipped, tt.skipped) {
+					t.Errorf("skipped %v, want %v", skipped, tt.skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestPartialTransportInFlight(t *testing.T) {
+	body := `{"data":{"description":"` + strings.Repeat("x", 600) + `"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	limit := &LimitTransport{Base: http.DefaultTransport, MaxInFlight: 1000}
+	partial := &PartialTransport{Base: limit}
+	get := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return partial.RoundTrip(req)
+	}
+
+	first, err := get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The buffered body of the first response is still in memory, so a second doesn't fit alongside it
+	if got := limit.inFlight.Load(); got != int64(len(body)) {
+		t.Errorf("%d bytes in flight with a response of %d buffered", got, len(body))
+	}
+	if _, err := get(); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("second response while the first is buffered: %v, want %v", err, ErrMemoryLimit)
+	}
+	if got := limit.inFlight.Load(); got != int64(len(body)) {
+		t.Errorf("%d bytes in flight after the second response failed, want only the first", got)
+	}
+	first.Body.Close()
+	if got := limit.inFlight.Load(); got != 0 {
+		t.Errorf("%d bytes in flight after the first response was closed", got)
+	}
+	second, err := get()
+	if err != nil {
+		t.Fatalf("second response once the first is closed: %v", err)
+	}
+	second.Body.Close()
+}
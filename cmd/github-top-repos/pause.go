@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Pause holds back requests while paused, such as when the token is needed elsewhere.
+type Pause struct {
+	mu     sync.Mutex
+	resume chan struct{}
+}
+
+// Pause holds back requests until Resume is called.
+func (p *Pause) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resume == nil {
+		p.resume = make(chan struct{})
+		log.Printf("Paused, resume with SIGUSR2")
+	}
+}
+
+// Resume releases any held requests.
+func (p *Pause) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resume != nil {
+		close(p.resume)
+		p.resume = nil
+		log.Printf("Resumed")
+	}
+}
+
+// PauseTransport is a http.RoundTripper that waits to send requests while paused.
+// Requests already in flight are allowed to finish.
+type PauseTransport struct {
+	Base  http.RoundTripper
+	Pause *Pause
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *PauseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Pause.mu.Lock()
+	resume := t.Pause.resume
+	t.Pause.mu.Unlock()
+	if resume != nil {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-resume:
+		}
+	}
+	return t.Base.RoundTrip(req)
+}
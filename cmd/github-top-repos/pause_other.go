@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// NewPauseTransport returns base, as there are no SIGUSR1/SIGUSR2 signals to pause and resume it with.
+func NewPauseTransport(ctx context.Context, base http.RoundTripper) http.RoundTripper {
+	return base
+}
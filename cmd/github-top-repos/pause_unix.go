@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// NewPauseTransport returns base paused by SIGUSR1 and resumed by SIGUSR2 until ctx is done.
+func NewPauseTransport(ctx context.Context, base http.RoundTripper) http.RoundTripper {
+	p := &Pause{}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					p.Pause()
+				} else {
+					p.Resume()
+				}
+			}
+		}
+	}()
+	return &PauseTransport{Base: base, Pause: p}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// Enricher is a stage of the enrich pipeline, adding columns to each repository of a dataset.
+type Enricher interface {
+	// Columns are the names of the columns added by the stage.
+	Columns() []string
+	// Enrich returns the values of Columns for a repository.
+	Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error)
+}
+
+// IsRepositoryNotFound reports whether err is GitHub's NOT_FOUND error of a GraphQL lookup of a repository by
+// name, as for one deleted or made private since the snapshot being enriched was taken. Unlike a REST 404,
+// which is also returned for a feature that is disabled or not visible, it only means the repository is gone.
+func IsRepositoryNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Could not resolve to a Repository with the name")
+}
+
+// EnrichEnv provides the clients shared by the stages of the enrich pipeline.
+type EnrichEnv struct {
+	GraphQL *githubv4.Client
+	// REST is authenticated for the GitHub REST API at RESTURL.
+	REST    *http.Client
+	RESTURL string
+	// Client is unauthenticated, for the services other than GitHub at DepsDevURL, ScorecardURL and of Registries.
+	Client       *http.Client
+	DepsDevURL   string
+	ScorecardURL string
+	// Registries are searched for the packages of each repository.
+	Registries    *Registries
+	RegistryNames []string
+}
+
+// Enrichers are the named stages available to the enrich pipeline.
+var Enrichers = map[string]func(env EnrichEnv) Enricher{
+	"languages": func(env EnrichEnv) Enricher {
+		return languagesEnricher{env.GraphQL}
+	},
+	"citations": func(env EnrichEnv) Enricher {
+		return citationsEnricher{env.GraphQL}
+	},
+	"advisories": func(env EnrichEnv) Enricher {
+		return advisoriesEnricher{env.REST, env.RESTURL}
+	},
+	"commit-activity": func(env EnrichEnv) Enricher {
+		return commitActivityEnricher{env.REST, env.RESTURL}
+	},
+	"contributors": func(env EnrichEnv) Enricher {
+		return contributorsEnricher{env.REST, env.RESTURL}
+	},
+	"scorecard": func(env EnrichEnv) Enricher {
+		return scorecardEnricher{env.Client, env.ScorecardURL}
+	},
+	"workflow-runs": func(env EnrichEnv) Enricher {
+		return workflowRunsEnricher{env.REST, env.RESTURL}
+	},
+	"readmes": func(env EnrichEnv) Enricher {
+		return readmesEnricher{env.GraphQL}
+	},
+	"deps-dev": func(env EnrichEnv) Enricher {
+		return depsDevEnricher{&DepsDevClient{Client: env.Client, BaseURL: env.DepsDevURL}}
+	},
+	"registries": func(env EnrichEnv) Enricher {
+		return registriesEnricher{env.Registries, env.RegistryNames}
+	},
+}
+
+// GraphQLEnrichers are the stages that only use the GraphQL API, which a crawl can run with -enrich.
+var GraphQLEnrichers = []string{"citations", "languages", "readmes"}
+
+// enrichHeader returns the header row of the enrich output of stages: the owner/name, the columns of each stage
+// and whether the repository was found deleted, and when.
+func enrichHeader(stages []Enricher) []string {
+	header := []string{"name_with_owner"}
+	for _, stage := range stages {
+		header = append(header, stage.Columns()...)
+	}
+	return append(header, "deleted", "deleted_at")
+}
+
+// enrichResult is the outcome of a stage for a repository.
+type enrichResult struct {
+	values []string
+	// deleted is when the stage found the repository no longer exists, if it did.
+	deleted time.Time
+}
+
+// runStage runs the named stage for repo, logging a failure, with its values cut at maxValueLength characters if
+// positive. The values of a stage that fails are nil.
+func runStage(ctx context.Context, name string, stage Enricher, repo ghsearch.Repository, maxValueLength int) enrichResult {
+	values, err := stage.Enrich(ctx, repo)
+	if IsRepositoryNotFound(err) {
+		log.Printf("%s was not found by the %s stage, marking it deleted", repo.NameWithOwner, name)
+		return enrichResult{deleted: time.Now()}
+	} else if err != nil {
+		log.Printf("Failed %s stage for %s: %v", name, repo.NameWithOwner, err)
+		return enrichResult{}
+	}
+	for i, value := range values {
+		values[i] = TruncateText(value, maxValueLength)
+	}
+	return enrichResult{values: values}
+}
+
+// enrichRecord returns the row of the enrich output of repo from the result of each stage, leaving the columns of
+// a stage that failed empty and marking it deleted when first found to be.
+func enrichRecord(repo ghsearch.Repository, stages []Enricher, results []enrichResult) []string {
+	record := []string{repo.NameWithOwner}
+	var deleted time.Time
+	for i, stage := range stages {
+		values := results[i].values
+		if values == nil {
+			values = make([]string, len(stage.Columns()))
+		}
+		record = append(record, values...)
+		if at := results[i].deleted; !at.IsZero() && (deleted.IsZero() || at.Before(deleted)) {
+			deleted = at
+		}
+	}
+	if deleted.IsZero() {
+		return append(record, FormatBool(false), "")
+	}
+	return append(record, FormatBool(true), FormatTime(deleted))
+}
+
+// enrichRepository runs each of the named stages for repo in turn, returning its row of the enrich output.
+func enrichRepository(ctx context.Context, names []string, stages []Enricher, repo ghsearch.Repository, maxValueLength int) []string {
+	results := make([]enrichResult, len(stages))
+	for i, stage := range stages {
+		results[i] = runStage(ctx, names[i], stage, repo, maxValueLength)
+	}
+	return enrichRecord(repo, stages, results)
+}
+
+// EnrichStage is a stage of the enrich subcommand, run with its own pool of Jobs at most one per Interval.
+type EnrichStage struct {
+	Name     string
+	Enricher Enricher
+	Jobs     int
+	Interval time.Duration
+}
+
+// enrichBatch runs every stage over repos, each concurrently with its own pool and pace, returning the row of the
+// enrich output of each repository in order. Only the results of the batch are held until it is written.
+func enrichBatch(ctx context.Context, stages []EnrichStage, repos []ghsearch.Repository, maxValueLength int) [][]string {
+	indices := make([]int, len(repos))
+	results := make([][]enrichResult, len(repos))
+	for i := range repos {
+		indices[i] = i
+		results[i] = make([]enrichResult, len(stages))
+	}
+	var wg sync.WaitGroup
+	for s, stage := range stages {
+		wg.Add(1)
+		go func(s int, stage EnrichStage) {
+			defer wg.Done()
+			// Each stage writes its own element of the results, so they need no lock
+			forEachParallel(ctx, indices, stage.Jobs, stage.Interval, func(i int) {
+				results[i][s] = runStage(ctx, stage.Name, stage.Enricher, repos[i], maxValueLength)
+			})
+		}(s, stage)
+	}
+	wg.Wait()
+	enrichers := make([]Enricher, len(stages))
+	for s, stage := range stages {
+		enrichers[s] = stage.Enricher
+	}
+	records := make([][]string, len(repos))
+	for i, repo := range repos {
+		records[i] = enrichRecord(repo, enrichers, results[i])
+	}
+	return records
+}
+
+type languagesEnricher struct {
+	client *githubv4.Client
+}
+
+func (languagesEnricher) Columns() []string { return []string{"languages"} }
+
+func (e languagesEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	_, languages, err := FetchLanguages(ctx, e.client, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	return []string{FormatLanguages(languages)}, nil
+}
+
+type citationsEnricher struct {
+	client *githubv4.Client
+}
+
+func (citationsEnricher) Columns() []string { return []string{"has_citation_cff", "dois"} }
+
+func (e citationsEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	citation, err := FetchCitation(ctx, e.client, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	return []string{FormatBool(citation.HasCFF), strings.Join(citation.DOIs, ";")}, nil
+}
+
+type advisoriesEnricher struct {
+	client  *http.Client
+	restURL string
+}
+
+func (advisoriesEnricher) Columns() []string { return []string{"published_advisories"} }
+
+func (e advisoriesEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	count, err := CountAdvisories(ctx, e.client, e.restURL, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	return []string{FormatInt(count)}, nil
+}
+
+type commitActivityEnricher struct {
+	client  *http.Client
+	restURL string
+}
+
+func (commitActivityEnricher) Columns() []string { return []string{"total_commits", "weekly_commits"} }
+
+func (e commitActivityEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	weeks, err := FetchParticipation(ctx, e.client, e.restURL, repo.NameWithOwner, 5, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var total int
+	counts := make([]string, len(weeks))
+	for i, count := range weeks {
+		total += count
+		counts[i] = FormatInt(count)
+	}
+	return []string{FormatInt(total), strings.Join(counts, ";")}, nil
+}
+
+type workflowRunsEnricher struct {
+	client  *http.Client
+	restURL string
+}
+
+func (workflowRunsEnricher) Columns() []string { return []string{"database_id", "workflow_runs_30d"} }
+
+func (e workflowRunsEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	id, count, err := CountWorkflowRuns(ctx, e.client, e.restURL, repo.NameWithOwner, time.Now().Add(-30*24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	return []string{FormatInt(id), FormatInt(count)}, nil
+}
+
+type contributorsEnricher struct {
+	client  *http.Client
+	restURL string
+}
+
+func (contributorsEnricher) Columns() []string { return []string{"contributors"} }
+
+func (e contributorsEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	count, err := CountContributors(ctx, e.client, e.restURL, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	return []string{FormatInt(count)}, nil
+}
+
+type scorecardEnricher struct {
+	client  *http.Client
+	baseURL string
+}
+
+func (scorecardEnricher) Columns() []string { return []string{"scorecard_score", "scorecard_date"} }
+
+func (e scorecardEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	scorecard, err := FetchScorecard(ctx, e.client, e.baseURL, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	} else if scorecard == nil {
+		return []string{"", ""}, nil
+	}
+	return []string{FormatFloat(scorecard.Score), scorecard.Date}, nil
+}
+
+type readmesEnricher struct {
+	client *githubv4.Client
+}
+
+func (readmesEnricher) Columns() []string { return []string{"readme_filename", "readme"} }
+
+func (e readmesEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	filename, text, err := FetchReadme(ctx, e.client, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	return []string{filename, text}, nil
+}
+
+type depsDevEnricher struct {
+	client *DepsDevClient
+}
+
+func (depsDevEnricher) Columns() []string {
+	return []string{"deps_dev_packages", "deps_dev_dependents"}
+}
+
+func (e depsDevEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	packages, err := e.client.Packages(ctx, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(packages))
+	dependents := make([]string, len(packages))
+	for i, pkg := range packages {
+		names[i] = pkg.System + ":" + pkg.Name
+		dependents[i] = FormatInt(pkg.Dependents)
+	}
+	return []string{strings.Join(names, ";"), strings.Join(dependents, ";")}, nil
+}
+
+type registriesEnricher struct {
+	registries *Registries
+	names      []string
+}
+
+func (registriesEnricher) Columns() []string {
+	return []string{"registry_packages", "registry_downloads", "registry_downloads_periods"}
+}
+
+func (e registriesEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	// Packages are matched by the repository name and confirmed by their repository URL
+	_, name, _ := strings.Cut(repo.NameWithOwner, "/")
+	var packages, downloads, periods []string
+	for _, registry := range e.names {
+		pkg, err := e.registries.Lookup(ctx, registry, strings.ToLower(name), repo.NameWithOwner)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", registry, err)
+		} else if pkg == nil {
+			continue
+		}
+		packages = append(packages, pkg.Registry+":"+pkg.Name)
+		downloads = append(downloads, FormatInt(pkg.Downloads))
+		periods = append(periods, pkg.DownloadsPeriod)
+	}
+	return []string{strings.Join(packages, ";"), strings.Join(downloads, ";"), strings.Join(periods, ";")}, nil
+}
+
+// parseStageOptions parses a comma-separated list of stage=value pairs.
+func parseStageOptions(s string) (map[string]string, error) {
+	options := make(map[string]string)
+	if s == "" {
+		return options, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		stage, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected stage=value, got %q", pair)
+		} else if _, ok := Enrichers[stage]; !ok {
+			return nil, fmt.Errorf("unknown stage %q", stage)
+		}
+		options[stage] = value
+	}
+	return options, nil
+}
+
+// enrichMain implements the enrich subcommand.
+func enrichMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("enrich", 4, 100*time.Millisecond)
+	names := make([]string, 0, len(Enrichers))
+	for name := range Enrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stageNames := fs.String("stages", "", "comma-separated stages to run, from "+strings.Join(names, ", "))
+	stageJobs := fs.String("stage-jobs", "", "per-stage overrides of -jobs, ex: commit-activity=1,languages=8")
+	stageInterval := fs.String("stage-interval", "", "per-stage overrides of -interval, ex: commit-activity=2s")
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	depsDevURL := fs.String("deps-dev-url", "https://api.deps.dev", "base URL of the deps.dev API, for the deps-dev stage")
+	scorecardURL := fs.String("scorecard-url", "https://api.securityscorecards.dev", "base URL of the OpenSSF Scorecard API, for the scorecard stage")
+	batchSize := fs.Int("batch-size", 1000, "number of repositories to run the stages over before writing their rows, bounding the results held in memory")
+	registries, registryNames := addRegistryFlags(fs.FlagSet)
+	maxValueLength := fs.Int("max-value-length", 0, "cut values longer than this many characters, ending them with …, so a single repository can't produce a huge row (0 for no limit)")
+	plugins := fs.String("plugins", "", "comma-separated Go plugins (.so) to load as additional stages named after the file")
+	repos := fs.parse(ctx, args)
+	if *plugins != "" {
+		for _, path := range strings.Split(*plugins, ",") {
+			name, enricher, err := LoadPlugin(path)
+			if err != nil {
+				log.Fatalf("Failed to load plugin: %v", err)
+			} else if _, ok := Enrichers[name]; ok {
+				log.Fatalf("Plugin %s conflicts with the %s stage", path, name)
+			}
+			Enrichers[name] = func(EnrichEnv) Enricher { return enricher }
+			*stageNames = strings.TrimPrefix(*stageNames+","+name, ",")
+		}
+	}
+	if *stageNames == "" || *batchSize < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	jobsByStage, err := parseStageOptions(*stageJobs)
+	if err != nil {
+		log.Fatalf("Invalid -stage-jobs: %v", err)
+	}
+	intervalByStage, err := parseStageOptions(*stageInterval)
+	if err != nil {
+		log.Fatalf("Invalid -stage-interval: %v", err)
+	}
+	searched, err := parseRegistries(*registryNames)
+	if err != nil {
+		log.Fatalf("Invalid -registries: %v", err)
+	}
+	transports, done := fs.transports(ctx)
+	defer done()
+	env := EnrichEnv{
+		GraphQL: NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql")),
+		REST:    NewHTTPClient(ctx, transports.REST, Token("rest")),
+		RESTURL: *restURL,
+		// The other services are unauthenticated, the GitHub token must not be sent to them
+		Client:        &http.Client{Transport: transports.Other},
+		DepsDevURL:    *depsDevURL,
+		ScorecardURL:  *scorecardURL,
+		Registries:    registries,
+		RegistryNames: searched,
+	}
+	registries.Client = env.Client
+
+	// Each stage runs concurrently with its own pool and pace over a batch at a time, whose rows are written in the
+	// order of the input before the next, so only the results of one batch are held. A repository that a stage finds
+	// no longer exists is marked deleted, with the time it was found to be, rather than dropped from the output.
+	var stages []EnrichStage
+	var enrichers []Enricher
+	for _, name := range strings.Split(*stageNames, ",") {
+		newEnricher, ok := Enrichers[name]
+		if !ok {
+			fatalf("Unknown stage: %q", name)
+		}
+		stage := EnrichStage{Name: name, Enricher: newEnricher(env), Jobs: *fs.Jobs, Interval: *fs.Interval}
+		if s, ok := jobsByStage[name]; ok {
+			if stage.Jobs, err = strconv.Atoi(s); err != nil || stage.Jobs < 1 {
+				fatalf("Invalid -stage-jobs for %s: %q", name, s)
+			}
+		}
+		if s, ok := intervalByStage[name]; ok {
+			if stage.Interval, err = time.ParseDuration(s); err != nil {
+				fatalf("Invalid -stage-interval for %s: %v", name, err)
+			}
+		}
+		stages = append(stages, stage)
+		enrichers = append(enrichers, stage.Enricher)
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write(enrichHeader(enrichers))
+	for _, batch := range batches(repos, *batchSize) {
+		if ctx.Err() != nil {
+			break
+		}
+		for _, record := range enrichBatch(ctx, stages, batch, *maxValueLength) {
+			w.Write(record)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			fatal(err)
+		}
+	}
+}
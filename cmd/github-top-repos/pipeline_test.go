@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+func TestIsRepositoryNotFound(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// body is the GraphQL response to a lookup of a repository
+		body string
+		want bool
+	}{
+		{"found", `{"data":{"repository":{"databaseId":1,"languages":{"edges":[]}}}}`, false},
+		{"not found", `{"data":{"repository":null},"errors":[{"type":"NOT_FOUND","path":["repository"],"message":"Could not resolve to a Repository with the name 'a/gone'."}]}`, true},
+		{"forbidden", `{"data":{"repository":null},"errors":[{"type":"FORBIDDEN","path":["repository"],"message":"Resource not accessible by integration"}]}`, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			client := NewClient(context.Background(), http.DefaultTransport, server.URL, "token")
+			_, _, err := FetchLanguages(context.Background(), client, "a/gone")
+			if got := IsRepositoryNotFound(err); got != tt.want {
+				t.Errorf("IsRepositoryNotFound(%v) = %t, want %t", err, got, tt.want)
+			}
+			// The error is still recognized once wrapped by a stage
+			if got := IsRepositoryNotFound(fmt.Errorf("stage: %w", err)); got != tt.want {
+				t.Errorf("IsRepositoryNotFound() of the wrapped %v = %t, want %t", err, got, tt.want)
+			}
+		})
+	}
+	if IsRepositoryNotFound(&RESTError{StatusCode: http.StatusNotFound, Body: `{"message":"Not Found"}`}) {
+		t.Error("a REST 404 is not known to be a deleted repository")
+	}
+}
+
+func TestLanguagesEnricher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":{"repository":{"databaseId":1,"languages":{"edges":[{"size":1234,"node":{"name":"Go"}},{"size":56,"node":{"name":"Shell"}}]}}}}`)
+	}))
+	defer server.Close()
+	client := NewClient(context.Background(), http.DefaultTransport, server.URL, "token")
+	values, err := languagesEnricher{client}.Enrich(context.Background(), ghsearch.Repository{NameWithOwner: "a/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same form as the languages column of a crawl
+	if want := "Go=1234;Shell=56"; len(values) != 1 || values[0] != want {
+		t.Errorf("Enrich() = %q, want %q", values, want)
+	}
+}
+
+func TestEnrichBatch(t *testing.T) {
+	fails := fakeEnricher{map[string]error{
+		"a/gone":   errors.New("Could not resolve to a Repository with the name 'a/gone'."),
+		"a/failed": errors.New("timeout"),
+	}}
+	stages := []EnrichStage{
+		{Name: "fails", Enricher: fails, Jobs: 3},
+		{Name: "length", Enricher: fakeEnricher{}, Jobs: 1},
+	}
+	var repos []ghsearch.Repository
+	for _, name := range []string{"a/x", "a/gone", "a/failed", "bb/y"} {
+		repos = append(repos, ghsearch.Repository{NameWithOwner: name})
+	}
+	records := enrichBatch(context.Background(), stages, repos, 0)
+	// The rows are in the order of the input, whichever stage finished first
+	var got []string
+	for _, record := range records {
+		deletedAt := record[len(record)-1]
+		if record[len(record)-2] == "true" {
+			if _, err := time.Parse(time.RFC3339, deletedAt); err != nil {
+				t.Errorf("deleted_at of %s: %v", record[0], err)
+			}
+			deletedAt = "<time>"
+		}
+		got = append(got, strings.Join(append(record[:len(record)-1], deletedAt), ","))
+	}
+	want := []string{
+		"a/x,3,3,false,",
+		"a/gone,,6,true,<time>",
+		"a/failed,,8,false,",
+		"bb/y,4,4,false,",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("enrichBatch() = %q, want %q", got, want)
+	}
+}
+
+func TestContributorsEnricher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/a/many/contributors":
+			if r.URL.Query().Get("per_page") != "1" || r.URL.Query().Get("anon") != "true" {
+				t.Errorf("listed contributors with %q", r.URL.RawQuery)
+			}
+			w.Header().Set("Link", `<https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=2>; rel="next", <https://api.github.com/repositories/1/contributors?per_page=1&anon=true&page=1234>; rel="last"`)
+			io.WriteString(w, `[{"login":"a"}]`)
+		case "/repos/a/one/contributors":
+			io.WriteString(w, `[{"login":"a"}]`)
+		case "/repos/a/empty/contributors":
+			w.WriteHeader(http.StatusNoContent)
+		case "/repos/a/large/contributors":
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message":"The history or contributor list is too large to list contributors for this repository via the API."}`)
+		}
+	}))
+	defer server.Close()
+	e := contributorsEnricher{server.Client(), server.URL}
+	for name, want := range map[string]string{"a/many": "1234", "a/one": "1", "a/empty": "0"} {
+		values, err := e.Enrich(context.Background(), ghsearch.Repository{NameWithOwner: name})
+		if err != nil {
+			t.Errorf("Enrich(%s): %v", name, err)
+		} else if len(values) != 1 || values[0] != want {
+			t.Errorf("Enrich(%s) = %q, want %q", name, values, want)
+		}
+	}
+	if values, err := e.Enrich(context.Background(), ghsearch.Repository{NameWithOwner: "a/large"}); err == nil {
+		t.Errorf("Enrich(a/large) = %q, want an error", values)
+	}
+}
+
+func TestScorecardEnricher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/github.com/a/scored":
+			io.WriteString(w, `{"date":"2024-03-25","repo":{"name":"github.com/a/scored"},"score":7.5,"checks":[]}`)
+		case "/projects/github.com/a/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	e := scorecardEnricher{server.Client(), server.URL}
+	for name, want := range map[string][]string{
+		"a/scored": {"7.5", "2024-03-25"},
+		// Only the repositories the project has scored have a scorecard
+		"a/unscored": {"", ""},
+	} {
+		values, err := e.Enrich(context.Background(), ghsearch.Repository{NameWithOwner: name})
+		if err != nil {
+			t.Errorf("Enrich(%s): %v", name, err)
+		} else if !reflect.DeepEqual(values, want) {
+			t.Errorf("Enrich(%s) = %q, want %q", name, values, want)
+		}
+	}
+	if values, err := e.Enrich(context.Background(), ghsearch.Repository{NameWithOwner: "a/broken"}); err == nil {
+		t.Errorf("Enrich(a/broken) = %q, want an error", values)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// pluginEnricher is an enrich stage loaded from a Go plugin, https://pkg.go.dev/plugin
+//
+// The plugin must export the column names and a function returning their values:
+//
+//	var Columns = []string{"my_column"}
+//	func Enrich(ctx context.Context, nameWithOwner string) ([]string, error)
+//
+// Plugins only use standard library types so they don't depend on this command,
+// but must be built with the same Go version as it.
+type pluginEnricher struct {
+	columns []string
+	enrich  func(ctx context.Context, nameWithOwner string) ([]string, error)
+}
+
+// LoadPlugin loads an Enricher from the Go plugin at path, named after the file.
+func LoadPlugin(path string) (string, Enricher, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	columns, err := p.Lookup("Columns")
+	if err != nil {
+		return "", nil, err
+	}
+	enrich, err := p.Lookup("Enrich")
+	if err != nil {
+		return "", nil, err
+	}
+	cols, ok := columns.(*[]string)
+	if !ok {
+		return "", nil, fmt.Errorf("%s: Columns is %T, not []string", path, columns)
+	}
+	e := &pluginEnricher{columns: *cols}
+	if e.enrich, ok = enrich.(func(context.Context, string) ([]string, error)); !ok {
+		return "", nil, fmt.Errorf("%s: Enrich is %T, not func(context.Context, string) ([]string, error)", path, enrich)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return name, e, nil
+}
+
+func (e *pluginEnricher) Columns() []string { return e.columns }
+
+func (e *pluginEnricher) Enrich(ctx context.Context, repo ghsearch.Repository) ([]string, error) {
+	values, err := e.enrich(ctx, repo.NameWithOwner)
+	if err != nil {
+		return nil, err
+	} else if len(values) != len(e.columns) {
+		return nil, fmt.Errorf("plugin returned %d values for %d columns", len(values), len(e.columns))
+	}
+	return values, nil
+}
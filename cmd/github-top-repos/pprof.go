@@ -0,0 +1,28 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+// ServePprof serves the runtime profiles at addr under /debug/pprof/ in the background, such as for
+// go tool pprof http://localhost:6060/debug/pprof/profile, and the expvar metrics such as sink_queue at /debug/vars.
+// They are served from their own mux on addr only, but importing net/http/pprof and expvar also registers the
+// same handlers on http.DefaultServeMux, so a server using it, which this tool doesn't start, would expose them too.
+func ServePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		log.Printf("Serving profiles at http://%s/debug/pprof/", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Failed to serve profiles: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// ProgressBar redraws a single terminal line with the progress of a crawl: batches completed,
+// repositories emitted out of the estimated total, the request rate and the estimated time left.
+// Log lines written through it are printed above the bar rather than breaking it.
+type ProgressBar struct {
+	w        io.Writer
+	requests func() int
+
+	mu       sync.Mutex
+	start    time.Time
+	progress ghsearch.Progress
+	// initial is what a restored checkpoint had already emitted, excluded from the rate of progress.
+	initial int
+	// rate is a moving average of requests per second.
+	rate         float64
+	lastRequests int
+	lastTick     time.Time
+	line         string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewProgressBar redraws a ProgressBar to w every interval until finished, starting from initial,
+// with the requests sent so far counted by requests.
+func NewProgressBar(w io.Writer, interval time.Duration, initial ghsearch.Progress, requests func() int) *ProgressBar {
+	now := time.Now()
+	pb := &ProgressBar{
+		w:        w,
+		requests: requests,
+		start:    now,
+		lastTick: now,
+		progress: initial,
+		initial:  initial.Emitted,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(pb.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				pb.tick(now)
+			case <-pb.stop:
+				return
+			}
+		}
+	}()
+	return pb
+}
+
+// Update records the progress of the crawl after a batch.
+func (pb *ProgressBar) Update(p ghsearch.Progress) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.progress = p
+}
+
+// render returns the line describing the progress at now.
+func (pb *ProgressBar) render(now time.Time) string {
+	p := pb.progress
+	const width = 30
+	var fraction float64
+	if p.Total > 0 {
+		fraction = min(float64(p.Emitted)/float64(p.Total), 1)
+	}
+	filled := int(fraction * width)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	eta := "?"
+	if done := p.Emitted - pb.initial; done > 0 && p.Total > p.Emitted {
+		left := float64(now.Sub(pb.start)) * float64(p.Total-p.Emitted) / float64(done)
+		eta = time.Duration(left).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %5.1f%% %d batches %d/%d repos %.1f req/s ETA %s", bar, 100*fraction, p.Batches, p.Emitted, p.Total, pb.rate, eta)
+}
+
+// tick updates the request rate and redraws the bar.
+func (pb *ProgressBar) tick(now time.Time) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	requests := pb.requests()
+	if elapsed := now.Sub(pb.lastTick).Seconds(); elapsed > 0 {
+		pb.rate = 0.7*pb.rate + 0.3*float64(requests-pb.lastRequests)/elapsed
+	}
+	pb.lastRequests, pb.lastTick = requests, now
+	pb.line = pb.render(now)
+	fmt.Fprintf(pb.w, "\r\033[K%s", pb.line)
+}
+
+// Write implements io.Writer for log output, clearing the bar, writing p and redrawing it below.
+func (pb *ProgressBar) Write(p []byte) (int, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if _, err := fmt.Fprintf(pb.w, "\r\033[K%s%s", p, pb.line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Finish stops redrawing, then draws the final progress and ends the line.
+func (pb *ProgressBar) Finish() {
+	close(pb.stop)
+	<-pb.done
+	pb.tick(time.Now())
+	fmt.Fprintln(pb.w)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// queryMain implements the query subcommands, lint and list.
+func queryMain(ctx context.Context, config *Config, args []string) {
+	if len(args) == 1 && args[0] == "list" {
+		for _, name := range sortedKeys(config.Queries) {
+			fmt.Printf("@%s\t%s\n", name, config.Queries[name])
+		}
+		return
+	} else if len(args) == 0 || args[0] != "lint" {
+		fmt.Fprintf(os.Stderr, "Usage: %s query lint [flags] (\"query\"|@name)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s query list\n", os.Args[0])
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("query lint", flag.ExitOnError)
+	field := fs.String("field", "stars", "field the query will be crawled by, stars, forks or size")
+	graphqlURL := fs.String("graphql-url", "", "send GraphQL requests to this URL, such as a caching proxy, defaults to GITHUB_GRAPHQL_URL")
+	githubURL := fs.String("github-url", "", "base URL of a GitHub Enterprise Server to query, such as https://github.example.com")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s query lint [flags] (\"query\"|@name)\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Checks the qualifiers of a query and reports how many repositories match, before crawling it.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	query, err := config.ResolveQuery(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := false
+	for _, issue := range ghsearch.LintQuery(query, *field) {
+		fmt.Println(issue)
+		failed = failed || !issue.Warning
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	// Count what the first batch would see, as GitHub rejects a query with no terms
+	token := Token("search")
+	if token == "" {
+		log.Printf("Not counting the results, set GITHUB_TOKEN to do so")
+		return
+	}
+	client := NewClient(ctx, http.DefaultTransport, GraphQLEndpoint(*graphqlURL, *githubURL), token)
+	_, count, err := ghsearch.Search(ctx, client, strings.TrimSpace(query+" "+*field+":>0"), 1)
+	if err != nil {
+		log.Fatalf("Failed to count the results: %v", err)
+	}
+	fmt.Printf("%d repositories match\n", count)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token returns the token for an API family (search, graphql or rest) from the
+// GITHUB_TOKEN_<FAMILY> environment variable, falling back to GITHUB_TOKEN then the config file.
+func Token(family string) string {
+	if token := os.Getenv("GITHUB_TOKEN_" + strings.ToUpper(family)); token != "" {
+		return token
+	} else if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return mustLoadConfig().Token
+}
+
+// RateTransport is a http.RoundTripper that spaces requests at least Interval apart.
+// Secondary rate limits apply per endpoint family, so each family has its own.
+type RateTransport struct {
+	Base     http.RoundTripper
+	Interval time.Duration
+	// Headroom, if set, records the time spent waiting.
+	Headroom *Headroom
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateTransport returns base limited to one request per interval, or base itself if interval is 0.
+func NewRateTransport(base http.RoundTripper, interval time.Duration, headroom *Headroom) http.RoundTripper {
+	if interval <= 0 {
+		return base
+	}
+	return &RateTransport{Base: base, Interval: interval, Headroom: headroom}
+}
+
+// SetInterval changes the minimum time between requests, from the next request onwards.
+func (t *RateTransport) SetInterval(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Interval = interval
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Reserve the next slot so concurrent requests queue up behind each other
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(t.Interval)
+	t.mu.Unlock()
+	if wait > 0 {
+		t.Headroom.Slept(wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	return t.Base.RoundTrip(req)
+}
+
+// ThresholdTransport is a http.RoundTripper that pauses once the primary rate limit remaining,
+// as reported by the X-RateLimit-Remaining header, falls to Threshold until the limit resets.
+// The limit is shared by every process using the token, so this leaves the points below the
+// threshold to a concurrent crawl rather than racing it for the last points of the hour. It
+// only pauses this process, whereas the Scheduler of a crawl run with -enrich orders the
+// requests of the two against each other.
+type ThresholdTransport struct {
+	Base      http.RoundTripper
+	Threshold int
+	// Headroom, if set, records the time spent waiting.
+	Headroom *Headroom
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+// NewThresholdTransport returns base pausing at threshold remaining points, or base itself if threshold is 0.
+func NewThresholdTransport(base http.RoundTripper, threshold int, headroom *Headroom) http.RoundTripper {
+	if threshold <= 0 {
+		return base
+	}
+	return &ThresholdTransport{Base: base, Threshold: threshold, Headroom: headroom, remaining: -1}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ThresholdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	exhausted, reset := t.remaining >= 0 && t.remaining <= t.Threshold, t.reset
+	t.mu.Unlock()
+	if wait := time.Until(reset); exhausted && wait > 0 {
+		log.Printf("Rate limit down to the threshold of %d points, pausing until %s", t.Threshold, reset.Format(time.RFC3339))
+		t.Headroom.Slept(wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return resp, nil
+	}
+	unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return resp, nil
+	}
+	t.mu.Lock()
+	t.remaining, t.reset = remaining, time.Unix(unix, 0)
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// PaceTransport is a http.RoundTripper that spaces requests so the primary rate limit remaining,
+// as reported by the X-RateLimit-Remaining and X-RateLimit-Reset headers, runs out as it resets.
+// Unlike a fixed Interval this adapts to the actual cost of each request, which for GraphQL is
+// often far lower than assumed, speeding up when points are left over and slowing when they are not.
+type PaceTransport struct {
+	Base http.RoundTripper
+	// Headroom, if set, records the time spent waiting.
+	Headroom *Headroom
+
+	mu       sync.Mutex
+	next     time.Time
+	interval time.Duration
+	// remaining and reset are of the last response, cost the average points per request.
+	remaining int
+	reset     time.Time
+	cost      float64
+}
+
+// NewPaceTransport returns base paced by its rate limit headers.
+func NewPaceTransport(base http.RoundTripper, headroom *Headroom) *PaceTransport {
+	return &PaceTransport{Base: base, Headroom: headroom, remaining: -1, cost: 1}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *PaceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Reserve the next slot so concurrent requests queue up behind each other
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.mu.Unlock()
+	if wait > 0 {
+		t.Headroom.Slept(wait)
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return resp, nil
+	}
+	unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return resp, nil
+	}
+	reset := time.Unix(unix, 0)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Within the same window the drop in remaining is what the request cost
+	if spent := t.remaining - remaining; t.remaining >= 0 && reset.Equal(t.reset) && spent > 0 {
+		t.cost = 0.8*t.cost + 0.2*float64(spent)
+	}
+	t.remaining, t.reset = remaining, reset
+	t.interval = 0
+	if until := time.Until(reset); until > 0 && remaining > 0 {
+		t.interval = time.Duration(float64(until) * t.cost / float64(remaining))
+	} else if until > 0 {
+		// Nothing is left, so nothing is sent until the reset
+		t.next = reset
+	}
+	return resp, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// readmeBlob is the text of a README at a given path, if it exists.
+type readmeBlob struct {
+	Blob struct {
+		Text string
+	} `graphql:"... on Blob"`
+}
+
+// FetchReadme returns the filename and text of the README at the default branch of a repository,
+// or an empty filename if there is none.
+func FetchReadme(ctx context.Context, client *githubv4.Client, nameWithOwner string) (string, string, error) {
+	owner, name, _ := strings.Cut(nameWithOwner, "/")
+	// https://docs.github.com/en/graphql/reference/objects#repository
+	var q struct {
+		Repository struct {
+			ReadmeMD       readmeBlob `graphql:"readmeMD: object(expression: \"HEAD:README.md\")"`
+			ReadmeLowerMD  readmeBlob `graphql:"readmeLowerMD: object(expression: \"HEAD:readme.md\")"`
+			ReadmeRST      readmeBlob `graphql:"readmeRST: object(expression: \"HEAD:README.rst\")"`
+			ReadmeMarkdown readmeBlob `graphql:"readmeMarkdown: object(expression: \"HEAD:README.markdown\")"`
+			Readme         readmeBlob `graphql:"readme: object(expression: \"HEAD:README\")"`
+		} `graphql:"repository(owner: $owner, name: $name)"`
+	}
+	if err := client.Query(ctx, &q, map[string]any{
+		"owner": githubv4.String(owner),
+		"name":  githubv4.String(name),
+	}); err != nil {
+		return "", "", err
+	}
+	for _, readme := range []struct {
+		filename string
+		blob     readmeBlob
+	}{
+		{"README.md", q.Repository.ReadmeMD},
+		{"readme.md", q.Repository.ReadmeLowerMD},
+		{"README.rst", q.Repository.ReadmeRST},
+		{"README.markdown", q.Repository.ReadmeMarkdown},
+		{"README", q.Repository.Readme},
+	} {
+		if readme.blob.Blob.Text != "" {
+			return readme.filename, readme.blob.Blob.Text, nil
+		}
+	}
+	return "", "", nil
+}
+
+// readmesMain implements the readmes subcommand.
+func readmesMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("readmes", 4, 100*time.Millisecond)
+	dir := fs.String("dir", "readmes", "directory to write READMEs into, as owner/name/README")
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql"))
+
+	// Repositories that already have a directory are skipped so an interrupted run can be resumed
+	target := func(repo ghsearch.Repository) string {
+		return filepath.Join(*dir, repo.NameWithOwner)
+	}
+	pending := skipExisting(repos, target)
+	var fetched, missing, failed atomic.Int64
+	forEachParallel(ctx, pending, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		filename, text, err := FetchReadme(ctx, client, repo.NameWithOwner)
+		if err == nil && filename == "" {
+			missing.Add(1)
+			return
+		}
+		if err == nil {
+			if err = os.MkdirAll(target(repo), 0755); err == nil {
+				err = os.WriteFile(filepath.Join(target(repo), filename), []byte(text), 0644)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to fetch README of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		fetched.Add(1)
+	})
+	log.Printf("Fetched %d, missing %d, skipped %d, failed %d READMEs", fetched.Load(), missing.Load(), len(repos)-len(pending), failed.Load())
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+	"github.com/shurcooL/githubv4"
+)
+
+// RefreshedRepository is the current state of a repository that changes after it is crawled.
+// https://docs.github.com/en/graphql/reference/objects#repository
+type RefreshedRepository struct {
+	DatabaseId     int
+	StargazerCount int
+	ForkCount      int
+	PushedAt       time.Time
+	IsArchived     bool
+}
+
+// refreshQuery returns the type of a query of the repositories named by the variables owner0, name0, owner1...,
+// each aliased as r0, r1... and null if it no longer exists or can't be seen.
+func refreshQuery(n int) reflect.Type {
+	fields := make([]reflect.StructField, n)
+	for i := range fields {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("R%d", i),
+			Type: reflect.TypeOf(&RefreshedRepository{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"r%d: repository(owner: $owner%d, name: $name%d)"`, i, i, i)),
+		}
+	}
+	return reflect.StructOf(fields)
+}
+
+// FetchRefreshed returns the current state of each of the repositories in a single query, nil for any that can't
+// be resolved. Repositories that were resolved are returned along with an error for those that were not.
+func FetchRefreshed(ctx context.Context, client *githubv4.Client, repos []ghsearch.Repository) ([]*RefreshedRepository, error) {
+	q := reflect.New(refreshQuery(len(repos)))
+	variables := make(map[string]any, 2*len(repos))
+	for i, repo := range repos {
+		owner, name, _ := strings.Cut(repo.NameWithOwner, "/")
+		variables[fmt.Sprintf("owner%d", i)] = githubv4.String(owner)
+		variables[fmt.Sprintf("name%d", i)] = githubv4.String(name)
+	}
+	// The data of the resolved repositories is still decoded if others fail
+	err := client.Query(ctx, q.Interface(), variables)
+	refreshed := make([]*RefreshedRepository, len(repos))
+	for i := range refreshed {
+		refreshed[i] = q.Elem().Field(i).Interface().(*RefreshedRepository)
+	}
+	return refreshed, err
+}
+
+// batches splits repos into batches of at most size.
+func batches(repos []ghsearch.Repository, size int) [][]ghsearch.Repository {
+	var batches [][]ghsearch.Repository
+	for len(repos) > size {
+		batches = append(batches, repos[:size])
+		repos = repos[size:]
+	}
+	if len(repos) > 0 {
+		batches = append(batches, repos)
+	}
+	return batches
+}
+
+// RefreshedRow is a row of the refresh output, named as the columns of a crawl.
+type RefreshedRow struct {
+	NameWithOwner string    `json:"name_with_owner"`
+	DatabaseID    int       `json:"database_id"`
+	Stars         int       `json:"stars"`
+	Forks         int       `json:"forks"`
+	PushedAt      time.Time `json:"pushed_at"`
+	IsArchived    bool      `json:"is_archived"`
+}
+
+// refreshBatch returns the rows of the repositories of batch that still exist, and the number that no longer do or
+// can't be seen. It returns an error instead if the batch failed as a whole, such as the request or response, so a
+// failure is never taken for the repositories being gone.
+func refreshBatch(ctx context.Context, client *githubv4.Client, batch []ghsearch.Repository) ([]RefreshedRow, int, error) {
+	current, err := FetchRefreshed(ctx, client, batch)
+	var rows []RefreshedRow
+	for i, repo := range current {
+		if repo != nil {
+			rows = append(rows, RefreshedRow{batch[i].NameWithOwner, repo.DatabaseId, repo.StargazerCount,
+				repo.ForkCount, repo.PushedAt, repo.IsArchived})
+		}
+	}
+	// Errors of only some repositories still come with the others, and those not found are why they are missing
+	if err != nil && len(rows) == 0 && !IsRepositoryNotFound(err) {
+		return nil, 0, err
+	} else if err != nil {
+		log.Printf("Failed to refresh some of %d repositories from %s: %v", len(batch), batch[0].NameWithOwner, err)
+	}
+	return rows, len(batch) - len(rows), nil
+}
+
+// RefreshWriter writes the rows of the refresh output as CSV with a header row, or ndjson.
+type RefreshWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+	w    *bufio.Writer
+}
+
+// NewRefreshWriter returns a RefreshWriter to w in format, csv or ndjson.
+func NewRefreshWriter(w io.Writer, format string) (*RefreshWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "csv":
+		rw := &RefreshWriter{csv: csv.NewWriter(bw), w: bw}
+		rw.csv.Write([]string{"name_with_owner", "database_id", "stars", "forks", "pushed_at", "is_archived"})
+		return rw, nil
+	case "ndjson":
+		rw := &RefreshWriter{json: json.NewEncoder(bw), w: bw}
+		rw.json.SetEscapeHTML(false)
+		return rw, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// Write writes row.
+func (rw *RefreshWriter) Write(row RefreshedRow) error {
+	if rw.json != nil {
+		return rw.json.Encode(row)
+	}
+	return rw.csv.Write([]string{row.NameWithOwner, FormatInt(row.DatabaseID), FormatInt(row.Stars),
+		FormatInt(row.Forks), FormatTime(row.PushedAt), FormatBool(row.IsArchived)})
+}
+
+// Flush writes any buffered rows.
+func (rw *RefreshWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		if err := rw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return rw.w.Flush()
+}
+
+// refreshMain implements the refresh subcommand.
+func refreshMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("refresh", 2, 500*time.Millisecond)
+	batchSize := fs.Int("batch-size", 100, "number of repositories fetched by each GraphQL query")
+	outputPath := fs.String("output", "", "write the output to this file instead of stdout, as a .partial file renamed into place once every batch is written")
+	outputFormat := fs.String("output-format", "csv", "output format, csv (with a header row) or ndjson (one JSON object per line)")
+	repos := fs.parse(ctx, args)
+	if *batchSize < 1 {
+		log.Fatalf("Invalid -batch-size: %d", *batchSize)
+	}
+	var out io.Writer = os.Stdout
+	var file *AtomicFile
+	if *outputPath != "" {
+		var err error
+		if file, err = CreateAtomic(*outputPath, false); err != nil {
+			log.Fatal(err)
+		}
+		out = file
+	}
+	w, err := NewRefreshWriter(out, *outputFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewClient(ctx, transports.GraphQL, *fs.GraphQLURL, Token("graphql"))
+
+	// Rows are in the order the batches complete. The repositories of a batch that failed as a whole are counted
+	// apart from those that are missing, as nothing is known of them.
+	var mu sync.Mutex
+	var writeErr error
+	var refreshed, missing, failed, failedBatches atomic.Int64
+	forEachParallel(ctx, batches(repos, *batchSize), *fs.Jobs, *fs.Interval, func(batch []ghsearch.Repository) {
+		rows, n, err := refreshBatch(ctx, client, batch)
+		if err != nil {
+			log.Printf("Failed to refresh %d repositories from %s: %v", len(batch), batch[0].NameWithOwner, err)
+			failed.Add(int64(len(batch)))
+			failedBatches.Add(1)
+			return
+		}
+		missing.Add(int64(n))
+		mu.Lock()
+		defer mu.Unlock()
+		for _, row := range rows {
+			if err := w.Write(row); err != nil && writeErr == nil {
+				writeErr = err
+			}
+			refreshed.Add(1)
+		}
+		if err := w.Flush(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	})
+	if writeErr != nil {
+		fatal(writeErr)
+	}
+	log.Printf("Refreshed %d and missing %d of %d repositories, with %d more in %d failed batches", refreshed.Load(), missing.Load(), len(repos), failed.Load(), failedBatches.Load())
+	if err := ctx.Err(); err != nil {
+		fatal(err)
+	}
+	if file != nil {
+		if err := file.Commit(); err != nil {
+			fatal(err)
+		}
+	}
+	if n := failedBatches.Load(); n > 0 {
+		fatalf("%d batches failed, their repositories are not in the output", n)
+	}
+}
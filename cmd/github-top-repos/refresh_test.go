@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+func TestRefreshBatch(t *testing.T) {
+	batch := []ghsearch.Repository{{NameWithOwner: "a/x"}, {NameWithOwner: "a/gone"}}
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		// rows is the number of rows refreshed and missing the number of the rest, or -1 if the batch failed
+		rows, missing int
+	}{
+		{
+			name: "all found",
+			body: `{"data":{"r0":{"databaseId":1,"stargazerCount":10},"r1":{"databaseId":2,"stargazerCount":20}}}`,
+			rows: 2,
+		},
+		{
+			name:    "one gone",
+			body:    `{"data":{"r0":{"databaseId":1,"stargazerCount":10},"r1":null},"errors":[{"type":"NOT_FOUND","path":["r1"],"message":"Could not resolve to a Repository with the name 'a/gone'."}]}`,
+			rows:    1,
+			missing: 1,
+		},
+		{
+			name:    "all gone",
+			body:    `{"data":{"r0":null,"r1":null},"errors":[{"type":"NOT_FOUND","path":["r0"],"message":"Could not resolve to a Repository with the name 'a/x'."}]}`,
+			missing: 2,
+		},
+		// Failures of the whole batch are not taken for the repositories being gone
+		{name: "bad gateway", status: http.StatusBadGateway, body: `{"message":"Server Error"}`, missing: -1},
+		{name: "timeout", body: `{"data":null,"errors":[{"message":"Something went wrong while executing your query. This may be the result of a timeout."}]}`, missing: -1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			client := NewClient(context.Background(), http.DefaultTransport, server.URL, "token")
+			rows, missing, err := refreshBatch(context.Background(), client, batch)
+			if tt.missing < 0 {
+				if err == nil {
+					t.Errorf("refreshBatch() = %d rows, %d missing, want an error", len(rows), missing)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.rows || missing != tt.missing {
+				t.Errorf("refreshBatch() = %d rows, %d missing, want %d, %d", len(rows), missing, tt.rows, tt.missing)
+			}
+		})
+	}
+}
+
+func TestRefreshWriter(t *testing.T) {
+	row := RefreshedRow{"a/x", 1, 10, 2, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), true}
+	for format, want := range map[string]string{
+		"csv":    "name_with_owner,database_id,stars,forks,pushed_at,is_archived\na/x,1,10,2,2024-03-01T12:00:00Z,true\n",
+		"ndjson": `{"name_with_owner":"a/x","database_id":1,"stars":10,"forks":2,"pushed_at":"2024-03-01T12:00:00Z","is_archived":true}` + "\n",
+	} {
+		var buf bytes.Buffer
+		w, err := NewRefreshWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s output:\n%s\nwant:\n%s", format, got, want)
+		}
+	}
+	if _, err := NewRefreshWriter(io.Discard, "parquet"); err == nil {
+		t.Error("NewRefreshWriter(parquet) succeeded")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// errRegistryNotFound is returned when a registry has no package of the requested name.
+var errRegistryNotFound = errors.New("package not found")
+
+// RegistryPackage is a package found on a registry for a repository.
+type RegistryPackage struct {
+	Registry string
+	Name     string
+	// Downloads is the number of downloads in DownloadsPeriod, as reported by the registry.
+	Downloads       int
+	DownloadsPeriod string
+}
+
+// Registries looks up packages on npm, PyPI and crates.io.
+type Registries struct {
+	Client       *http.Client
+	NPMURL       string
+	NPMStatsURL  string
+	PyPIURL      string
+	PyPIStatsURL string
+	CratesURL    string
+}
+
+// get decodes the JSON response of url into v.
+func (r *Registries) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// crates.io requires a User-Agent identifying the client
+	req.Header.Set("User-Agent", "github-top-repos (https://github.com/bored-engineer/github-top-repos)")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errRegistryNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-200 OK status code: %v", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// pointsTo reports whether a repository URL from a registry refers to nameWithOwner on GitHub.
+func pointsTo(repoURL, nameWithOwner string) bool {
+	repoURL = strings.TrimSuffix(strings.ToLower(repoURL), ".git")
+	return strings.HasSuffix(repoURL, "github.com/"+strings.ToLower(nameWithOwner)) ||
+		strings.Contains(repoURL, "github.com/"+strings.ToLower(nameWithOwner)+"/")
+}
+
+// Lookup finds a package named name on registry that declares nameWithOwner as its repository.
+// It returns nil if there is no such package.
+func (r *Registries) Lookup(ctx context.Context, registry, name, nameWithOwner string) (*RegistryPackage, error) {
+	pkg := &RegistryPackage{Registry: registry, Name: name}
+	var err error
+	switch registry {
+	case "npm":
+		var meta struct {
+			Repository struct {
+				URL string `json:"url"`
+			} `json:"repository"`
+		}
+		if err = r.get(ctx, r.NPMURL+"/"+url.PathEscape(name), &meta); err == nil {
+			if !pointsTo(meta.Repository.URL, nameWithOwner) {
+				return nil, nil
+			}
+			var stats struct {
+				Downloads int `json:"downloads"`
+			}
+			err = r.get(ctx, r.NPMStatsURL+"/downloads/point/last-month/"+url.PathEscape(name), &stats)
+			pkg.Downloads, pkg.DownloadsPeriod = stats.Downloads, "last-month"
+		}
+	case "pypi":
+		var meta struct {
+			Info struct {
+				HomePage    string            `json:"home_page"`
+				ProjectURLs map[string]string `json:"project_urls"`
+			} `json:"info"`
+		}
+		if err = r.get(ctx, r.PyPIURL+"/pypi/"+url.PathEscape(name)+"/json", &meta); err == nil {
+			found := pointsTo(meta.Info.HomePage, nameWithOwner)
+			for _, u := range meta.Info.ProjectURLs {
+				found = found || pointsTo(u, nameWithOwner)
+			}
+			if !found {
+				return nil, nil
+			}
+			var stats struct {
+				Data struct {
+					LastMonth int `json:"last_month"`
+				} `json:"data"`
+			}
+			err = r.get(ctx, r.PyPIStatsURL+"/api/packages/"+url.PathEscape(strings.ToLower(name))+"/recent", &stats)
+			pkg.Downloads, pkg.DownloadsPeriod = stats.Data.LastMonth, "last-month"
+		}
+	case "crates":
+		var meta struct {
+			Crate struct {
+				Repository      string `json:"repository"`
+				RecentDownloads int    `json:"recent_downloads"`
+			} `json:"crate"`
+		}
+		if err = r.get(ctx, r.CratesURL+"/api/v1/crates/"+url.PathEscape(name), &meta); err == nil {
+			if !pointsTo(meta.Crate.Repository, nameWithOwner) {
+				return nil, nil
+			}
+			pkg.Downloads, pkg.DownloadsPeriod = meta.Crate.RecentDownloads, "last-90-days"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported registry: %q", registry)
+	}
+	if errors.Is(err, errRegistryNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// addRegistryFlags defines the flags of the registries to search on fs, returning the Registries, without a
+// Client, and the comma-separated registries to search.
+func addRegistryFlags(fs *flag.FlagSet) (*Registries, *string) {
+	registries := fs.String("registries", "npm,pypi,crates", "comma-separated registries to search, from npm, pypi and crates")
+	r := &Registries{}
+	fs.StringVar(&r.NPMURL, "npm-url", "https://registry.npmjs.org", "base URL of the npm registry")
+	fs.StringVar(&r.NPMStatsURL, "npm-stats-url", "https://api.npmjs.org", "base URL of the npm download counts API")
+	fs.StringVar(&r.PyPIURL, "pypi-url", "https://pypi.org", "base URL of the PyPI JSON API")
+	fs.StringVar(&r.PyPIStatsURL, "pypi-stats-url", "https://pypistats.org", "base URL of the PyPI download stats API")
+	fs.StringVar(&r.CratesURL, "crates-url", "https://crates.io", "base URL of the crates.io API")
+	return r, registries
+}
+
+// parseRegistries parses a comma-separated list of registries, from npm, pypi and crates.
+func parseRegistries(s string) ([]string, error) {
+	names := strings.Split(s, ",")
+	for _, name := range names {
+		switch name {
+		default:
+			return nil, fmt.Errorf("unsupported registry: %q", name)
+		case "npm", "pypi", "crates":
+		}
+	}
+	return names, nil
+}
+
+// registriesMain implements the registries subcommand.
+func registriesMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("registries", 4, 100*time.Millisecond)
+	r, registries := addRegistryFlags(fs.FlagSet)
+	repos := fs.parse(ctx, args)
+	names, err := parseRegistries(*registries)
+	if err != nil {
+		log.Fatalf("Invalid -registries: %v", err)
+	}
+	transports, done := fs.transports(ctx)
+	defer done()
+	// The registries are unauthenticated, the GitHub token must not be sent to them
+	r.Client = &http.Client{Transport: transports.Other}
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name_with_owner", "registry", "package", "downloads", "downloads_period"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		// Packages are matched by the repository name and confirmed by their repository URL
+		_, name, _ := strings.Cut(repo.NameWithOwner, "/")
+		for _, registry := range names {
+			pkg, err := r.Lookup(ctx, registry, strings.ToLower(name), repo.NameWithOwner)
+			if err != nil {
+				log.Printf("Failed to search %s for %s: %v", registry, repo.NameWithOwner, err)
+				failed.Add(1)
+				continue
+			} else if pkg == nil {
+				continue
+			}
+			mu.Lock()
+			w.Write([]string{repo.NameWithOwner, pkg.Registry, pkg.Name, FormatInt(pkg.Downloads), pkg.DownloadsPeriod})
+			w.Flush()
+			mu.Unlock()
+		}
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed %d registry searches", n)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateConfig is a file of family=interval lines, such as search=2s, that sets the
+// minimum time between requests of each API family while a long crawl is running,
+// and a concurrency=N line setting how many requests it makes at once.
+type RateConfig struct {
+	Path string
+	// Transports are the rate limiters of each family that may be reconfigured.
+	Transports map[string]*RateTransport
+	// Concurrency, if set, is called with the value of any concurrency line.
+	Concurrency func(n int)
+}
+
+// Reload reads the file and applies the interval of each family listed in it.
+func (c *RateConfig) Reload() error {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	intervals := make(map[*RateTransport]time.Duration)
+	var concurrency int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		family, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s: expected family=interval, got %q", c.Path, line)
+		}
+		family, value = strings.TrimSpace(family), strings.TrimSpace(value)
+		if family == "concurrency" {
+			if c.Concurrency == nil {
+				continue
+			} else if concurrency, err = strconv.Atoi(value); err != nil || concurrency < 1 {
+				return fmt.Errorf("%s: expected a concurrency of at least 1, got %q", c.Path, value)
+			}
+			continue
+		}
+		t, ok := c.Transports[family]
+		if !ok {
+			// The same file may be shared with commands using other families
+			continue
+		}
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.Path, err)
+		}
+		intervals[t] = interval
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// Only apply a file that parsed completely
+	for t, interval := range intervals {
+		t.SetInterval(interval)
+	}
+	for family, t := range c.Transports {
+		if interval, ok := intervals[t]; ok {
+			log.Printf("Minimum time between %s requests is now %s", family, interval)
+		}
+	}
+	if concurrency > 0 {
+		c.Concurrency(concurrency)
+		log.Printf("Concurrency is now %d", concurrency)
+	}
+	return nil
+}
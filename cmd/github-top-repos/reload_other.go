@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// ReloadOnSignal does nothing, as there is no SIGHUP to reload the configuration with.
+func (c *RateConfig) ReloadOnSignal(ctx context.Context) {}
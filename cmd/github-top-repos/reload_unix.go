@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReloadOnSignal reloads the configuration on every SIGHUP in the background until ctx is done.
+// SIGHUP stops the process no longer once it returns.
+func (c *RateConfig) ReloadOnSignal(ctx context.Context) {
+	hangupReloads.Store(true)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := c.Reload(); err != nil {
+					log.Printf("Failed to reload the rate configuration: %v", err)
+				}
+			}
+		}
+	}()
+}
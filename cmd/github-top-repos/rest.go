@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// linkNext and linkLast extract the next and last page URLs from a Link header.
+var (
+	linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+	linkLast = regexp.MustCompile(`<([^>]+)>;\s*rel="last"`)
+)
+
+// restGet performs a GET of a GitHub REST API URL, decoding the JSON response into v.
+// It returns the URL of the next page of results, if any. Rate limits are left to the
+// retry transport of the client, which waits for them to reset.
+func restGet(ctx context.Context, client *http.Client, url string, v any) (string, error) {
+	resp, err := restDo(ctx, client, url)
+	if err != nil {
+		return "", err
+	}
+	return restDecode(resp, v)
+}
+
+// restDo sends a GET of a GitHub REST API URL.
+func restDo(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return client.Do(req)
+}
+
+// restLastPage performs a GET of a GitHub REST API URL as restGet does, returning the number of the last page of
+// results from the Link header, or 1 if there is only the one. With one element per page it is their total.
+func restLastPage(ctx context.Context, client *http.Client, rawURL string, v any) (int, error) {
+	resp, err := restDo(ctx, client, rawURL)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := restDecode(resp, v); err != nil {
+		return 0, err
+	}
+	m := linkLast.FindStringSubmatch(resp.Header.Get("Link"))
+	if m == nil {
+		return 1, nil
+	}
+	last, err := url.Parse(m[1])
+	if err != nil {
+		return 0, err
+	}
+	page, err := strconv.Atoi(last.Query().Get("page"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid last page %q", m[1])
+	}
+	return page, nil
+}
+
+// restDecode decodes a REST API response into v, returning the next page URL.
+func restDecode(resp *http.Response, v any) (string, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &RESTError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", err
+	}
+	if m := linkNext.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+		return m[1], nil
+	}
+	return "", nil
+}
+
+// RESTError is a non-200 OK response from the GitHub REST API.
+type RESTError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements error.
+func (e *RESTError) Error() string {
+	return fmt.Sprintf("non-200 OK status code: %d body: %q", e.StatusCode, e.Body)
+}
+
+// restCount counts the elements of a paginated GitHub REST API array.
+func restCount(ctx context.Context, client *http.Client, url string) (int, error) {
+	var count int
+	for url != "" {
+		var page []json.RawMessage
+		var err error
+		if url, err = restGet(ctx, client, url, &page); err != nil {
+			return 0, err
+		}
+		count += len(page)
+	}
+	return count, nil
+}
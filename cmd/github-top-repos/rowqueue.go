@@ -0,0 +1,121 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// sinkQueueMetrics are the metrics of the RowQueue, served at /debug/vars by -pprof-addr.
+var sinkQueueMetrics = expvar.NewMap("sink_queue")
+
+// queuedRow is a row waiting to be written, or a Commit waiting for the rows before it if commit is set.
+type queuedRow struct {
+	row    ghsearch.Row
+	commit chan error
+}
+
+// RowQueue writes rows to a RowWriter in the background, so the crawl can fetch the next batch while a slow sink
+// writes the last. The queue is bounded: once it holds its capacity of rows, Write blocks until the sink catches up
+// rather than buffering without limit.
+type RowQueue struct {
+	next RowWriter
+	rows chan queuedRow
+	done chan struct{}
+
+	mu  sync.Mutex
+	err error
+
+	maxDepth atomic.Int64
+	blocked  atomic.Int64
+}
+
+// NewRowQueue returns a RowQueue of capacity rows writing to next, which must not be used until the queue is closed.
+func NewRowQueue(next RowWriter, capacity int) *RowQueue {
+	q := &RowQueue{
+		next: next,
+		rows: make(chan queuedRow, capacity),
+		done: make(chan struct{}),
+	}
+	sinkQueueMetrics.Set("capacity", expvar.Func(func() any { return cap(q.rows) }))
+	sinkQueueMetrics.Set("depth", expvar.Func(func() any { return len(q.rows) }))
+	sinkQueueMetrics.Set("max_depth", expvar.Func(func() any { return q.maxDepth.Load() }))
+	sinkQueueMetrics.Set("blocked_seconds", expvar.Func(func() any { return time.Duration(q.blocked.Load()).Seconds() }))
+	go q.run()
+	return q
+}
+
+// run writes the queued rows until the queue is closed, dropping them after the first error.
+func (q *RowQueue) run() {
+	defer close(q.done)
+	for item := range q.rows {
+		err := q.Err()
+		if item.commit != nil {
+			if err == nil {
+				err = q.next.Commit()
+			}
+			item.commit <- err
+		} else if err == nil {
+			err = q.next.Write(item.row)
+		}
+		if err != nil {
+			q.mu.Lock()
+			q.err = err
+			q.mu.Unlock()
+		}
+	}
+}
+
+// Err returns the first error of the sink.
+func (q *RowQueue) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// Write queues row, blocking while the queue is full. It returns the first error of the sink for any earlier row.
+func (q *RowQueue) Write(row ghsearch.Row) error {
+	if err := q.Err(); err != nil {
+		return err
+	}
+	q.push(queuedRow{row: row})
+	if depth := int64(len(q.rows)); depth > q.maxDepth.Load() {
+		// Only the crawl writes, so the maximum can't race
+		q.maxDepth.Store(depth)
+	}
+	return nil
+}
+
+// push queues item, counting the time blocked on a full queue.
+func (q *RowQueue) push(item queuedRow) {
+	select {
+	case q.rows <- item:
+	default:
+		start := time.Now()
+		q.rows <- item
+		q.blocked.Add(int64(time.Since(start)))
+	}
+}
+
+// Commit waits for every queued row to be written, then commits the sink.
+func (q *RowQueue) Commit() error {
+	commit := make(chan error, 1)
+	q.push(queuedRow{commit: commit})
+	return <-commit
+}
+
+// Close waits for every queued row to be written, returning the first error of the sink. The sink isn't closed.
+func (q *RowQueue) Close() error {
+	close(q.rows)
+	<-q.done
+	return q.Err()
+}
+
+// Summary describes how full the queue got and how long the crawl waited on the sink.
+func (q *RowQueue) Summary() string {
+	return fmt.Sprintf("max depth %d of %d, blocked for %s", q.maxDepth.Load(), cap(q.rows), time.Duration(q.blocked.Load()).Round(time.Millisecond))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// RunConfig is everything that decides the rows of a crawl, as opposed to how it is run,
+// so two crawls with the same RunConfig at the same time produce the same dataset.
+// The created range is as given by the flags, as resolving it against the time of the run would never match.
+type RunConfig struct {
+	Field   string `json:"field"`
+	Order   string `json:"order"`
+	SliceBy string `json:"slice_by,omitempty"`
+	Query   string `json:"query"`
+	// Start, End, EndInclusive, EndLag and Ranges are the flags of the same name.
+	Start        string        `json:"start,omitempty"`
+	End          string        `json:"end,omitempty"`
+	EndInclusive bool          `json:"end_inclusive,omitempty"`
+	EndLag       time.Duration `json:"end_lag,omitempty"`
+	Ranges       []string      `json:"ranges,omitempty"`
+	// Settle is the -settle span the start is moved back by.
+	Settle string `json:"settle,omitempty"`
+	// LastMonth is the month crawled by -last-month, such as 2006-01.
+	LastMonth string `json:"last_month,omitempty"`
+	// Update is the file updated by -update, whose latest repository decides the start instead.
+	Update       string `json:"update,omitempty"`
+	OutputFormat string `json:"output_format"`
+	Fields       string `json:"fields"`
+	Columns      string `json:"columns,omitempty"`
+	Languages    int    `json:"languages"`
+	Limit        int    `json:"limit"`
+	WindowLimit  int    `json:"window_limit,omitempty"`
+	// Window is the granularity of the windows, which only decides the rows if WindowLimit is set.
+	Window   string `json:"window,omitempty"`
+	MinStars int    `json:"min_stars"`
+	// Filters are the values of the flags that drop or annotate rows.
+	Filters map[string]string `json:"filters"`
+}
+
+// Bounded reports whether the config crawls a fixed created range, so an identical run would crawl the same
+// repositories. Without an end, or with a date relative to the time of the run such as -30d, the range moves
+// with each run, and an -update starts from the latest repository of its file.
+func (rc RunConfig) Bounded() bool {
+	if rc.Update != "" {
+		return false
+	} else if rc.LastMonth != "" {
+		return true
+	} else if len(rc.Ranges) > 0 {
+		for _, r := range rc.Ranges {
+			start, end, ok := strings.Cut(r, "..")
+			if !ok {
+				start, end, _ = strings.Cut(r, ":")
+			}
+			if !isAbsoluteDate(start) || !isAbsoluteDate(end) {
+				return false
+			}
+		}
+		return true
+	}
+	return isAbsoluteDate(rc.End) && (rc.Start == "" || isAbsoluteDate(rc.Start))
+}
+
+// isAbsoluteDate reports whether s is a date or time as accepted by ParseDate that doesn't depend on when it is parsed.
+func isAbsoluteDate(s string) bool {
+	if _, err := time.Parse(time.DateOnly, s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// ID is a hash of the config identifying the run.
+func (rc RunConfig) ID() string {
+	b, err := json.Marshal(rc)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RunRecord is written to the runs directory when a run completes.
+type RunRecord struct {
+	ID     string    `json:"id"`
+	Config RunConfig `json:"config"`
+	// Ranges are the created ranges the config resolved to when it was run, unbounded where zero.
+	Ranges    []ghsearch.CreatedRange `json:"ranges"`
+	Started   time.Time               `json:"started"`
+	Completed time.Time               `json:"completed"`
+	// Build is the binary that ran it.
+	Build BuildInfo `json:"build"`
+	// Skipped counts the repositories found by search that GitHub failed to resolve, by error type.
+	Skipped map[string]int `json:"skipped,omitempty"`
+}
+
+// LoadRunRecord returns the record of the completed run id in dir, or nil if there is none.
+func LoadRunRecord(dir, id string) (*RunRecord, error) {
+	b, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var rec RunRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Save writes the record to dir, named by its ID.
+func (rec *RunRecord) Save(dir string) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, rec.ID+".json"), append(b, '\n'), 0644)
+}
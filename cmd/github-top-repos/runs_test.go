@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRecordBuild(t *testing.T) {
+	dir := t.TempDir()
+	build := BuildInfo{Version: "v1.2.3", Commit: "abc123", Date: "2024-03-01T00:00:00Z", Modified: true}
+	rec := &RunRecord{ID: "run", Started: time.Now().UTC(), Completed: time.Now().UTC(), Build: build}
+	if err := rec.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"version": "v1.2.3"`; !strings.Contains(string(b), want) {
+		t.Errorf("saved record has no %s:\n%s", want, b)
+	}
+	loaded, err := LoadRunRecord(dir, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Build != build {
+		t.Errorf("loaded build %+v, want %+v", loaded.Build, build)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Priority is the order in which a Scheduler admits requests waiting at the same time, lowest first.
+type Priority int
+
+const (
+	// SearchPriority is of the searches of a crawl, which are never held back for enrichment.
+	SearchPriority Priority = iota
+	// EnrichPriority is of the enrich stages run alongside a crawl, which only use the points it leaves.
+	EnrichPriority
+	numPriorities
+)
+
+// Scheduler admits the GraphQL requests of a crawl and of the enrich stages run alongside it, which share the
+// hourly rate limit of the token, keeping the points they use under Ceiling. Waiting searches are admitted
+// before any enrichment, and enrichment stops Reserve points short of the ceiling so the crawl can complete.
+// The points used are those reported by the X-RateLimit-* headers of each response, counting each request
+// still in flight as a point, so they include the use of any other process sharing the token.
+type Scheduler struct {
+	// Ceiling is the most points to use in an hour, or the limit of the token if 0 or more.
+	Ceiling int
+	// Reserve is the points below Ceiling that only searches are admitted to use.
+	Reserve int
+	// Headroom, if set, records the time spent waiting for the window to reset.
+	Headroom *Headroom
+
+	mu       sync.Mutex
+	limit    int
+	used     int
+	reset    time.Time
+	inFlight int
+	waiting  [numPriorities]int
+	// wake is closed, and replaced, whenever a request may have become admissible.
+	wake chan struct{}
+}
+
+// budget returns the points that requests of p may use, -1 if the limit is not known yet.
+func (s *Scheduler) budget(p Priority) int {
+	if s.limit == 0 {
+		return -1
+	}
+	budget := s.limit
+	if s.Ceiling > 0 && s.Ceiling < budget {
+		budget = s.Ceiling
+	}
+	if p != SearchPriority {
+		budget -= s.Reserve
+	}
+	return budget
+}
+
+// admissible reports whether a request of p can be sent at now, otherwise when it can next be.
+func (s *Scheduler) admissible(p Priority, now time.Time) (bool, time.Time) {
+	if !s.reset.IsZero() && !now.Before(s.reset) {
+		// The window has reset, so nothing is used until a response says otherwise
+		s.used, s.reset = 0, time.Time{}
+	}
+	for q := Priority(0); q < p; q++ {
+		if s.waiting[q] > 0 {
+			return false, time.Time{}
+		}
+	}
+	if budget := s.budget(p); budget >= 0 && s.used+s.inFlight >= budget {
+		return false, s.reset
+	}
+	return true, time.Time{}
+}
+
+// notify wakes every waiting request to check whether it is admissible.
+func (s *Scheduler) notify() {
+	if s.wake != nil {
+		close(s.wake)
+		s.wake = nil
+	}
+}
+
+// admit waits until a request of p is admissible, or req is canceled.
+func (s *Scheduler) admit(req *http.Request, p Priority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waiting[p]++
+	defer func() {
+		s.waiting[p]--
+		// Lower priorities may have been waiting on this one
+		s.notify()
+	}()
+	for {
+		ok, until := s.admissible(p, time.Now())
+		if ok {
+			s.inFlight++
+			return nil
+		}
+		if s.wake == nil {
+			s.wake = make(chan struct{})
+		}
+		wake := s.wake
+		// Wait for a request to finish or, past the budget, for the window to reset
+		timer := time.NewTimer(time.Hour)
+		if !until.IsZero() {
+			wait := time.Until(until)
+			s.Headroom.Slept(wait)
+			timer.Reset(wait)
+		}
+		s.mu.Unlock()
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			s.mu.Lock()
+			return req.Context().Err()
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+		s.mu.Lock()
+	}
+}
+
+// done records the rate limit headers of resp, if any, of a request that was admitted.
+func (s *Scheduler) done(resp *http.Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	defer s.notify()
+	if resp == nil {
+		return
+	}
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	reset := time.Unix(unix, 0)
+	// Responses of an earlier window may arrive after those of the next
+	if reset.Before(s.reset) {
+		return
+	}
+	used := limit - remaining
+	if reset.Equal(s.reset) {
+		used = max(used, s.used)
+	}
+	s.limit, s.used, s.reset = limit, used, reset
+}
+
+// Transport returns a http.RoundTripper sending the requests of priority p via base once admitted.
+func (s *Scheduler) Transport(base http.RoundTripper, p Priority) http.RoundTripper {
+	return &scheduledTransport{Base: base, Scheduler: s, Priority: p}
+}
+
+// scheduledTransport is a http.RoundTripper of requests of one priority of a Scheduler.
+type scheduledTransport struct {
+	Base      http.RoundTripper
+	Scheduler *Scheduler
+	Priority  Priority
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *scheduledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.Scheduler.admit(req, t.Priority); err != nil {
+		return nil, err
+	}
+	resp, err := t.Base.RoundTrip(req)
+	t.Scheduler.done(resp)
+	return resp, err
+}
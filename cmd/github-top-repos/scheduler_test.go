@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRateLimit is a http.RoundTripper answering each request with the rate limit headers of a token of limit
+// points, each request costing one, until reset. It has no headers once reset has passed.
+type fakeRateLimit struct {
+	limit int
+	reset time.Time
+
+	mu   sync.Mutex
+	used int
+	sent []string
+}
+
+func (t *fakeRateLimit) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, req.URL.Path)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody}
+	if time.Now().Before(t.reset) {
+		t.used++
+		resp.Header.Set("X-RateLimit-Limit", strconv.Itoa(t.limit))
+		resp.Header.Set("X-RateLimit-Remaining", strconv.Itoa(t.limit-t.used))
+		resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(t.reset.Unix(), 10))
+	}
+	return resp, nil
+}
+
+// send sends a request of path with p, reporting whether it was sent within timeout.
+func send(t *testing.T, s *Scheduler, base http.RoundTripper, p Priority, path string, timeout time.Duration) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.github.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Transport(base, p).RoundTrip(req)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestSchedulerReserve(t *testing.T) {
+	base := &fakeRateLimit{limit: 5000, reset: time.Now().Add(time.Hour)}
+	s := &Scheduler{Ceiling: 10, Reserve: 4}
+	// Enrichment stops short of the reserve
+	for i := 0; i < 6; i++ {
+		if !send(t, s, base, EnrichPriority, "/enrich", time.Second) {
+			t.Fatalf("enrichment %d of 6 was held back", i+1)
+		}
+	}
+	if send(t, s, base, EnrichPriority, "/enrich", 20*time.Millisecond) {
+		t.Error("enrichment was sent into the reserve")
+	}
+	// Searches use the reserve up to the ceiling
+	for i := 0; i < 4; i++ {
+		if !send(t, s, base, SearchPriority, "/search", time.Second) {
+			t.Fatalf("search %d of 4 was held back", i+1)
+		}
+	}
+	if send(t, s, base, SearchPriority, "/search", 20*time.Millisecond) {
+		t.Error("search was sent over the ceiling")
+	}
+	if base.used != 10 {
+		t.Errorf("used %d points, want the ceiling of 10", base.used)
+	}
+}
+
+func TestSchedulerTokenLimit(t *testing.T) {
+	// Without a ceiling the limit of the token is the ceiling, as used by any process
+	base := &fakeRateLimit{limit: 5, used: 3, reset: time.Now().Add(time.Hour)}
+	s := &Scheduler{}
+	for i := 0; i < 2; i++ {
+		if !send(t, s, base, SearchPriority, "/search", time.Second) {
+			t.Fatalf("search %d of 2 was held back", i+1)
+		}
+	}
+	if send(t, s, base, SearchPriority, "/search", 20*time.Millisecond) {
+		t.Error("search was sent past the limit of the token")
+	}
+}
+
+func TestSchedulerSearchFirst(t *testing.T) {
+	// The reset is in whole seconds, as in the header
+	base := &fakeRateLimit{limit: 1, reset: time.Now().Truncate(time.Second).Add(2 * time.Second)}
+	s := &Scheduler{}
+	if !send(t, s, base, SearchPriority, "/search", time.Second) {
+		t.Fatal("first search was held back")
+	}
+	// Both wait for the reset, the enrichment first
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if !send(t, s, base, EnrichPriority, "/enrich", 5*time.Second) {
+			t.Error("enrichment was never sent")
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		if !send(t, s, base, SearchPriority, "/search", 5*time.Second) {
+			t.Error("search was never sent")
+		}
+	}()
+	wg.Wait()
+	if want := []string{"/search", "/search", "/enrich"}; len(base.sent) != 3 || base.sent[1] != want[1] || base.sent[2] != want[2] {
+		t.Errorf("sent %q, want %q", base.sent, want)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Scorecard is the OpenSSF Scorecard of a repository, https://scorecard.dev
+type Scorecard struct {
+	// Score is out of 10.
+	Score float64 `json:"score"`
+	// Date is when the repository was last scored.
+	Date string `json:"date"`
+}
+
+// FetchScorecard returns the Scorecard of a repository from the Scorecard API at baseURL, or nil if it has none, as
+// only repositories the project has scored do.
+func FetchScorecard(ctx context.Context, client *http.Client, baseURL, nameWithOwner string) (*Scorecard, error) {
+	// https://api.securityscorecards.dev/#/results/getResult
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/projects/github.com/"+nameWithOwner, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 OK status code: %v", resp.Status)
+	}
+	var scorecard Scorecard
+	if err := json.NewDecoder(resp.Body).Decode(&scorecard); err != nil {
+		return nil, err
+	}
+	return &scorecard, nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/retry"
+	"golang.org/x/mod/semver"
+)
+
+// releasePublicKey is the base64 Ed25519 public key whose private key signs the SHA256SUMS of each release, set by
+// release builds with -ldflags "-X main.releasePublicKey=...". A build without it can't verify an update.
+var releasePublicKey string
+
+// Release is a GitHub release and its downloadable assets.
+type Release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download URL of the named asset.
+func (r *Release) asset(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+// ReleaseAssetName is the name of the release binary for the current platform.
+func ReleaseAssetName() string {
+	name := "github-top-repos_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// download fetches url, returning the body and its SHA-256.
+func download(ctx context.Context, client *http.Client, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("non-200 OK status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(body)
+	return body, hex.EncodeToString(sum[:]), nil
+}
+
+// expectedSum finds the SHA-256 of name in a sha256sum formatted file.
+func expectedSum(sums []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	for scanner.Scan() {
+		sum, file, ok := strings.Cut(scanner.Text(), "  ")
+		if ok && strings.TrimPrefix(file, "*") == name {
+			return sum, true
+		}
+	}
+	return "", false
+}
+
+// verifySignature checks that sig is the Ed25519 signature of sums by releasePublicKey, so the checksums, and so
+// the binary, were published by whoever holds the release signing key rather than anyone able to upload assets.
+func verifySignature(sums, sig []byte) error {
+	if releasePublicKey == "" {
+		return errors.New("this build has no release public key to verify updates with")
+	}
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid release public key: %w", err)
+	} else if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key: %d bytes", len(key))
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+		return errors.New("signature does not match the release public key")
+	}
+	return nil
+}
+
+// newerRelease reports whether the release tag is a later semantic version than current. A pre-release or
+// pseudo-version sorts before the release it leads up to.
+func newerRelease(current, tag string) (bool, error) {
+	if !semver.IsValid(tag) {
+		return false, fmt.Errorf("release %q is not a semantic version", tag)
+	} else if !semver.IsValid(current) {
+		return false, fmt.Errorf("this build's version %q is not a semantic version", current)
+	}
+	return semver.Compare(tag, current) > 0, nil
+}
+
+// replaceExecutable atomically replaces the running executable with binary.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(exe), filepath.Base(exe)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return err
+	}
+	// Windows can't replace a running executable, but can rename it out of the way
+	return installExecutable(f.Name(), exe, runtime.GOOS == "windows")
+}
+
+// installExecutable renames the binary at path over exe. If aside, exe is first renamed to exe.old, and renamed
+// back if the binary can't then be, so a failed update never leaves no executable at all.
+func installExecutable(path, exe string, aside bool) error {
+	if !aside {
+		return os.Rename(path, exe)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(path, exe); err != nil {
+		if restoreErr := os.Rename(old, exe); restoreErr != nil {
+			return fmt.Errorf("%w, and restoring %s failed: %v", err, old, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// selfUpdateMain implements the self-update subcommand.
+func selfUpdateMain(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	repo := fs.String("repo", "bored-engineer/github-top-repos", "repository whose latest release to update to")
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	check := fs.Bool("check", false, "only report whether an update is available")
+	force := fs.Bool("force", false, "install the latest release even if it isn't newer than this build, or this build has no version")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s self-update [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	client := NewHTTPClient(ctx, retry.NewTransport(http.DefaultTransport, 5, 15*time.Minute), Token("rest"))
+
+	// https://docs.github.com/en/rest/releases/releases#get-the-latest-release
+	var release Release
+	if _, err := restGet(ctx, client, *restURL+"/repos/"+*repo+"/releases/latest", &release); err != nil {
+		log.Fatalf("Failed to get the latest release: %v", err)
+	}
+	current := ReadBuildInfo().Version
+	newer, err := newerRelease(current, release.TagName)
+	switch {
+	case err != nil && !*force:
+		log.Fatalf("Can't tell whether %s is an update: %v", release.TagName, err)
+	case err == nil && !newer && !*force:
+		log.Printf("Already up to date at %s, the latest release is %s", current, release.TagName)
+		return
+	case newer:
+		log.Printf("Update available: %s -> %s", current, release.TagName)
+	default:
+		log.Printf("Replacing %s with %s", current, release.TagName)
+	}
+	if *check {
+		return
+	}
+
+	// The binary must match the checksum published with the release, which must be signed by the release key
+	name := ReleaseAssetName()
+	binaryURL, ok := release.asset(name)
+	if !ok {
+		log.Fatalf("Release %s has no %s binary", release.TagName, name)
+	}
+	sumsURL, ok := release.asset("SHA256SUMS")
+	if !ok {
+		log.Fatalf("Release %s has no SHA256SUMS to verify the binary with", release.TagName)
+	}
+	sigURL, ok := release.asset("SHA256SUMS.sig")
+	if !ok {
+		log.Fatalf("Release %s has no SHA256SUMS.sig to verify the checksums with", release.TagName)
+	}
+	sums, _, err := download(ctx, http.DefaultClient, sumsURL)
+	if err != nil {
+		log.Fatalf("Failed to download SHA256SUMS: %v", err)
+	}
+	sig, _, err := download(ctx, http.DefaultClient, sigURL)
+	if err != nil {
+		log.Fatalf("Failed to download SHA256SUMS.sig: %v", err)
+	}
+	if err := verifySignature(sums, sig); err != nil {
+		log.Fatalf("Failed to verify SHA256SUMS of %s: %v", release.TagName, err)
+	}
+	expected, ok := expectedSum(sums, name)
+	if !ok {
+		log.Fatalf("SHA256SUMS of %s has no entry for %s", release.TagName, name)
+	}
+	binary, sum, err := download(ctx, http.DefaultClient, binaryURL)
+	if err != nil {
+		log.Fatalf("Failed to download %s: %v", name, err)
+	} else if sum != expected {
+		log.Fatalf("Checksum mismatch for %s: expected %s, got %s", name, expected, sum)
+	}
+	if err := replaceExecutable(binary); err != nil {
+		log.Fatalf("Failed to replace the executable: %v", err)
+	}
+	log.Printf("Updated to %s", release.TagName)
+}
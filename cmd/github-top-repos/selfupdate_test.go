@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallExecutable(t *testing.T) {
+	for _, aside := range []bool{false, true} {
+		dir := t.TempDir()
+		exe, binary := filepath.Join(dir, "github-top-repos"), filepath.Join(dir, "new.tmp")
+		os.WriteFile(exe, []byte("old"), 0755)
+		os.WriteFile(binary, []byte("new"), 0755)
+		if err := installExecutable(binary, exe, aside); err != nil {
+			t.Fatalf("aside %t: %v", aside, err)
+		}
+		if b, _ := os.ReadFile(exe); string(b) != "new" {
+			t.Errorf("aside %t: executable is %q, want the new binary", aside, b)
+		}
+		if b, err := os.ReadFile(exe + ".old"); aside && string(b) != "old" {
+			t.Errorf("aside %t: .old is %q, %v, want the old executable", aside, b, err)
+		}
+	}
+}
+
+func TestInstallExecutableRestores(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "github-top-repos")
+	os.WriteFile(exe, []byte("old"), 0755)
+	// The new binary can't be renamed into place, as it is gone
+	if err := installExecutable(filepath.Join(dir, "missing.tmp"), exe, true); err == nil {
+		t.Fatal("installed a missing binary")
+	}
+	if b, err := os.ReadFile(exe); err != nil || string(b) != "old" {
+		t.Errorf("executable is %q, %v after a failed install, want the old one restored", b, err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// stopContext returns a context cancelled by an interrupt.
+func stopContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt)
+}
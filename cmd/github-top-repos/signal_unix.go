@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// hangupReloads is set once SIGHUP reloads the rate configuration instead of stopping.
+var hangupReloads atomic.Bool
+
+// stopContext returns a context cancelled by SIGINT, SIGTERM or SIGHUP,
+// so the output is flushed and the checkpoint kept however the process is stopped.
+func stopContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGHUP && hangupReloads.Load() {
+					continue
+				}
+				log.Printf("Received %s, stopping", sig)
+				cancel()
+				return
+			}
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// stopContext returns a context cancelled by Ctrl+C, Ctrl+Break or the console being closed,
+// logged off or shut down, which the runtime delivers as os.Interrupt and syscall.SIGTERM.
+func stopContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// DefaultSpamDescriptions matches descriptions left as the template of a generator or tutorial.
+const DefaultSpamDescriptions = `^(A new Flutter project\.|Config files for my GitHub profile\.|Created with CodeSandbox|My first repository on GitHub\.?)$`
+
+// SpamFilter drops placeholder and junk repositories using simple heuristics.
+type SpamFilter struct {
+	// Descriptions matches placeholder descriptions, nil to disable.
+	Descriptions *regexp.Regexp
+	// OwnerRepos drops repositories whose owner was created the same day with at least this many repositories, 0 to disable.
+	OwnerRepos int
+
+	mu      sync.Mutex
+	dropped map[string]int
+}
+
+// reason returns the heuristic matched by repo, if any.
+func (f *SpamFilter) reason(repo ghsearch.Repository) string {
+	switch {
+	case repo.DiskUsage == 0:
+		return "zero-size"
+	case f.Descriptions != nil && f.Descriptions.MatchString(repo.Description):
+		return "description"
+	case f.OwnerRepos > 0 && repo.Owner.User.Repositories.TotalCount >= f.OwnerRepos && repo.HasCreatedAt() &&
+		repo.Owner.User.CreatedAt.UTC().Truncate(24*time.Hour).Equal(repo.CreatedAt.UTC().Truncate(24*time.Hour)):
+		return "owner"
+	}
+	return ""
+}
+
+// Keep implements Filter, counting the repositories dropped by each heuristic.
+func (f *SpamFilter) Keep(repo ghsearch.Repository) bool {
+	reason := f.reason(repo)
+	if reason == "" {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped == nil {
+		f.dropped = make(map[string]int)
+	}
+	f.dropped[reason]++
+	return false
+}
+
+// Summary describes how many repositories were dropped by each heuristic.
+func (f *SpamFilter) Summary() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var parts []string
+	for reason, count := range f.dropped {
+		parts = append(parts, reason+"="+strconv.Itoa(count))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
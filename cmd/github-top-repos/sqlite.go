@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// sqliteColumn is a column of the repositories table.
+type sqliteColumn struct {
+	name string
+	typ  string
+	// value returns the value of the column for row, an int, bool or string, or nil for NULL such as if the
+	// field was not fetched.
+	value func(row ghsearch.Row) any
+	// optional columns may be NULL, such as when their field is not output, keeping any previous value.
+	optional bool
+}
+
+// sqliteColumns returns the columns of the repositories table, filling in the optional columns of fields.
+func sqliteColumns(fields OutputFields) []sqliteColumn {
+	// Every column is always in the table so its schema does not depend on the fields
+	optional := func(set bool, value func(row ghsearch.Row) any) func(row ghsearch.Row) any {
+		if !set {
+			return func(ghsearch.Row) any { return nil }
+		}
+		return value
+	}
+	flag := func(value func(row ghsearch.Row) bool) func(row ghsearch.Row) any {
+		return optional(fields.Flags, func(row ghsearch.Row) any { return value(row) })
+	}
+	return []sqliteColumn{
+		{name: "database_id", typ: "INTEGER PRIMARY KEY", value: func(row ghsearch.Row) any {
+			return row.DatabaseId
+		}},
+		{name: "name_with_owner", typ: "TEXT NOT NULL", value: func(row ghsearch.Row) any {
+			return row.NameWithOwner
+		}},
+		{name: "stars", typ: "INTEGER NOT NULL", value: func(row ghsearch.Row) any {
+			return row.StargazerCount
+		}},
+		{name: "forks", typ: "INTEGER NOT NULL", value: func(row ghsearch.Row) any {
+			return row.ForkCount
+		}},
+		{name: "size", typ: "INTEGER NOT NULL", value: func(row ghsearch.Row) any {
+			return row.DiskUsage
+		}},
+		{name: "description", typ: "TEXT NOT NULL", value: func(row ghsearch.Row) any {
+			return row.Description
+		}},
+		// NULL if GitHub returned no valid creation time
+		{name: "created_at", typ: "TEXT", optional: true, value: func(row ghsearch.Row) any {
+			if !row.HasCreatedAt() {
+				return nil
+			}
+			return FormatTime(row.CreatedAt)
+		}},
+		{name: "suspected_bot", typ: "INTEGER", optional: true, value: optional(fields.SuspectedBot, func(row ghsearch.Row) any {
+			return row.SuspectedBot
+		})},
+		{name: "primary_language", typ: "TEXT", optional: true, value: optional(fields.Languages, func(row ghsearch.Row) any {
+			return row.PrimaryLanguage.Name
+		})},
+		{name: "languages", typ: "TEXT", optional: true, value: optional(fields.Languages, func(row ghsearch.Row) any {
+			return FormatLanguages(row.Languages.Edges)
+		})},
+		{name: "license", typ: "TEXT", optional: true, value: optional(fields.License, func(row ghsearch.Row) any {
+			return row.LicenseInfo.SpdxId
+		})},
+		{name: "topics", typ: "TEXT", optional: true, value: optional(fields.Topics, func(row ghsearch.Row) any {
+			return strings.Join(topicNames(row.Repository), ";")
+		})},
+		{name: "is_fork", typ: "INTEGER", optional: true, value: flag(func(row ghsearch.Row) bool { return row.IsFork })},
+		{name: "is_mirror", typ: "INTEGER", optional: true, value: flag(func(row ghsearch.Row) bool { return row.IsMirror })},
+		{name: "is_template", typ: "INTEGER", optional: true, value: flag(func(row ghsearch.Row) bool { return row.IsTemplate })},
+		{name: "is_archived", typ: "INTEGER", optional: true, value: flag(func(row ghsearch.Row) bool { return row.IsArchived })},
+		{name: "is_disabled", typ: "INTEGER", optional: true, value: flag(func(row ghsearch.Row) bool { return row.IsDisabled })},
+		{name: "owner_type", typ: "TEXT", optional: true, value: optional(fields.Owner, func(row ghsearch.Row) any {
+			return row.Owner.Typename
+		})},
+		{name: "owner_id", typ: "INTEGER", optional: true, value: optional(fields.Owner, func(row ghsearch.Row) any {
+			return row.OwnerDatabaseId()
+		})},
+		// NULL for users, which can't be verified
+		{name: "owner_verified", typ: "INTEGER", optional: true, value: optional(fields.Owner, func(row ghsearch.Row) any {
+			if row.Owner.Typename != "Organization" {
+				return nil
+			}
+			return row.Owner.Organization.IsVerified
+		})},
+	}
+}
+
+// sqliteCreateTable returns the statement creating the repositories table of columns, if it doesn't exist.
+func sqliteCreateTable(columns []sqliteColumn) string {
+	defs := make([]string, len(columns))
+	for i, column := range columns {
+		defs[i] = column.name + " " + column.typ
+	}
+	return "CREATE TABLE IF NOT EXISTS repositories (" + strings.Join(defs, ", ") + ")"
+}
+
+// sqliteUpsert returns the statement upserting the values, SQL expressions of each of columns, keyed on the
+// database ID.
+func sqliteUpsert(columns []sqliteColumn, values []string) string {
+	updates := make([]string, 0, len(columns)-1)
+	for i, column := range columns {
+		switch {
+		case i == 0:
+			// The key is never updated
+		case column.optional:
+			// A run without the field keeps the value found by a previous run
+			updates = append(updates, column.name+" = coalesce(excluded."+column.name+", "+column.name+")")
+		default:
+			updates = append(updates, column.name+" = excluded."+column.name)
+		}
+	}
+	return "INSERT INTO repositories VALUES (" + strings.Join(values, ", ") + ")" +
+		" ON CONFLICT (database_id) DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+// SQLiteWriter writes rows as a SQLite script upserting them into a repositories table keyed
+// on the database ID, such that overlapping runs piped into sqlite3 merge without duplicates.
+type SQLiteWriter struct {
+	// BatchSize is the number of rows committed in each transaction.
+	BatchSize int
+
+	w       io.Writer
+	columns []sqliteColumn
+	created bool
+	pending int
+}
+
+// NewSQLiteWriter returns a SQLiteWriter to w, filling in the optional columns of fields.
+func NewSQLiteWriter(w io.Writer, fields OutputFields) *SQLiteWriter {
+	return &SQLiteWriter{BatchSize: 1000, w: w, columns: sqliteColumns(fields)}
+}
+
+// sqlLiteral returns v, a value of a sqliteColumn, as a SQL literal.
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case int:
+		return FormatInt(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case string:
+		return sqlString(v)
+	}
+	return "NULL"
+}
+
+// sqlString quotes s as a SQL string literal.
+func sqlString(s string) string {
+	// sqlite3 reads the script as text, so NUL can't be represented
+	s = strings.ReplaceAll(s, "\x00", "")
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Write writes the upsert of row, committing a transaction every BatchSize rows.
+func (sw *SQLiteWriter) Write(row ghsearch.Row) error {
+	var script strings.Builder
+	if !sw.created {
+		script.WriteString(sqliteCreateTable(sw.columns) + ";\n")
+		sw.created = true
+	}
+	if sw.pending == 0 {
+		script.WriteString("BEGIN;\n")
+	}
+	values := make([]string, len(sw.columns))
+	for i, column := range sw.columns {
+		values[i] = sqlLiteral(column.value(row))
+	}
+	script.WriteString(sqliteUpsert(sw.columns, values) + ";\n")
+	sw.pending++
+	if sw.pending >= sw.BatchSize {
+		script.WriteString("COMMIT;\n")
+		sw.pending = 0
+	}
+	_, err := io.WriteString(sw.w, script.String())
+	return err
+}
+
+// Commit commits any rows written since the last transaction.
+func (sw *SQLiteWriter) Commit() error {
+	if sw.pending == 0 {
+		return nil
+	}
+	sw.pending = 0
+	_, err := io.WriteString(sw.w, "COMMIT;\n")
+	return err
+}
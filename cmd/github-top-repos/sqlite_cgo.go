@@ -0,0 +1,8 @@
+//go:build cgo
+
+package main
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the database/sql driver of SQLiteDatabase, which needs cgo.
+const sqliteDriver = "sqlite3"
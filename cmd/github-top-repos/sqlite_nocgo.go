@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package main
+
+// sqliteDriver is empty, as the driver of SQLiteDatabase needs cgo.
+const sqliteDriver = ""
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// SQLiteDatabase upserts rows into the repositories table of a SQLite database keyed on the database ID,
+// as the script of SQLiteWriter does when piped into sqlite3, so overlapping runs merge without duplicates.
+type SQLiteDatabase struct {
+	// BatchSize is the number of rows committed in each transaction.
+	BatchSize int
+
+	db      *sql.DB
+	columns []sqliteColumn
+	tx      *sql.Tx
+	upsert  *sql.Stmt
+	pending int
+}
+
+// OpenSQLiteDatabase opens the SQLite database at path, creating it and its repositories table if needed,
+// filling in the optional columns of fields.
+func OpenSQLiteDatabase(path string, fields OutputFields) (*SQLiteDatabase, error) {
+	if sqliteDriver == "" {
+		return nil, errors.New("writing a SQLite database needs a build with cgo, pipe -output-format sqlite into sqlite3 instead")
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	// Every row is written by the one transaction
+	db.SetMaxOpenConns(1)
+	columns := sqliteColumns(fields)
+	if _, err := db.Exec(sqliteCreateTable(columns)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteDatabase{BatchSize: 1000, db: db, columns: columns}, nil
+}
+
+// Write upserts row, committing a transaction every BatchSize rows.
+func (d *SQLiteDatabase) Write(row ghsearch.Row) error {
+	if d.tx == nil {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		params := strings.Split(strings.Repeat("?", len(d.columns)), "")
+		upsert, err := tx.Prepare(sqliteUpsert(d.columns, params))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		d.tx, d.upsert = tx, upsert
+	}
+	values := make([]any, len(d.columns))
+	for i, column := range d.columns {
+		value := column.value(row)
+		// NUL is dropped as in the script, which can't represent it
+		if s, ok := value.(string); ok {
+			value = strings.ReplaceAll(s, "\x00", "")
+		}
+		values[i] = value
+	}
+	if _, err := d.upsert.Exec(values...); err != nil {
+		return err
+	}
+	d.pending++
+	if d.pending >= d.BatchSize {
+		return d.Commit()
+	}
+	return nil
+}
+
+// Commit commits any rows written since the last transaction.
+func (d *SQLiteDatabase) Commit() error {
+	if d.tx == nil {
+		return nil
+	}
+	tx := d.tx
+	d.tx, d.upsert, d.pending = nil, nil, 0
+	return tx.Commit()
+}
+
+// Close commits any rows written since the last transaction and closes the database.
+func (d *SQLiteDatabase) Close() error {
+	return errors.Join(d.Commit(), d.db.Close())
+}
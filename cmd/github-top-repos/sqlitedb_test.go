@@ -0,0 +1,102 @@
+//go:build cgo
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sqliteDump returns every row of the repositories table, ordered by database ID, each column formatted with %v.
+func sqliteDump(t *testing.T, db *sql.DB) [][]string {
+	t.Helper()
+	rows, err := db.Query("SELECT * FROM repositories ORDER BY database_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump [][]string
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			t.Fatal(err)
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			row[i] = fmt.Sprintf("%v", value)
+		}
+		dump = append(dump, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return dump
+}
+
+// TestSQLiteDatabaseMatchesScript checks that writing a database directly and piping the script into it agree,
+// including that a later run without the optional fields keeps their values.
+func TestSQLiteDatabaseMatchesScript(t *testing.T) {
+	rows := testRows(t)
+	dir := t.TempDir()
+
+	script, err := sql.Open(sqliteDriver, filepath.Join(dir, "script.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+	path := filepath.Join(dir, "direct.db")
+	for _, name := range []string{"all", "none"} {
+		if _, err := script.Exec(string(writeOutput(t, rows, "sqlite", testFields[name]))); err != nil {
+			t.Fatalf("%s script: %v", name, err)
+		}
+		db, err := OpenSQLiteDatabase(path, testFields[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Several transactions, the last partial
+		db.BatchSize = 2
+		for _, row := range rows {
+			if err := db.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	direct, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer direct.Close()
+	got, want := sqliteDump(t, direct), sqliteDump(t, script)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("database written directly:\n%q\nscript:\n%q", got, want)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("%d rows after two runs, want %d", len(got), len(rows))
+	}
+	// The second run without the optional fields kept those of the first
+	if first := got[0]; first[7] != "0" || first[8] != "Go" || first[19] != "1" {
+		t.Errorf("optional columns of %s were not kept: %q", first[1], first)
+	}
+	// NUL can't be in the script, so neither is it in the database
+	if description := got[3][5]; description != "=HYPERLINK(\"x\")\r\nnul:, tab:\t" {
+		t.Errorf("description of %s = %q", got[3][1], description)
+	}
+}
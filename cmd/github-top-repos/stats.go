@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readRows reads the rows of CSV or NDJSON output at path, or stdin for "-", as the values of each column by name.
+// CSV output without a -header row only has the owner/name, in the name_with_owner column.
+func readRows(path string) ([]map[string]string, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	br := bufio.NewReader(in)
+	var rows []map[string]string
+	if b, err := br.Peek(1); err == nil && b[0] == '{' {
+		dec := json.NewDecoder(br)
+		dec.UseNumber()
+		for {
+			var object map[string]any
+			if err := dec.Decode(&object); err == io.EOF {
+				return rows, nil
+			} else if err != nil {
+				return nil, err
+			}
+			row := make(map[string]string, len(object))
+			for name, value := range object {
+				switch value := value.(type) {
+				case string:
+					row[name] = value
+				case json.Number:
+					row[name] = value.String()
+				case bool:
+					row[name] = FormatBool(value)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	header := []string{"name_with_owner"}
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if first {
+			// Tolerate output written with -bom
+			record[0] = strings.TrimPrefix(record[0], "\uFEFF")
+			if _, ok := csvNameWithOwner(record); ok {
+				header = record
+				continue
+			}
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[name] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Stats summarizes the columns of a dataset that are present in it.
+type Stats struct {
+	Rows   int
+	Owners int
+	// Numbers are the sorted values of each numeric column.
+	Numbers map[string][]int
+	// Earliest and Latest are the range of created_at, zero if there is none.
+	Earliest, Latest time.Time
+	// True counts the rows for which each boolean column is true.
+	True map[string]int
+	// Values counts the rows of each value of each categorical column.
+	Values map[string]map[string]int
+}
+
+var (
+	statsNumbers  = []string{"stars", "forks", "size"}
+	statsBooleans = []string{"suspected_bot", "is_fork", "is_mirror", "is_template", "is_archived", "is_disabled", "owner_verified"}
+	statsValues   = []string{"primary_language", "license", "owner_type"}
+)
+
+// NewStats summarizes rows.
+func NewStats(rows []map[string]string) *Stats {
+	s := &Stats{
+		Rows:    len(rows),
+		Numbers: make(map[string][]int),
+		True:    make(map[string]int),
+		Values:  make(map[string]map[string]int),
+	}
+	owners := make(map[string]struct{})
+	for _, row := range rows {
+		owner := row["owner"]
+		if nameWithOwner, ok := row["name_with_owner"]; ok {
+			owner, _, _ = strings.Cut(nameWithOwner, "/")
+		}
+		owners[owner] = struct{}{}
+		for _, column := range statsNumbers {
+			if n, err := strconv.Atoi(row[column]); err == nil {
+				s.Numbers[column] = append(s.Numbers[column], n)
+			}
+		}
+		if t, err := time.Parse(time.RFC3339, row["created_at"]); err == nil {
+			if s.Earliest.IsZero() || t.Before(s.Earliest) {
+				s.Earliest = t
+			}
+			if t.After(s.Latest) {
+				s.Latest = t
+			}
+		}
+		for _, column := range statsBooleans {
+			if value, ok := row[column]; ok {
+				if b, _ := strconv.ParseBool(value); b {
+					s.True[column]++
+				} else if _, ok := s.True[column]; !ok {
+					s.True[column] = 0
+				}
+			}
+		}
+		for _, column := range statsValues {
+			if value, ok := row[column]; ok {
+				if s.Values[column] == nil {
+					s.Values[column] = make(map[string]int)
+				}
+				s.Values[column][value]++
+			}
+		}
+	}
+	s.Owners = len(owners)
+	for _, values := range s.Numbers {
+		sort.Ints(values)
+	}
+	return s
+}
+
+// Write writes the summary to w, with the top most common values of each categorical column.
+func (s *Stats) Write(w io.Writer, top int) {
+	fmt.Fprintf(w, "rows: %s\n", FormatInt(s.Rows))
+	fmt.Fprintf(w, "owners: %s\n", FormatInt(s.Owners))
+	for _, column := range statsNumbers {
+		values := s.Numbers[column]
+		if len(values) == 0 {
+			continue
+		}
+		var total int
+		for _, n := range values {
+			total += n
+		}
+		fmt.Fprintf(w, "%s: total=%s min=%s median=%s max=%s\n", column, FormatInt(total),
+			FormatInt(values[0]), FormatInt(values[len(values)/2]), FormatInt(values[len(values)-1]))
+	}
+	if !s.Latest.IsZero() {
+		fmt.Fprintf(w, "created_at: %s to %s\n", FormatTime(s.Earliest), FormatTime(s.Latest))
+	}
+	for _, column := range statsBooleans {
+		if n, ok := s.True[column]; ok {
+			fmt.Fprintf(w, "%s: %s true\n", column, FormatInt(n))
+		}
+	}
+	for _, column := range statsValues {
+		counts := s.Values[column]
+		if counts == nil {
+			continue
+		}
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if counts[values[i]] != counts[values[j]] {
+				return counts[values[i]] > counts[values[j]]
+			}
+			return values[i] < values[j]
+		})
+		parts := make([]string, 0, top)
+		for _, value := range values[:min(top, len(values))] {
+			name := value
+			if name == "" {
+				name = "(none)"
+			}
+			parts = append(parts, name+"="+FormatInt(counts[value]))
+		}
+		fmt.Fprintf(w, "%s: %s\n", column, strings.Join(parts, " "))
+	}
+}
+
+// statsMain implements the stats subcommand.
+func statsMain(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	top := fs.Int("top", 10, "number of the most common values of each categorical column, such as primary_language, to show")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s stats [flags] (file.csv|file.ndjson|-)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *top < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	rows, err := readRows(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	NewStats(rows).Write(os.Stdout, *top)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS repositories (database_id INTEGER PRIMARY KEY, name_with_owner TEXT NOT NULL, stars INTEGER NOT NULL, forks INTEGER NOT NULL, size INTEGER NOT NULL, description TEXT NOT NULL, created_at TEXT, suspected_bot INTEGER, primary_language TEXT, languages TEXT, license TEXT, topics TEXT, is_fork INTEGER, is_mirror INTEGER, is_template INTEGER, is_archived INTEGER, is_disabled INTEGER, owner_type TEXT, owner_id INTEGER, owner_verified INTEGER);
+BEGIN;
+INSERT INTO repositories VALUES (1001, 'acme/rocket', 123456, 7890, 2048, 'Fast, "safe" rockets
+for everyone — héllo', '2012-03-04T03:06:07Z', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL) ON CONFLICT (database_id) DO UPDATE SET name_with_owner = excluded.name_with_owner, stars = excluded.stars, forks = excluded.forks, size = excluded.size, description = excluded.description, created_at = coalesce(excluded.created_at, created_at), suspected_bot = coalesce(excluded.suspected_bot, suspected_bot), primary_language = coalesce(excluded.primary_language, primary_language), languages = coalesce(excluded.languages, languages), license = coalesce(excluded.license, license), topics = coalesce(excluded.topics, topics), is_fork = coalesce(excluded.is_fork, is_fork), is_mirror = coalesce(excluded.is_mirror, is_mirror), is_template = coalesce(excluded.is_template, is_template), is_archived = coalesce(excluded.is_archived, is_archived), is_disabled = coalesce(excluded.is_disabled, is_disabled), owner_type = coalesce(excluded.owner_type, owner_type), owner_id = coalesce(excluded.owner_id, owner_id), owner_verified = coalesce(excluded.owner_verified, owner_verified);
+INSERT INTO repositories VALUES (1002, 'someone/dotfiles', 5, 0, 0, ' leading space and ''single quotes''', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL) ON CONFLICT (database_id) DO UPDATE SET name_with_owner = excluded.name_with_owner, stars = excluded.stars, forks = excluded.forks, size = excluded.size, description = excluded.description, created_at = coalesce(excluded.created_at, created_at), suspected_bot = coalesce(excluded.suspected_bot, suspected_bot), primary_language = coalesce(excluded.primary_language, primary_language), languages = coalesce(excluded.languages, languages), license = coalesce(excluded.license, license), topics = coalesce(excluded.topics, topics), is_fork = coalesce(excluded.is_fork, is_fork), is_mirror = coalesce(excluded.is_mirror, is_mirror), is_template = coalesce(excluded.is_template, is_template), is_archived = coalesce(excluded.is_archived, is_archived), is_disabled = coalesce(excluded.is_disabled, is_disabled), owner_type = coalesce(excluded.owner_type, owner_type), owner_id = coalesce(excluded.owner_id, owner_id), owner_verified = coalesce(excluded.owner_verified, owner_verified);
+INSERT INTO repositories VALUES (1003, 'someone/edge-cases', 9223372036854775807, 1, 1, '\.', '2008-02-08T12:00:00Z', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL) ON CONFLICT (database_id) DO UPDATE SET name_with_owner = excluded.name_with_owner, stars = excluded.stars, forks = excluded.forks, size = excluded.size, description = excluded.description, created_at = coalesce(excluded.created_at, created_at), suspected_bot = coalesce(excluded.suspected_bot, suspected_bot), primary_language = coalesce(excluded.primary_language, primary_language), languages = coalesce(excluded.languages, languages), license = coalesce(excluded.license, license), topics = coalesce(excluded.topics, topics), is_fork = coalesce(excluded.is_fork, is_fork), is_mirror = coalesce(excluded.is_mirror, is_mirror), is_template = coalesce(excluded.is_template, is_template), is_archived = coalesce(excluded.is_archived, is_archived), is_disabled = coalesce(excluded.is_disabled, is_disabled), owner_type = coalesce(excluded.owner_type, owner_type), owner_id = coalesce(excluded.owner_id, owner_id), owner_verified = coalesce(excluded.owner_verified, owner_verified);
+INSERT INTO repositories VALUES (1004, 'someone/crlf', 0, 0, 0, '=HYPERLINK("x")
+nul:, tab:	', '2024-12-31T23:59:59Z', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL) ON CONFLICT (database_id) DO UPDATE SET name_with_owner = excluded.name_with_owner, stars = excluded.stars, forks = excluded.forks, size = excluded.size, description = excluded.description, created_at = coalesce(excluded.created_at, created_at), suspected_bot = coalesce(excluded.suspected_bot, suspected_bot), primary_language = coalesce(excluded.primary_language, primary_language), languages = coalesce(excluded.languages, languages), license = coalesce(excluded.license, license), topics = coalesce(excluded.topics, topics), is_fork = coalesce(excluded.is_fork, is_fork), is_mirror = coalesce(excluded.is_mirror, is_mirror), is_template = coalesce(excluded.is_template, is_template), is_archived = coalesce(excluded.is_archived, is_archived), is_disabled = coalesce(excluded.is_disabled, is_disabled), owner_type = coalesce(excluded.owner_type, owner_type), owner_id = coalesce(excluded.owner_id, owner_id), owner_verified = coalesce(excluded.owner_verified, owner_verified);
+INSERT INTO repositories VALUES (1005, 'someone/empty', 1, 0, 0, '', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL) ON CONFLICT (database_id) DO UPDATE SET name_with_owner = excluded.name_with_owner, stars = excluded.stars, forks = excluded.forks, size = excluded.size, description = excluded.description, created_at = coalesce(excluded.created_at, created_at), suspected_bot = coalesce(excluded.suspected_bot, suspected_bot), primary_language = coalesce(excluded.primary_language, primary_language), languages = coalesce(excluded.languages, languages), license = coalesce(excluded.license, license), topics = coalesce(excluded.topics, topics), is_fork = coalesce(excluded.is_fork, is_fork), is_mirror = coalesce(excluded.is_mirror, is_mirror), is_template = coalesce(excluded.is_template, is_template), is_archived = coalesce(excluded.is_archived, is_archived), is_disabled = coalesce(excluded.is_disabled, is_disabled), owner_type = coalesce(excluded.owner_type, owner_type), owner_id = coalesce(excluded.owner_id, owner_id), owner_verified = coalesce(excluded.owner_verified, owner_verified);
+COMMIT;
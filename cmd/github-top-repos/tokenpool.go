@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/retry"
+)
+
+// LoadTokens reads tokens one per line from path, or if empty the comma-separated GITHUB_TOKENS.
+func LoadTokens(path string) ([]string, error) {
+	if path == "" {
+		var tokens []string
+		for _, token := range strings.Split(os.Getenv("GITHUB_TOKENS"), ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+		return tokens, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: no tokens", path)
+	}
+	return tokens, nil
+}
+
+// poolToken is a token of a TokenPool and its last known rate limit.
+type poolToken struct {
+	token string
+	// base sends the requests of the token.
+	base http.RoundTripper
+	// remaining is -1 until a response reports it.
+	remaining int
+	reset     time.Time
+}
+
+// TokenPool is a http.RoundTripper that authenticates each request with the token of
+// the pool with the most remaining quota, moving on to the next when one is exhausted.
+type TokenPool struct {
+	mu     sync.Mutex
+	tokens []*poolToken
+}
+
+// NewTokenPool returns a TokenPool of tokens sending requests via base.
+func NewTokenPool(base http.RoundTripper, tokens []string) *TokenPool {
+	pool := &TokenPool{}
+	for _, token := range tokens {
+		pool.tokens = append(pool.tokens, &poolToken{token: token, base: base, remaining: -1})
+	}
+	return pool
+}
+
+// Wrap replaces how the requests of each token, numbered from 0, are sent with wrap of it, such as to pace
+// each token by its own rate limit, which a transport above the pool would mix up between them. It must be
+// called before the pool is used.
+func (p *TokenPool) Wrap(wrap func(i int, base http.RoundTripper) http.RoundTripper) {
+	for i, t := range p.tokens {
+		t.base = wrap(i, t.base)
+	}
+}
+
+// pick returns the token with the most remaining quota, or when every token is
+// exhausted nil and the time the first of them resets.
+func (p *TokenPool) pick(now time.Time) (*poolToken, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *poolToken
+	var bestRemaining int
+	var reset time.Time
+	for _, t := range p.tokens {
+		if t.remaining == 0 && now.Before(t.reset) {
+			if reset.IsZero() || t.reset.Before(reset) {
+				reset = t.reset
+			}
+			continue
+		}
+		// A token that has not been used yet, or has reset, has its full quota
+		remaining := t.remaining
+		if remaining < 0 || !now.Before(t.reset) {
+			remaining = int(^uint(0) >> 1)
+		}
+		if best == nil || remaining > bestRemaining {
+			best, bestRemaining = t, remaining
+		}
+	}
+	return best, reset
+}
+
+// observe records the rate limit of t reported by resp.
+func (p *TokenPool) observe(t *poolToken, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.remaining, t.reset = remaining, time.Unix(reset, 0)
+}
+
+// Status summarizes the remaining quota of each token, identified by its position in the pool.
+func (p *TokenPool) Status() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	parts := make([]string, 0, len(p.tokens))
+	for i, t := range p.tokens {
+		if t.remaining < 0 {
+			parts = append(parts, fmt.Sprintf("#%d unused", i+1))
+		} else {
+			parts = append(parts, fmt.Sprintf("#%d %d left", i+1, t.remaining))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *TokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	for {
+		t, reset := p.pick(time.Now())
+		if t == nil {
+			log.Printf("Every token in the pool is rate limited, waiting until %s", reset.Format(time.RFC3339))
+			timer := time.NewTimer(time.Until(reset))
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		attempt := req.Clone(req.Context())
+		attempt.Header.Set("Authorization", "Bearer "+t.token)
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		resp, err := t.base.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+		p.observe(t, resp)
+		// A request rejected by an exhausted token is sent again with another, if it can be, including a
+		// GraphQL response of a RATE_LIMITED error which is a 200
+		rejected := retry.Classify(resp, nil) == retry.PrimaryRateLimit
+		if !rejected || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		log.Printf("Token rate limited, rotating (%s)", p.Status())
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// poolResponse is how the test server of a TokenPool answers a request with a token.
+type poolResponse struct {
+	status    int
+	remaining string
+	body      string
+}
+
+func TestTokenPoolRotates(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	rateLimited := `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`
+	for _, tt := range []struct {
+		name string
+		// first is the response to the request with the first token, the second token always succeeds
+		first poolResponse
+		// want are the tokens the request is sent with
+		want []string
+	}{
+		{"success", poolResponse{http.StatusOK, "4999", `{"data":{}}`}, []string{"a"}},
+		{"GraphQL rate limited", poolResponse{http.StatusOK, "0", rateLimited}, []string{"a", "b"}},
+		{"GraphQL secondary rate limit", poolResponse{http.StatusOK, "4000", rateLimited}, []string{"a"}},
+		{"403 exhausted", poolResponse{http.StatusForbidden, "0", `{"message":"API rate limit exceeded"}`}, []string{"a", "b"}},
+		{"429 exhausted", poolResponse{http.StatusTooManyRequests, "0", ""}, []string{"a", "b"}},
+		{"403 forbidden", poolResponse{http.StatusForbidden, "", `{"message":"Resource not accessible by integration"}`}, []string{"a"}},
+		{"403 secondary rate limit", poolResponse{http.StatusForbidden, "4000", `{"message":"You have exceeded a secondary rate limit"}`}, []string{"a"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				sent = append(sent, token)
+				// The body is sent again with each token
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"query":"q"}` {
+					t.Errorf("request with %s has body %q", token, body)
+				}
+				resp := poolResponse{http.StatusOK, "4999", `{"data":{"token":"b"}}`}
+				if token == "a" {
+					resp = tt.first
+				}
+				if resp.remaining != "" {
+					w.Header().Set("X-RateLimit-Remaining", resp.remaining)
+					w.Header().Set("X-RateLimit-Reset", reset)
+				}
+				w.WriteHeader(resp.status)
+				io.WriteString(w, resp.body)
+			}))
+			defer server.Close()
+
+			pool := NewTokenPool(http.DefaultTransport, []string{"a", "b"})
+			req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(`{"query":"q"}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := pool.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sent, tt.want) {
+				t.Errorf("sent with tokens %q, want %q", sent, tt.want)
+			}
+			// The response of the last token is returned whole, including any read to classify it
+			want := tt.first
+			if len(tt.want) > 1 {
+				want = poolResponse{http.StatusOK, "4999", `{"data":{"token":"b"}}`}
+			}
+			if resp.StatusCode != want.status || string(body) != want.body {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, want.status, want.body)
+			}
+		})
+	}
+}
+
+func TestTokenPoolPick(t *testing.T) {
+	now := time.Now()
+	pool := NewTokenPool(http.DefaultTransport, []string{"a", "b", "c"})
+	pool.tokens[0].remaining, pool.tokens[0].reset = 10, now.Add(time.Hour)
+	pool.tokens[1].remaining, pool.tokens[1].reset = 0, now.Add(30*time.Minute)
+	pool.tokens[2].remaining, pool.tokens[2].reset = 50, now.Add(time.Hour)
+	if got, _ := pool.pick(now); got.token != "c" {
+		t.Errorf("picked %s, want the token with the most remaining", got.token)
+	}
+	// An exhausted token is skipped until it resets, then has its full quota
+	pool.tokens[2].remaining = 0
+	if got, _ := pool.pick(now); got.token != "a" {
+		t.Errorf("picked %s, want the only token with quota", got.token)
+	}
+	if got, _ := pool.pick(now.Add(45 * time.Minute)); got.token != "b" {
+		t.Errorf("picked %s, want the token that has reset", got.token)
+	}
+	pool.tokens[0].remaining = 0
+	if got, reset := pool.pick(now); got != nil || !reset.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("picked %v until %s, want none until the first reset", got, reset)
+	}
+	if got, want := pool.Status(), "#1 0 left, #2 0 left, #3 0 left"; got != want {
+		t.Errorf("Status() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("# comment\n a \n\nb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadTokens(path); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("LoadTokens(file) = %q, %v", got, err)
+	}
+	if err := os.WriteFile(path, []byte("# none\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTokens(path); err == nil {
+		t.Error("LoadTokens of a file without tokens succeeded")
+	}
+	t.Setenv("GITHUB_TOKENS", "a, b,,")
+	if got, err := LoadTokens(""); err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("LoadTokens(GITHUB_TOKENS) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportOptions tunes the underlying HTTP transport used for API requests.
+type TransportOptions struct {
+	MaxIdleConnsPerHost int
+	HTTP2               bool
+	DisableKeepAlives   bool
+	KeepAlive           time.Duration
+	IdleConnTimeout     time.Duration
+	DNSCacheTTL         time.Duration
+}
+
+// NewTransport builds a http.Transport from http.DefaultTransport with the options applied.
+func NewTransport(opts TransportOptions) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	t.DisableKeepAlives = opts.DisableKeepAlives
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	if !opts.HTTP2 {
+		// https://pkg.go.dev/net/http#hdr-HTTP_2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: opts.KeepAlive,
+	}
+	t.DialContext = dialer.DialContext
+	if opts.DNSCacheTTL > 0 {
+		cache := &dnsCache{
+			dialer:  dialer,
+			ttl:     opts.DNSCacheTTL,
+			entries: make(map[string]dnsEntry),
+		}
+		t.DialContext = cache.DialContext
+	}
+	return t
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCache dials connections using cached DNS lookups.
+type dnsCache struct {
+	dialer *net.Dialer
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// lookup resolves host, using the cached result if it has not expired.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext implements http.Transport.DialContext.
+func (c *dnsCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// Try each address in turn like net.Dialer does
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = c.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// PreviousOutput is what -update needs from the CSV output of a previous crawl.
+type PreviousOutput struct {
+	// Columns are the columns of the header row, which the new rows are written in.
+	Columns []string
+	// Latest is the latest creation time of a repository in the output.
+	Latest time.Time
+	// Rows is the number of repositories in the output.
+	Rows int
+
+	seen map[string]struct{}
+}
+
+// ReadPreviousOutput reads the CSV output at path, which must have a -header row naming the created_at column
+// and the name_with_owner, or owner and name, columns.
+func ReadPreviousOutput(path string) (*PreviousOutput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: empty, expected a header row", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Tolerate output written with -bom
+	header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+	created, ok := index["created_at"]
+	if !ok {
+		return nil, fmt.Errorf("%s: no created_at column, the crawl must be run with -header and -columns including created_at", path)
+	}
+	nameWithOwner, ok := csvNameWithOwner(header)
+	if !ok {
+		return nil, fmt.Errorf("%s: no name_with_owner, or owner and name, columns", path)
+	}
+	prev := &PreviousOutput{Columns: header, seen: make(map[string]struct{})}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		prev.seen[nameWithOwner(record)] = struct{}{}
+		prev.Rows++
+		// A repository without a creation time has an empty created_at
+		if t, err := time.Parse(time.RFC3339, record[created]); err == nil && t.After(prev.Latest) {
+			prev.Latest = t
+		}
+	}
+	if prev.Latest.IsZero() {
+		return nil, fmt.Errorf("%s: no repositories with a created_at to update from", path)
+	}
+	return prev, nil
+}
+
+// Unseen drops the repositories already in the output.
+func (prev *PreviousOutput) Unseen(repo ghsearch.Repository) bool {
+	_, ok := prev.seen[repo.NameWithOwner]
+	return !ok
+}
+
+// CopyFile copies the file at src to dst, replacing it.
+func CopyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// buildDate is set by release builds with -ldflags "-X main.buildDate=...".
+var buildDate string
+
+// version is set by release builds with -ldflags "-X main.version=...", as a build of a checkout has no module
+// version of its own.
+var version string
+
+// BuildInfo identifies the binary that produced a dataset.
+type BuildInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit"`
+	Date     string `json:"date,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// ReadBuildInfo returns the module version and VCS details embedded by the Go toolchain.
+func ReadBuildInfo() BuildInfo {
+	b := BuildInfo{Version: "(devel)", Commit: "unknown", Date: buildDate}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		if version != "" {
+			b.Version = version
+		}
+		return b
+	}
+	b.Version = info.Main.Version
+	if version != "" {
+		b.Version = version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			b.Commit = setting.Value
+		case "vcs.time":
+			// Without an explicit build date the commit time is the best approximation
+			if b.Date == "" {
+				b.Date = setting.Value
+			}
+		case "vcs.modified":
+			b.Modified = setting.Value == "true"
+		}
+	}
+	return b
+}
+
+// String implements fmt.Stringer.
+func (b BuildInfo) String() string {
+	s := fmt.Sprintf("github-top-repos %s (commit %s", b.Version, b.Commit)
+	if b.Modified {
+		s += ", modified"
+	}
+	if b.Date != "" {
+		s += ", built " + b.Date
+	}
+	return s + ")"
+}
+
+// graphqlFields lists the GraphQL fields queried for t the same way the graphql package names them,
+// with the fields of nested objects as dotted paths.
+func graphqlFields(t reflect.Type, prefix string) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// The name is followed by any arguments and directives such as @include
+		name := field.Tag.Get("graphql")
+		if i := strings.IndexAny(name, "(@"); i >= 0 {
+			name = strings.TrimSpace(name[:i])
+		}
+		if name == "" {
+			r, size := utf8.DecodeRuneInString(field.Name)
+			name = string(unicode.ToLower(r)) + field.Name[size:]
+		}
+		// Inline fragments are part of their parent object
+		path := prefix + name
+		if strings.HasPrefix(name, "...") {
+			path = strings.TrimSuffix(prefix, ".")
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == "" {
+			fields = append(fields, graphqlFields(field.Type, strings.TrimPrefix(path+".", "."))...)
+		} else {
+			fields = append(fields, path)
+		}
+	}
+	return fields
+}
+
+// versionMain implements the version subcommand.
+func versionMain(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s version\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fmt.Println(ReadBuildInfo())
+	fmt.Println("GraphQL fields:", strings.Join(graphqlFields(reflect.TypeOf(ghsearch.Repository{}), ""), ", "))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bored-engineer/github-top-repos/pkg/ghsearch"
+)
+
+// CountWorkflowRuns returns the database ID of a repository and the number of Actions workflow runs created since.
+func CountWorkflowRuns(ctx context.Context, client *http.Client, restURL, nameWithOwner string, since time.Time) (int, int, error) {
+	// https://docs.github.com/en/rest/actions/workflow-runs#list-workflow-runs-for-a-repository
+	var runs struct {
+		TotalCount   int `json:"total_count"`
+		WorkflowRuns []struct {
+			Repository struct {
+				ID int `json:"id"`
+			} `json:"repository"`
+		} `json:"workflow_runs"`
+	}
+	url := restURL + "/repos/" + nameWithOwner + "/actions/runs?per_page=1&created=>=" + since.UTC().Format("2006-01-02")
+	if _, err := restGet(ctx, client, url, &runs); err != nil {
+		return 0, 0, err
+	}
+	if len(runs.WorkflowRuns) > 0 {
+		return runs.WorkflowRuns[0].Repository.ID, runs.TotalCount, nil
+	}
+	// Without any runs the database ID has to be looked up separately
+	var repo struct {
+		ID int `json:"id"`
+	}
+	if _, err := restGet(ctx, client, restURL+"/repos/"+nameWithOwner, &repo); err != nil {
+		return 0, 0, err
+	}
+	return repo.ID, 0, nil
+}
+
+// workflowRunsMain implements the workflow-runs subcommand.
+func workflowRunsMain(ctx context.Context, args []string) {
+	fs := newEnrichFlags("workflow-runs", 4, 100*time.Millisecond)
+	restURL := fs.String("rest-url", "https://api.github.com", "base URL of the GitHub REST API")
+	window := fs.Duration("since", 30*24*time.Hour, "count workflow runs created within this long")
+	repos := fs.parse(ctx, args)
+	transports, done := fs.transports(ctx)
+	defer done()
+	client := NewHTTPClient(ctx, transports.REST, Token("rest"))
+	since := time.Now().Add(-*window)
+
+	var mu sync.Mutex
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"database_id", "name_with_owner", "workflow_runs", "since"})
+	var failed atomic.Int64
+	forEachParallel(ctx, repos, *fs.Jobs, *fs.Interval, func(repo ghsearch.Repository) {
+		id, count, err := CountWorkflowRuns(ctx, client, *restURL, repo.NameWithOwner, since)
+		if err != nil {
+			log.Printf("Failed to count workflow runs of %s: %v", repo.NameWithOwner, err)
+			failed.Add(1)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]string{FormatInt(id), repo.NameWithOwner, FormatInt(count), FormatDate(since)})
+		w.Flush()
+	})
+	if err := w.Error(); err != nil {
+		fatal(err)
+	}
+	if n := failed.Load(); n > 0 {
+		log.Printf("Failed to count workflow runs of %d repositories", n)
+	}
+}
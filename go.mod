@@ -1,9 +1,12 @@
 module github.com/bored-engineer/github-top-repos
 
-go 1.21.4
+go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/shurcooL/githubv4 v0.0.0-20231126234147-1cffa1f02456
+	golang.org/x/mod v0.17.0
 	golang.org/x/oauth2 v0.15.0
 )
 
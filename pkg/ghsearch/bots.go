@@ -0,0 +1,41 @@
+package ghsearch
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ownerPattern returns the owner of a repository with any digits removed, so bot accounts
+// such as "user1" and "user2" share the same pattern.
+func ownerPattern(nameWithOwner string) string {
+	owner, _, _ := strings.Cut(nameWithOwner, "/")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, owner)
+}
+
+// SuspectedBots returns the repositories that belong to a group of at least threshold
+// near-identical repositories, having the same owner pattern, description and creation second.
+// Repositories without a valid creation time are never suspected, as they would all share it.
+func SuspectedBots(repos []Repository, threshold int) map[string]bool {
+	key := func(repo Repository) string {
+		return fmt.Sprintf("%s\x00%s\x00%d", ownerPattern(repo.NameWithOwner), repo.Description, repo.CreatedAt.Unix())
+	}
+	groups := make(map[string]int)
+	for _, repo := range repos {
+		if repo.HasCreatedAt() {
+			groups[key(repo)]++
+		}
+	}
+	suspected := make(map[string]bool)
+	for _, repo := range repos {
+		if repo.HasCreatedAt() && groups[key(repo)] >= threshold {
+			suspected[repo.NameWithOwner] = true
+		}
+	}
+	return suspected
+}
@@ -0,0 +1,206 @@
+package ghsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Checkpoint is the progress of a crawl after its last completed batch.
+type Checkpoint struct {
+	Field     string `json:"field"`
+	Ascending bool   `json:"ascending"`
+	SliceBy   string `json:"slice_by,omitempty"`
+	Query     string `json:"query"`
+	// CreatedAfter and CreatedBefore are kept so relative dates resolve the same when resumed.
+	CreatedAfter  time.Time `json:"created_after"`
+	CreatedBefore time.Time `json:"created_before"`
+	// Ranges and Range are the ranges of a multi-range crawl and the index of the current one.
+	Ranges    []CreatedRange `json:"ranges,omitempty"`
+	Range     int            `json:"range,omitempty"`
+	LastValue int            `json:"last_value"`
+	Emitted   int            `json:"emitted"`
+	// Seen is the DatabaseId of every repository found so far, so they are not emitted again, or the name of
+	// those found by older versions. It is read from the seen log alongside the checkpoint, see SeenLogPath,
+	// rather than saved in it, except by older versions.
+	Seen []string `json:"seen,omitempty"`
+}
+
+// SeenLogPath returns the path of the seen log of the checkpoint at path, which has a line of the DatabaseId of
+// each repository found by the crawl, appended to with each checkpoint rather than rewritten.
+func SeenLogPath(path string) string {
+	return path + ".seen"
+}
+
+// LoadCheckpoint reads the checkpoint at path and its seen log, returning nil if there is none.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	log, err := os.ReadFile(SeenLogPath(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// A line cut short by a crash while appending was never committed
+	if i := bytes.LastIndexByte(log, '\n'); i >= 0 {
+		for _, name := range bytes.Split(log[:i], []byte("\n")) {
+			cp.Seen = append(cp.Seen, string(name))
+		}
+	}
+	return &cp, nil
+}
+
+// RemoveCheckpoint removes the checkpoint at path and its seen log, if they exist.
+func RemoveCheckpoint(path string) error {
+	for _, name := range []string{path, SeenLogPath(path)} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save atomically replaces the checkpoint at path, so it is never left half written.
+// The seen log is left as is, see Crawler.SaveCheckpoint.
+func (cp *Checkpoint) Save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic replaces the file at path with b by renaming a synced temporary file over it.
+func writeFileAtomic(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// appendFile appends b to the file at path, creating it if needed, and syncs it.
+func appendFile(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveCheckpoint saves the progress of the crawl to the checkpoint at path. The repositories found since the
+// last save are appended to its seen log, so each save writes only what is new rather than every repository
+// found so far. The first save of a crawl replaces the seen log with every repository found.
+func (c *Crawler) SaveCheckpoint(path string) error {
+	var lines []byte
+	if c.logged {
+		for _, id := range c.unsaved {
+			lines = append(strconv.AppendInt(lines, int64(id), 10), '\n')
+		}
+		if err := appendFile(SeenLogPath(path), lines); err != nil {
+			return err
+		}
+	} else {
+		ids := make([]int, 0, len(c.uniq))
+		for id := range c.uniq {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			lines = append(strconv.AppendInt(lines, int64(id), 10), '\n')
+		}
+		names := make([]string, 0, len(c.uniqNames))
+		for name := range c.uniqNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(append(lines, name...), '\n')
+		}
+		if err := writeFileAtomic(SeenLogPath(path), lines); err != nil {
+			return err
+		}
+		c.logged = true
+	}
+	c.unsaved = c.unsaved[:0]
+	// The seen log is saved first, as a repository in it but not yet the checkpoint has already been written
+	return c.Checkpoint().Save(path)
+}
+
+// Checkpoint returns the progress of the crawl, without the repositories seen, which are saved by SaveCheckpoint.
+func (c *Crawler) Checkpoint() *Checkpoint {
+	return &Checkpoint{
+		Field:         c.Field,
+		Ascending:     c.Ascending,
+		SliceBy:       c.SliceBy,
+		Query:         c.Query,
+		CreatedAfter:  c.CreatedAfter,
+		CreatedBefore: c.CreatedBefore,
+		Ranges:        c.Ranges,
+		Range:         c.rangeIndex,
+		LastValue:     c.LastValue,
+		Emitted:       c.emitted,
+	}
+}
+
+// Restore continues the crawl from cp, which must be of the same crawl, including its created range.
+func (c *Crawler) Restore(cp *Checkpoint) error {
+	if cp.Field != c.Field || cp.Ascending != c.Ascending || cp.SliceBy != c.SliceBy || cp.Query != c.Query {
+		return fmt.Errorf("checkpoint is of a different crawl: %s %q", cp.Field, cp.Query)
+	}
+	if len(cp.Ranges) != len(c.Ranges) {
+		return fmt.Errorf("checkpoint is of a crawl of %d ranges, not %d", len(cp.Ranges), len(c.Ranges))
+	}
+	c.CreatedAfter, c.CreatedBefore = cp.CreatedAfter, cp.CreatedBefore
+	c.Ranges, c.rangeIndex = cp.Ranges, cp.Range
+	c.LastValue, c.emitted = cp.LastValue, cp.Emitted
+	c.uniq = make(map[int]struct{}, len(cp.Seen))
+	c.uniqNames = nil
+	for _, seen := range cp.Seen {
+		if id, err := strconv.Atoi(seen); err == nil {
+			c.uniq[id] = struct{}{}
+			continue
+		}
+		// Older versions saved the name, which is still matched but misses the repository if renamed
+		if c.uniqNames == nil {
+			c.uniqNames = make(map[string]struct{})
+		}
+		c.uniqNames[seen] = struct{}{}
+	}
+	// The next save rewrites the seen log, rather than trust it holds the Seen of an older version
+	c.logged, c.unsaved = false, nil
+	return nil
+}
@@ -0,0 +1,191 @@
+package ghsearch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// errKilled stops a crawl as if the process was killed.
+var errKilled = errors.New("killed")
+
+func TestCheckpointResume(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		crawler Crawler
+		// killedAt is the batch whose checkpoint is cut short, after appending to the seen log but before
+		// saving the checkpoint, from the second as the first has no checkpoint to continue from.
+		killedAt int
+		// rename renames every repository written by the killed run before the crawl is continued.
+		rename bool
+	}{
+		{"sorted batches", Crawler{Field: "stars"}, 2, false},
+		{"sorted batches renamed", Crawler{Field: "stars"}, 3, true},
+		{"ranges of stars", Crawler{Field: "stars", SliceBy: SliceStars}, 5, false},
+		{"ranges of stars renamed", Crawler{Field: "stars", SliceBy: SliceStars}, 5, true},
+		{"days of creation renamed", Crawler{Field: "stars", SliceBy: SliceCreated, CreatedAfter: testDay, CreatedBefore: testDay.AddDate(0, 0, 3)}, 4, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "checkpoint.json")
+			repos := fakeDataset()
+			// output is what was written before each checkpoint, while the rows since are lost if killed
+			var output, pending []Row
+			crawl := func(repos []fakeRepo, cp *Checkpoint, killedAt int) error {
+				server := newFakeSearchServer(t, repos)
+				c := tt.crawler
+				c.Client = server.client()
+				c.Emit = func(row Row) error {
+					pending = append(pending, row)
+					return nil
+				}
+				if cp != nil {
+					if err := c.Restore(cp); err != nil {
+						t.Fatal(err)
+					}
+				}
+				batch := 0
+				c.Completed = func() error {
+					output, pending = append(output, pending...), nil
+					if batch++; batch != killedAt {
+						return c.SaveCheckpoint(path)
+					}
+					previous, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SaveCheckpoint(path); err != nil {
+						t.Fatal(err)
+					}
+					// Put back the checkpoint as it was before the seen log was appended to
+					if err := os.WriteFile(path, previous, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return errKilled
+				}
+				return c.Run(context.Background())
+			}
+
+			if err := crawl(repos, nil, tt.killedAt); !errors.Is(err, errKilled) {
+				t.Fatalf("first run: %v, want it killed at batch %d", err, tt.killedAt)
+			}
+			pending = nil
+			written := len(output)
+			if tt.rename {
+				renamed := make(map[int]bool)
+				for _, row := range output {
+					renamed[row.DatabaseId] = true
+				}
+				for i := range repos {
+					if renamed[repos[i].id] {
+						repos[i].owner = "renamed"
+					}
+				}
+			}
+			cp, err := LoadCheckpoint(path)
+			if err != nil {
+				t.Fatal(err)
+			} else if cp == nil {
+				t.Fatal("no checkpoint after the first run")
+			}
+			if err := crawl(repos, cp, 0); err != nil {
+				t.Fatalf("continued run: %v", err)
+			}
+
+			count := make(map[int]int)
+			for _, row := range output {
+				count[row.DatabaseId]++
+			}
+			for _, repo := range repos {
+				switch n := count[repo.id]; {
+				case n == 0:
+					t.Errorf("%s was lost", repo.name())
+				case n > 1:
+					t.Errorf("%s was written %d times", repo.name(), n)
+				}
+			}
+			if written == 0 || written == len(output) {
+				t.Errorf("the killed run wrote %d of %d repositories, want some of them", written, len(output))
+			}
+		})
+	}
+}
+
+func TestCheckpointOlderVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	repos := fakeRepos(1, 10, func(i int, r *fakeRepo) { r.stars = 100 - i })
+	// An older version saved the name of each repository in the checkpoint itself
+	cp := &Checkpoint{Field: "stars", Seen: []string{repos[0].name(), repos[1].name()}}
+	if err := cp.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeSearchServer(t, repos)
+	c := Crawler{Client: server.client(), Field: "stars"}
+	var names []string
+	c.Emit = func(row Row) error {
+		names = append(names, row.NameWithOwner)
+		return nil
+	}
+	if err := c.Restore(cp); err != nil {
+		t.Fatal(err)
+	}
+	c.Completed = func() error {
+		return c.SaveCheckpoint(path)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 8 {
+		t.Errorf("emitted %q, want all but the 2 seen by name", names)
+	}
+	// The seen log keeps the names alongside the IDs found since
+	cp, err = LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10", "3", "4", "5", "6", "7", "8", "9", repos[0].name(), repos[1].name()}
+	sort.Strings(cp.Seen)
+	sort.Strings(want)
+	if !reflect.DeepEqual(cp.Seen, want) {
+		t.Errorf("seen %q, want %q", cp.Seen, want)
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if cp, err := LoadCheckpoint(path); cp != nil || err != nil {
+		t.Errorf("LoadCheckpoint() without one = %v, %v, want nil", cp, err)
+	}
+	saved := &Checkpoint{Field: "stars", SliceBy: SliceCreated, CreatedAfter: testDay, CreatedBefore: testDay.Add(time.Hour), LastValue: 42, Emitted: 3}
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	// A line cut short by a crash while appending was never committed
+	if err := os.WriteFile(SeenLogPath(path), []byte("1\n2\n3\n4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved.Seen = []string{"1", "2", "3"}
+	if !reflect.DeepEqual(cp, saved) {
+		t.Errorf("LoadCheckpoint() = %+v, want %+v", cp, saved)
+	}
+	if err := RemoveCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{path, SeenLogPath(path)} {
+		if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s after RemoveCheckpoint: %v", name, err)
+		}
+	}
+}
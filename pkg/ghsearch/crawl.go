@@ -0,0 +1,945 @@
+package ghsearch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// FanOutSorts are the alternate sort orders used to collect a batch stuck on a single value.
+var FanOutSorts = []string{"stars-desc", "stars-asc", "forks-desc", "forks-asc", "updated-desc", "updated-asc"}
+
+// GitHubLaunch is before the creation of any repository, so created and pushed ranges are clamped to start
+// from it rather than waste queries on windows that can only be empty.
+var GitHubLaunch = time.Date(2007, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+// Filter decides whether a repository found by the crawl is kept.
+type Filter func(Repository) bool
+
+// Row is a repository found by the crawl along with any annotations.
+type Row struct {
+	Repository
+	// SuspectedBot is set if the repository appears to be part of a bot wave.
+	SuspectedBot bool
+}
+
+// CreatedRange is a range of creation times [After, Before), either of which may be zero for unbounded.
+type CreatedRange struct {
+	After  time.Time `json:"after"`
+	Before time.Time `json:"before"`
+}
+
+// Progress is how far a crawl has got.
+type Progress struct {
+	// Batches is the number of batches completed.
+	Batches int
+	// Emitted is the number of repositories emitted, including by a restored checkpoint.
+	Emitted int
+	// Total estimates the repositories the whole crawl will emit, from the count of its first batch.
+	Total int
+	// LastValue is where the next batch starts.
+	LastValue int
+	// Range is the index of the current range of Crawler.Ranges.
+	Range int
+}
+
+// SliceBy values partitioning the crawl into independent searches.
+const (
+	// SliceStars searches ranges of stars.
+	SliceStars = "stars"
+	// SlicePushed searches windows of the time of the last push.
+	SlicePushed = "pushed"
+	// SliceCreated searches windows of the creation time.
+	SliceCreated = "created"
+)
+
+// Granularities are the sizes of the windows searched by SlicePushed and SliceCreated, finest first.
+var Granularities = []string{"1m", "10m", "30m", "hour", "day", "week", "month"}
+
+// GranularityAuto sizes each window searched by SlicePushed and SliceCreated by the density of the last,
+// starting from a day: windows over autoSliceLimit are split and the next made smaller, while sparse ones are
+// merged by making the next larger, so sparse searches take few requests and dense ones are still complete.
+const GranularityAuto = "auto"
+
+const (
+	// autoSliceLimit is the most repositories a window of GranularityAuto is searched with rather than split,
+	// short of the 1000 a search returns as counts still change during a crawl.
+	autoSliceLimit = 900
+	// autoSliceTarget is the number of repositories GranularityAuto aims for in each window.
+	autoSliceTarget = 600
+	// autoSliceGrowth is the most the next window of GranularityAuto grows by after a sparse one.
+	autoSliceGrowth = 4
+)
+
+// Crawler walks the repositories matching a query from the highest value of a field downwards.
+type Crawler struct {
+	Client *githubv4.Client
+	// Field is the field to sort by, one of stars, forks or size.
+	Field string
+	// Ascending walks from the lowest value upwards instead of the highest downwards.
+	Ascending bool
+	// SliceBy, if SliceStars, searches ranges of stars such as stars:100..199 instead of walking Field
+	// in sorted batches, splitting any range of more than 1000 repositories. Field must then be stars.
+	// If SlicePushed, it searches a Window of pushes at a time, each sorted by Field and split likewise,
+	// the created range bounds the push time instead and LastValue is the Unix time to continue from.
+	// SliceCreated does the same with windows of the creation time.
+	SliceBy string
+	// Window is the size of the windows searched by SlicePushed and SliceCreated, one of Granularities or
+	// GranularityAuto, day if empty. Larger windows save queries on selective searches, as a window is only split
+	// if over 1000, while smaller ones save the first search of each window that would be split on dense searches.
+	Window string
+	// Query is the prefix of every search, including any trailing space.
+	Query string
+	// DoublePass searches each batch twice and unions the results.
+	DoublePass bool
+	// SortFanOut re-runs a batch stuck on a single value with each of FanOutSorts.
+	SortFanOut bool
+	// MinStars excludes repositories with fewer stars, stopping the crawl early when sorting by stars.
+	MinStars int
+	// FanOutLanguages partitions a batch stuck on a single value by language.
+	FanOutLanguages []string
+	// CreatedFanOut partitions a batch stuck on a single value by bisecting the creation time, down to the second.
+	// This is done regardless if neither SortFanOut nor FanOutLanguages are set, rather than lose the repositories.
+	CreatedFanOut bool
+	// CreatedAfter and CreatedBefore limit the crawl to repositories created in [CreatedAfter, CreatedBefore),
+	// if not zero. They also bound the created fan-out, which otherwise spans GitHubLaunch to now.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Ranges, if set, are crawled one after another in place of CreatedAfter and CreatedBefore,
+	// sharing the de-duplication, Limit and progress.
+	Ranges []CreatedRange
+	// Languages is how many of the largest languages of each repository to fetch, 0 for none.
+	Languages int
+	// Topics is whether to fetch the topics of each repository.
+	Topics bool
+	// Flags, Owner and OwnerHistory are whether to fetch the fields of each repository of the same name of Pages.
+	Flags        bool
+	Owner        bool
+	OwnerHistory bool
+	// Concurrency is how many searches of a fan-out may run in parallel, sharing the client and its rate limits.
+	// Batches are still crawled one after another, as each starts where the last ended.
+	Concurrency int
+	// Limiter, if set, bounds the searches running at once in place of Concurrency, and may be shared with
+	// other crawls or have its limit changed while they run.
+	Limiter *Limiter
+	// Limit stops the crawl once this many repositories have been emitted, 0 for no limit.
+	Limit int
+	// WindowLimit stops paginating each window of SlicePushed and SliceCreated after this many repositories,
+	// 0 for no limit. A limited window isn't split or fanned out, so it is the top of the window by Field,
+	// such as the 100 most starred repositories created each day. It must not exceed 1000.
+	WindowLimit int
+	// BotThreshold annotates groups of at least this many near-identical repositories in a batch as suspected bots, 0 to disable.
+	BotThreshold int
+	// Skip, if set, reports whether a batch that failed with err is skipped, such as for a response too large
+	// to read, continuing the crawl with the next batch rather than ending it. The repositories of a skipped
+	// window or range of stars are lost, as are those with the value a sorted batch started from.
+	Skip func(err error) bool
+	// Filters drop any repository for which one returns false.
+	Filters []Filter
+	// Emit is called once for each unique repository found.
+	Emit func(Row) error
+	// Completed, if set, is called after each batch once every repository in it has been emitted.
+	Completed func() error
+	// OnBatch, if set, is called with the progress of the crawl after each batch.
+	OnBatch func(Progress)
+
+	// LastValue is where the next batch starts from, 0 to start from the first value.
+	LastValue int
+
+	// uniq is the DatabaseId of every repository found, which unlike the name doesn't change if it is renamed.
+	uniq map[int]struct{}
+	// uniqNames are the names of the repositories found by an older version, whose checkpoints only saved names.
+	uniqNames map[string]struct{}
+	// logged is whether the seen log of SaveCheckpoint holds uniq, except for unsaved
+	logged  bool
+	unsaved []int
+	emitted int
+	batches int
+	total   int
+	// rangeIndex is the index of the current range of Ranges.
+	rangeIndex int
+}
+
+// Run crawls batches until there are no more repositories or an error occurs.
+func (c *Crawler) Run(ctx context.Context) error {
+	if len(c.Ranges) == 0 {
+		return c.run(ctx)
+	}
+	for ; c.rangeIndex < len(c.Ranges); c.rangeIndex++ {
+		r := c.Ranges[c.rangeIndex]
+		c.CreatedAfter, c.CreatedBefore = r.After, r.Before
+		log.Printf("Crawling range %d of %d, from %s until %s", c.rangeIndex+1, len(c.Ranges), r.After.Format(time.RFC3339), r.Before.Format(time.RFC3339))
+		if err := c.run(ctx); err != nil {
+			return err
+		} else if c.Limit > 0 && c.emitted >= c.Limit {
+			return nil
+		}
+		// The next range starts over from the first value and is counted afresh
+		c.LastValue, c.total = 0, 0
+	}
+	return nil
+}
+
+// Plan returns the searches Run would start each created range with, without sending any, and the fewest
+// requests it would make. Each search fetches up to 1000 repositories in pages of 100 and any over 1000 are
+// searched again or split, so how many more requests it makes depends on the results.
+func (c *Crawler) Plan() ([]string, int) {
+	p := *c
+	ranges := p.Ranges
+	if len(ranges) == 0 {
+		ranges = []CreatedRange{{After: c.CreatedAfter, Before: c.CreatedBefore}}
+	}
+	passes := 1
+	if c.DoublePass {
+		passes = 2
+	}
+	var queries []string
+	var requests int
+	for i, r := range ranges {
+		p.CreatedAfter, p.CreatedBefore = r.After, r.Before
+		if i > 0 {
+			p.LastValue = 0
+		}
+		from, to := p.createdRange()
+		if to.Before(from) {
+			continue
+		}
+		switch p.SliceBy {
+		case SliceStars:
+			// The range of stars searched first is bounded by the most starred repository
+			lo := max(p.MinStars, 1)
+			if p.Ascending && p.LastValue > 0 {
+				lo = p.LastValue
+			}
+			if p.LastValue == 0 || p.Ascending {
+				queries = append(queries, fmt.Sprintf("%ssort:stars stars:>=%d%s", p.prefix(), lo, p.createdQualifier()))
+				requests++
+			}
+			requests += passes
+		case SlicePushed, SliceCreated:
+			if p.LastValue > 0 {
+				from = time.Unix(int64(p.LastValue), 0).UTC()
+			}
+			queries = append(queries, p.windowQuery(from, to))
+			requests++
+			if p.Window == GranularityAuto {
+				// Only the first window is known, the rest are sized by the results
+				last := from.Add(24*time.Hour - time.Second)
+				if last.After(to) {
+					last = to
+				}
+				queries = append(queries, p.windowQuery(from, last))
+				requests += passes
+				continue
+			}
+			for start := from; !start.After(to); {
+				end := windowEnd(start, p.Window)
+				last := end.Add(-time.Second)
+				if last.After(to) {
+					last = to
+				}
+				queries = append(queries, p.windowQuery(start, last))
+				requests += passes
+				start = end
+			}
+		default:
+			queries = append(queries, p.batchQuery())
+			requests += passes
+		}
+	}
+	return queries, requests
+}
+
+// run crawls batches of the current created range.
+func (c *Crawler) run(ctx context.Context) error {
+	// De-duplicate repos since we can't use the cursor forever
+	if c.uniq == nil {
+		c.uniq = make(map[int]struct{})
+	}
+	if c.Concurrency > 1 && c.Limiter == nil {
+		c.Limiter = NewLimiter(c.Concurrency)
+	}
+	from, to := c.createdRange()
+	if to.Before(from) {
+		log.Printf("Skipping the range ending %s, before GitHub launched", c.CreatedBefore.Format(time.RFC3339))
+		return nil
+	}
+	if !c.CreatedAfter.IsZero() {
+		ctx = withCrawledDay(ctx, from)
+	}
+	switch c.SliceBy {
+	case SliceStars:
+		return c.sliceStars(ctx)
+	case SlicePushed, SliceCreated:
+		return c.sliceTime(ctx)
+	}
+	for {
+		var limit int
+		if c.Limit > 0 {
+			limit = c.Limit - c.emitted
+		}
+		query := c.batchQuery()
+		// Run the query in batches of 1000 repos
+		repos, count, err := c.search(ctx, query, limit)
+		if err == nil && c.DoublePass {
+			// Search is eventually consistent, a second pass catches repos missed by the first
+			var again []Repository
+			var againCount int
+			if again, againCount, err = c.search(ctx, query, limit); err == nil {
+				repos = UnionRepositories(c.less, repos, again)
+				count = max(count, againCount)
+			}
+		}
+		if err != nil {
+			// The first batch has no value to skip past
+			if c.LastValue == 0 || !c.skip(query, err) {
+				return fmt.Errorf("batch %q: %w", query, err)
+			}
+			value, ok := c.nextValue(c.LastValue)
+			if !ok {
+				return nil
+			} else if err := c.complete(value); err != nil {
+				return err
+			}
+			continue
+		} else if len(repos) == 0 {
+			return nil
+		}
+		// The first batch of a run counts everything left to crawl
+		if c.total == 0 {
+			c.total = c.emitted + count
+			if c.Limit > 0 {
+				c.total = min(c.total, c.Limit)
+			}
+		}
+		if err := c.emit(repos); err != nil {
+			return err
+		} else if c.Limit > 0 && c.emitted >= c.Limit {
+			return nil
+		}
+		// If we have the same value as the start of this batch, can't loop further
+		value := repos[len(repos)-1].Value(c.Field)
+		if value == c.LastValue {
+			if count <= len(repos) {
+				return nil
+			}
+			if err := c.fanOut(ctx, value); err != nil && !c.skip(fmt.Sprintf("%s:%d", c.Field, value), err) {
+				return err
+			}
+			var ok bool
+			if value, ok = c.nextValue(value); !ok {
+				return nil
+			}
+		}
+		if err := c.complete(value); err != nil {
+			return err
+		}
+	}
+}
+
+// nextValue returns the value after value in the direction of the crawl, or false if it was the last.
+func (c *Crawler) nextValue(value int) (int, bool) {
+	minimum := 1
+	if c.Field == "stars" {
+		minimum = max(minimum, c.MinStars)
+	}
+	if c.Ascending {
+		return value + 1, true
+	} else if value <= minimum {
+		return 0, false
+	}
+	return value - 1, true
+}
+
+// skip reports whether the batch query that failed with err is skipped by Skip, logging it if so.
+func (c *Crawler) skip(query string, err error) bool {
+	if c.Skip == nil || !c.Skip(err) {
+		return false
+	}
+	log.Printf("Skipping batch %q: %v", query, err)
+	return true
+}
+
+// complete records the end of a batch, with the next starting from value.
+func (c *Crawler) complete(value int) error {
+	c.LastValue = value
+	c.batches++
+	if c.Completed != nil {
+		if err := c.Completed(); err != nil {
+			return err
+		}
+	}
+	if c.OnBatch != nil {
+		c.OnBatch(c.Progress())
+	}
+	return nil
+}
+
+// sliceStars crawls the current created range by ranges of stars, from the most starred repository
+// downwards (or from MinStars upwards if Ascending), continuing from LastValue if set.
+func (c *Crawler) sliceStars(ctx context.Context) error {
+	lo, hi := max(c.MinStars, 1), c.LastValue
+	if c.Ascending && c.LastValue > 0 {
+		lo, hi = c.LastValue, 0
+	}
+	if hi == 0 {
+		// The most starred repository bounds the ranges
+		query := fmt.Sprintf("%ssort:stars stars:>=%d%s", c.prefix(), lo, c.createdQualifier())
+		repos, _, err := c.search(ctx, query, 1)
+		if err != nil {
+			return fmt.Errorf("batch %q: %w", query, err)
+		} else if len(repos) == 0 {
+			return nil
+		}
+		hi = repos[0].Value("stars")
+	}
+	if hi < lo {
+		return nil
+	}
+	return c.sliceStarsRange(ctx, lo, hi)
+}
+
+// sliceStarsRange crawls the repositories with stars in [lo, hi], splitting the range in two
+// while it has more than 1000 and fanning out a single value that still does.
+func (c *Crawler) sliceStarsRange(ctx context.Context, lo, hi int) error {
+	query := fmt.Sprintf("%ssort:%s stars:%d..%d%s", c.prefix(), c.order(), lo, hi, c.createdQualifier())
+	var limit int
+	if c.Limit > 0 {
+		limit = c.Limit - c.emitted
+	}
+	splitAbove := 1000
+	if lo == hi {
+		splitAbove = 0
+	}
+	repos, count, err := c.searchSlice(ctx, query, limit, splitAbove)
+	if err == nil && c.DoublePass && (count <= 1000 || lo == hi) {
+		var again []Repository
+		var againCount int
+		if again, againCount, err = c.search(ctx, query, limit); err == nil {
+			repos = UnionRepositories(c.less, repos, again)
+			count = max(count, againCount)
+		}
+	}
+	if err != nil {
+		if !c.skip(query, err) {
+			return fmt.Errorf("batch %q: %w", query, err)
+		}
+		return c.completeStars(lo, hi)
+	}
+	// The first range is the whole crawl
+	if c.total == 0 {
+		c.total = c.emitted + count
+		if c.Limit > 0 {
+			c.total = min(c.total, c.Limit)
+		}
+	}
+	if count > 1000 && lo < hi {
+		// Stars are heavy tailed, splitting at the geometric mean keeps the halves closer in size
+		mid := min(max(int(math.Sqrt(float64(lo)*float64(hi))), lo), hi-1)
+		halves := [2][2]int{{mid + 1, hi}, {lo, mid}}
+		if c.Ascending {
+			halves[0], halves[1] = halves[1], halves[0]
+		}
+		for _, half := range halves {
+			if err := c.sliceStarsRange(ctx, half[0], half[1]); err != nil {
+				return err
+			} else if c.Limit > 0 && c.emitted >= c.Limit {
+				return nil
+			}
+		}
+		return nil
+	}
+	if err := c.emit(repos); err != nil {
+		return err
+	} else if c.Limit > 0 && c.emitted >= c.Limit {
+		return nil
+	}
+	if count > len(repos) && lo == hi {
+		if err := c.fanOut(ctx, lo); err != nil && !c.skip(query, err) {
+			return err
+		}
+	}
+	return c.completeStars(lo, hi)
+}
+
+// completeStars records the end of the range of stars [lo, hi].
+func (c *Crawler) completeStars(lo, hi int) error {
+	if c.Ascending {
+		return c.complete(hi + 1)
+	}
+	return c.complete(lo - 1)
+}
+
+// Progress returns the progress of the crawl, which must not be running.
+func (c *Crawler) Progress() Progress {
+	return Progress{Batches: c.batches, Emitted: c.emitted, Total: c.total, LastValue: c.LastValue, Range: c.rangeIndex}
+}
+
+// sliceTime crawls the current range a Window of pushes or creation times at a time, continuing from LastValue if set.
+func (c *Crawler) sliceTime(ctx context.Context) error {
+	from, to := c.createdRange()
+	if c.LastValue > 0 {
+		from = time.Unix(int64(c.LastValue), 0).UTC()
+	}
+	if c.total == 0 {
+		query := c.windowQuery(from, to)
+		_, count, err := c.search(ctx, query, 1)
+		if err != nil {
+			return fmt.Errorf("batch %q: %w", query, err)
+		}
+		c.total = c.emitted + count
+		if c.Limit > 0 {
+			c.total = min(c.total, c.Limit)
+		}
+	}
+	step := 24 * time.Hour
+	for start := from; !start.After(to); {
+		var end time.Time
+		if c.Window == GranularityAuto {
+			end = start.Add(step)
+		} else {
+			end = windowEnd(start, c.Window)
+		}
+		last := end.Add(-time.Second)
+		if last.After(to) {
+			last = to
+		}
+		count, err := c.sliceTimeRange(ctx, start, last)
+		if err != nil {
+			return err
+		} else if c.Limit > 0 && c.emitted >= c.Limit {
+			return nil
+		}
+		step = autoStep(last.Sub(start)+time.Second, count)
+		start = end
+	}
+	return nil
+}
+
+// autoStep returns the size of the next window of GranularityAuto after one of size held count repositories,
+// aiming for autoSliceTarget at the same density but growing at most autoSliceGrowth times, and at least a second.
+func autoStep(size time.Duration, count int) time.Duration {
+	if count*autoSliceGrowth <= autoSliceTarget {
+		return size * autoSliceGrowth
+	}
+	return max(size*autoSliceTarget/time.Duration(count), time.Second).Truncate(time.Second)
+}
+
+// sliceTimeRange crawls the repositories pushed to or created within [from, to], splitting the window in two
+// while it has more than 1000 (or autoSliceLimit), down to a single second which is bisected by creation time
+// (or searched with each of FanOutSorts if already a second of creation) instead. It returns the count of the
+// whole window.
+func (c *Crawler) sliceTimeRange(ctx context.Context, from, to time.Time) (int, error) {
+	ctx = withCrawledDay(ctx, from)
+	query := c.windowQuery(from, to)
+	var limit int
+	if c.Limit > 0 {
+		limit = c.Limit - c.emitted
+	}
+	splitAbove := 1000
+	if c.Window == GranularityAuto {
+		splitAbove = autoSliceLimit
+	}
+	if !to.After(from) {
+		splitAbove = 0
+	}
+	if c.WindowLimit > 0 {
+		// The first results of the whole window are its top, which splitting it would lose
+		if limit == 0 || c.WindowLimit < limit {
+			limit = c.WindowLimit
+		}
+		splitAbove = 0
+	}
+	repos, count, err := c.searchSlice(ctx, query, limit, splitAbove)
+	if err == nil && c.DoublePass && (splitAbove == 0 || count <= splitAbove) {
+		var again []Repository
+		var againCount int
+		if again, againCount, err = c.search(ctx, query, limit); err == nil {
+			repos = UnionRepositories(c.less, repos, again)
+			count = max(count, againCount)
+		}
+	}
+	if err != nil {
+		if !c.skip(query, err) {
+			return 0, fmt.Errorf("batch %q: %w", query, err)
+		}
+		return 0, c.complete(int(to.Unix()) + 1)
+	}
+	if splitAbove > 0 && count > splitAbove {
+		mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+		if _, err := c.sliceTimeRange(ctx, from, mid); err != nil {
+			return 0, err
+		} else if c.Limit > 0 && c.emitted >= c.Limit {
+			return count, nil
+		}
+		_, err := c.sliceTimeRange(ctx, mid.Add(time.Second), to)
+		return count, err
+	}
+	if err := c.emit(repos); err != nil {
+		return 0, err
+	} else if c.Limit > 0 && c.emitted >= c.Limit {
+		return count, nil
+	}
+	if count > len(repos) && c.WindowLimit == 0 {
+		var results [][]Repository
+		if c.SliceBy == SliceCreated {
+			// A single second of creations, such as a burst of bot repos, can only be searched in other orders
+			log.Printf("Batch %q exceeds 1000 results, searching it with each sort order", query)
+			results, _, err = c.searchOrders(ctx, fmt.Sprintf("%s created:%s", c.prefix(), from.Format(time.RFC3339)), FanOutSorts)
+		} else {
+			// A single second of pushes, such as a mass migration, is partitioned by creation time
+			window := fmt.Sprintf("%s pushed:%s", c.prefix(), from.Format(time.RFC3339))
+			log.Printf("Batch %q exceeds 1000 results, bisecting by creation time", window)
+			results, _, err = c.bisectCreated(ctx, window, GitHubLaunch, time.Now().UTC().Truncate(time.Second), []string{c.order()})
+		}
+		if err != nil {
+			if !c.skip(query, err) {
+				return 0, err
+			}
+		} else if err := c.emit(UnionRepositories(c.less, results...)); err != nil {
+			return 0, err
+		}
+	}
+	return count, c.complete(int(to.Unix()) + 1)
+}
+
+// windowQuery returns the search of the window [from, to] of the SliceBy time, sorted by Field.
+func (c *Crawler) windowQuery(from, to time.Time) string {
+	return fmt.Sprintf("%s %s:%s..%s", c.slicePrefix(), c.SliceBy, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// windowEnd returns the end of the window of one of Granularities containing t in UTC: the start of the next
+// minute, 10 or 30 minutes, hour, day (the default), Monday or month.
+func windowEnd(t time.Time, window string) time.Time {
+	switch window {
+	case "1m":
+		return t.UTC().Truncate(time.Minute).Add(time.Minute)
+	case "10m":
+		return t.UTC().Truncate(10 * time.Minute).Add(10 * time.Minute)
+	case "30m":
+		return t.UTC().Truncate(30 * time.Minute).Add(30 * time.Minute)
+	case "hour":
+		return t.UTC().Truncate(time.Hour).Add(time.Hour)
+	}
+	day := t.UTC().Truncate(24 * time.Hour)
+	switch window {
+	case "week":
+		return day.AddDate(0, 0, 7-(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	}
+	return day.AddDate(0, 0, 1)
+}
+
+// order returns the sort order of Field in the direction of the crawl.
+func (c *Crawler) order() string {
+	if c.Ascending {
+		return c.Field + "-asc"
+	}
+	return c.Field
+}
+
+// slicePrefix returns the Query sorted by Field with any qualifiers a slice requires.
+func (c *Crawler) slicePrefix() string {
+	query := c.prefix() + "sort:" + c.order()
+	if c.MinStars > 0 && c.Field == "stars" {
+		query += fmt.Sprintf(" stars:>=%d", c.MinStars)
+	}
+	return query
+}
+
+// prefix returns the Query with any qualifiers the crawl requires.
+func (c *Crawler) prefix() string {
+	if c.MinStars > 0 && c.Field != "stars" {
+		return c.Query + fmt.Sprintf("stars:>=%d ", c.MinStars)
+	}
+	return c.Query
+}
+
+// createdRange returns the inclusive range of creation times to crawl, to the second,
+// which is empty if it ends before GitHubLaunch.
+func (c *Crawler) createdRange() (time.Time, time.Time) {
+	from, to := GitHubLaunch, time.Now().UTC().Truncate(time.Second)
+	if c.CreatedAfter.After(GitHubLaunch) {
+		from = c.CreatedAfter.UTC().Truncate(time.Second)
+	}
+	if !c.CreatedBefore.IsZero() {
+		to = c.CreatedBefore.UTC().Add(-time.Second).Truncate(time.Second)
+	}
+	return from, to
+}
+
+// createdQualifier returns the created qualifier limiting a search to CreatedAfter and CreatedBefore, if set.
+func (c *Crawler) createdQualifier() string {
+	if c.CreatedAfter.IsZero() && c.CreatedBefore.IsZero() {
+		return ""
+	}
+	from, to := c.createdRange()
+	return fmt.Sprintf(" created:%s..%s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// batchQuery returns the search query for the batch starting at LastValue.
+func (c *Crawler) batchQuery() string {
+	// Sort the results by the highest (or lowest) value first
+	query := c.prefix() + "sort:" + c.Field
+	if c.Ascending {
+		query += "-asc"
+	}
+	// When crawling stars the minimum can be applied to the range directly
+	var minimum int
+	if c.Field == "stars" {
+		minimum = c.MinStars
+	}
+	switch {
+	case c.LastValue == 0 && minimum > 0:
+		query += fmt.Sprintf(" %s:>=%d", c.Field, minimum)
+	case c.LastValue == 0:
+		query += fmt.Sprintf(" %s:>0", c.Field)
+	case c.Ascending:
+		query += fmt.Sprintf(" %s:>=%d", c.Field, c.LastValue)
+	case minimum > 0:
+		query += fmt.Sprintf(" %s:%d..%d", c.Field, minimum, c.LastValue)
+	default:
+		// Like the first batch, stop above 0 as a LastValue of 0 would start over
+		query += fmt.Sprintf(" %s:1..%d", c.Field, c.LastValue)
+	}
+	return query + c.createdQualifier()
+}
+
+// less orders repositories in the direction of the crawl.
+func (c *Crawler) less(a, b Repository) bool {
+	if c.Ascending {
+		return a.Value(c.Field) < b.Value(c.Field)
+	}
+	return a.Value(c.Field) > b.Value(c.Field)
+}
+
+// fanOut collects the repositories with exactly value by partitioning the search by
+// FanOutLanguages and/or CreatedFanOut and re-running it with FanOutSorts,
+// as a single search is limited to 1000 results.
+func (c *Crawler) fanOut(ctx context.Context, value int) error {
+	query := fmt.Sprintf("%s%s:%d", c.prefix(), c.Field, value)
+	created := c.CreatedFanOut
+	if !c.SortFanOut && len(c.FanOutLanguages) == 0 && !created {
+		log.Printf("Batch %q exceeds 1000 results, bisecting by creation time", query)
+		created = true
+	}
+	partitions := []string{""}
+	if len(c.FanOutLanguages) > 0 {
+		// Each language is its own partition plus a remainder for everything else
+		partitions = nil
+		var remainder string
+		for _, language := range c.FanOutLanguages {
+			partitions = append(partitions, " language:"+language)
+			remainder += " -language:" + language
+		}
+		partitions = append(partitions, remainder)
+	}
+	// Bisection brings its own created qualifier within the range
+	if !created {
+		query += c.createdQualifier()
+	}
+	from, to := c.createdRange()
+	orders := []string{c.Field}
+	if c.Ascending {
+		orders[0] += "-asc"
+	}
+	if c.SortFanOut {
+		orders = FanOutSorts
+	}
+	partitionResults := make([][][]Repository, len(partitions))
+	counts := make([]int, len(partitions))
+	if err := c.each(len(partitions), func(i int) error {
+		var err error
+		if created {
+			partitionResults[i], counts[i], err = c.bisectCreated(ctx, query+partitions[i], from, to, orders)
+		} else {
+			partitionResults[i], counts[i], err = c.searchOrders(ctx, query+partitions[i], orders)
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+	var results [][]Repository
+	var total int
+	for i := range partitions {
+		results = append(results, partitionResults[i]...)
+		total += counts[i]
+	}
+	repos := UnionRepositories(c.less, results...)
+	if gap := total - len(repos); gap > 0 {
+		log.Printf("Fan-out of %q found %d of %d repositories, %d missing", query, len(repos), total, gap)
+	}
+	return c.emit(repos)
+}
+
+// searchOrders runs query with each of the sort orders, returning every result and the total count.
+func (c *Crawler) searchOrders(ctx context.Context, query string, orders []string) ([][]Repository, int, error) {
+	results := make([][]Repository, len(orders))
+	counts := make([]int, len(orders))
+	if err := c.each(len(orders), func(i int) error {
+		query := query + " sort:" + orders[i]
+		var err error
+		if results[i], counts[i], err = c.search(ctx, query, 0); err != nil {
+			return fmt.Errorf("batch %q: %w", query, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+	// Each order searches the same repositories
+	var total int
+	for _, count := range counts {
+		total = max(total, count)
+	}
+	return results, total, nil
+}
+
+// bisectCreated searches query within the created range [from, to], splitting the range in half
+// until it contains at most 1000 repositories or is a single second, such as a burst of bot repos.
+func (c *Crawler) bisectCreated(ctx context.Context, query string, from, to time.Time, orders []string) ([][]Repository, int, error) {
+	window := fmt.Sprintf("%s created:%s..%s", query, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	results, count, err := c.searchOrders(ctx, window, orders[:1])
+	if err != nil {
+		return nil, 0, err
+	}
+	if count <= 1000 {
+		return results, count, nil
+	}
+	if !to.After(from) {
+		// Can't split a single second any further, try the remaining orders instead
+		more, moreCount, err := c.searchOrders(ctx, window, orders[1:])
+		if err != nil {
+			return nil, 0, err
+		}
+		return append(results, more...), max(count, moreCount), nil
+	}
+	mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+	halves := [2][2]time.Time{{from, mid}, {mid.Add(time.Second), to}}
+	var halfResults [2][][]Repository
+	var halfCounts [2]int
+	if err := c.each(len(halves), func(i int) error {
+		var err error
+		halfResults[i], halfCounts[i], err = c.bisectCreated(ctx, query, halves[i][0], halves[i][1], orders)
+		return err
+	}); err != nil {
+		return nil, 0, err
+	}
+	return append(halfResults[0], halfResults[1]...), halfCounts[0] + halfCounts[1], nil
+}
+
+// search runs a search, waiting for one of the Concurrency slots if limited.
+func (c *Crawler) search(ctx context.Context, query string, limit int) ([]Repository, int, error) {
+	return c.searchSlice(ctx, query, limit, 0)
+}
+
+// searchSlice runs a search like search, but if splitAbove is set and the first page counts
+// more repositories it stops there, returning only the count.
+func (c *Crawler) searchSlice(ctx context.Context, query string, limit int, splitAbove int) ([]Repository, int, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Acquire(ctx); err != nil {
+			return nil, 0, err
+		}
+		defer c.Limiter.Release()
+	}
+	pages := NewPages(c.Client, query)
+	pages.Languages = c.Languages
+	pages.Topics = c.Topics
+	pages.Flags, pages.Owner, pages.OwnerHistory = c.Flags, c.Owner, c.OwnerHistory
+	if splitAbove == 0 {
+		return pages.All(ctx, limit)
+	}
+	first := 100
+	if limit > 0 {
+		first = min(first, limit)
+	}
+	repos, err := pages.Next(ctx, first)
+	if err != nil {
+		return nil, 0, err
+	} else if pages.Count > splitAbove {
+		return nil, pages.Count, nil
+	} else if limit > 0 && len(repos) >= limit {
+		return repos, pages.Count, nil
+	}
+	if limit > 0 {
+		limit -= len(repos)
+	}
+	more, count, err := pages.All(ctx, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(repos, more...), count, nil
+}
+
+// each calls fn with each index up to n, in parallel if there is a Limiter, returning the first error.
+func (c *Crawler) each(n int, fn func(i int) error) error {
+	if c.Limiter == nil {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keep reports whether repo passes every filter.
+func (c *Crawler) keep(repo Repository) bool {
+	for _, filter := range c.Filters {
+		if !filter(repo) {
+			return false
+		}
+	}
+	return true
+}
+
+// emit calls Emit for each repository that has not been seen before.
+func (c *Crawler) emit(repos []Repository) error {
+	var bots map[string]bool
+	if c.BotThreshold > 0 {
+		bots = SuspectedBots(repos, c.BotThreshold)
+	}
+	for _, repo := range repos {
+		if c.Limit > 0 && c.emitted >= c.Limit {
+			return nil
+		}
+		if _, ok := c.uniq[repo.DatabaseId]; ok {
+			continue
+		} else if _, ok := c.uniqNames[repo.NameWithOwner]; ok {
+			continue
+		}
+		c.uniq[repo.DatabaseId] = struct{}{}
+		if c.logged {
+			c.unsaved = append(c.unsaved, repo.DatabaseId)
+		}
+		if !c.keep(repo) {
+			continue
+		}
+		c.emitted++
+		if err := c.Emit(Row{Repository: repo, SuspectedBot: bots[repo.NameWithOwner]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
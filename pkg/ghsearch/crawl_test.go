@@ -0,0 +1,666 @@
+package ghsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// fakeRepo is a repository of the fake search server.
+type fakeRepo struct {
+	id int
+	// owner is owner if empty, and changed to rename the repository
+	owner    string
+	stars    int
+	forks    int
+	created  time.Time
+	pushed   time.Time
+	language string
+}
+
+func (r fakeRepo) name() string {
+	owner := r.owner
+	if owner == "" {
+		owner = "owner"
+	}
+	return fmt.Sprintf("%s/repo%d", owner, r.id)
+}
+
+// fakeSearch is a search of fakeSearchServer and how many repositories matched it.
+type fakeSearch struct {
+	query string
+	first int
+	count int
+}
+
+// fakeSearchServer serves the GraphQL search of repos the way GitHub does: qualifiers of stars, forks, size,
+// created, pushed and language, sort orders, and at most 1000 results however many match.
+type fakeSearchServer struct {
+	*httptest.Server
+	t     testing.TB
+	repos []fakeRepo
+
+	mu       sync.Mutex
+	searches []fakeSearch
+}
+
+func newFakeSearchServer(t testing.TB, repos []fakeRepo) *fakeSearchServer {
+	s := &fakeSearchServer{t: t, repos: repos}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client returns a client of the GraphQL API of the server.
+func (s *fakeSearchServer) client() *githubv4.Client {
+	return githubv4.NewEnterpriseClient(s.URL, s.Client())
+}
+
+// Searches returns every search served so far.
+func (s *fakeSearchServer) Searches() []fakeSearch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSearch(nil), s.searches...)
+}
+
+func (s *fakeSearchServer) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Variables struct {
+			Query  string  `json:"query"`
+			First  int     `json:"first"`
+			Cursor *string `json:"cursor"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matches, err := s.match(req.Variables.Query)
+	if err != nil {
+		s.t.Errorf("search %q: %v", req.Variables.Query, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := 0
+	if req.Variables.Cursor != nil {
+		offset, _ = strconv.Atoi(*req.Variables.Cursor)
+	}
+	if offset == 0 {
+		s.mu.Lock()
+		s.searches = append(s.searches, fakeSearch{query: req.Variables.Query, first: req.Variables.First, count: len(matches)})
+		s.mu.Unlock()
+	}
+	// A search never returns more than 1000 results
+	available := min(len(matches), 1000)
+	end := min(offset+req.Variables.First, available)
+	nodes := []map[string]any{}
+	for _, repo := range matches[min(offset, end):end] {
+		nodes = append(nodes, map[string]any{
+			"databaseId":      repo.id,
+			"nameWithOwner":   repo.name(),
+			"stargazerCount":  repo.stars,
+			"forkCount":       repo.forks,
+			"diskUsage":       repo.id,
+			"description":     "",
+			"createdAt":       repo.created.Format(time.RFC3339),
+			"primaryLanguage": map[string]any{"name": repo.language},
+			"licenseInfo":     nil,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+		"rateLimit": map[string]any{"cost": 1},
+		"search": map[string]any{
+			"repositoryCount": len(matches),
+			"nodes":           nodes,
+			"pageInfo":        map[string]any{"endCursor": strconv.Itoa(end), "hasNextPage": end < available},
+		},
+	}})
+}
+
+// match returns the repos matching query in its sort order, ties broken by ID in the same direction so the
+// ascending and descending orders of a sort are the reverse of each other.
+func (s *fakeSearchServer) match(query string) ([]fakeRepo, error) {
+	var filters []func(fakeRepo) bool
+	sortField, desc := "best-match", true
+	for _, term := range strings.Fields(query) {
+		negate := strings.HasPrefix(term, "-")
+		qualifier, value, ok := strings.Cut(strings.TrimPrefix(term, "-"), ":")
+		if !ok {
+			return nil, fmt.Errorf("unexpected term %q", term)
+		}
+		var filter func(fakeRepo) bool
+		switch qualifier {
+		case "sort":
+			field, order, _ := strings.Cut(value, "-")
+			sortField, desc = field, order != "asc"
+			continue
+		case "stars", "forks", "size":
+			match, err := fakeIntRange(value)
+			if err != nil {
+				return nil, err
+			}
+			field := qualifier
+			filter = func(r fakeRepo) bool { return match(fakeValue(r, field)) }
+		case "created", "pushed":
+			match, err := fakeTimeRange(value)
+			if err != nil {
+				return nil, err
+			}
+			if qualifier == "created" {
+				filter = func(r fakeRepo) bool { return match(r.created) }
+			} else {
+				filter = func(r fakeRepo) bool { return match(r.pushed) }
+			}
+		case "language":
+			filter = func(r fakeRepo) bool { return strings.EqualFold(r.language, value) }
+		default:
+			return nil, fmt.Errorf("unexpected qualifier %q", term)
+		}
+		if negate {
+			positive := filter
+			filter = func(r fakeRepo) bool { return !positive(r) }
+		}
+		filters = append(filters, filter)
+	}
+	var matches []fakeRepo
+	for _, repo := range s.repos {
+		keep := true
+		for _, filter := range filters {
+			keep = keep && filter(repo)
+		}
+		if keep {
+			matches = append(matches, repo)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := fakeValue(matches[i], sortField), fakeValue(matches[j], sortField)
+		if a == b {
+			a, b = matches[i].id, matches[j].id
+		}
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+	return matches, nil
+}
+
+// fakeValue returns the value of r sorted or qualified by field.
+func fakeValue(r fakeRepo, field string) int {
+	switch field {
+	case "stars":
+		return r.stars
+	case "forks":
+		return r.forks
+	case "size":
+		return r.id
+	case "updated":
+		return int(r.pushed.Unix())
+	}
+	return r.id
+}
+
+// fakeIntRange parses the value of a numeric qualifier, such as 10, >0, >=10, <=10 or 10..20.
+func fakeIntRange(value string) (func(int) bool, error) {
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(value, op); ok {
+			n, err := strconv.Atoi(rest)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case ">=":
+				return func(v int) bool { return v >= n }, nil
+			case "<=":
+				return func(v int) bool { return v <= n }, nil
+			case ">":
+				return func(v int) bool { return v > n }, nil
+			}
+			return func(v int) bool { return v < n }, nil
+		}
+	}
+	lo, hi, ok := strings.Cut(value, "..")
+	if !ok {
+		hi = lo
+	}
+	l, err := strconv.Atoi(lo)
+	if err != nil {
+		return nil, err
+	}
+	h, err := strconv.Atoi(hi)
+	if err != nil {
+		return nil, err
+	}
+	return func(v int) bool { return v >= l && v <= h }, nil
+}
+
+// fakeTimeRange parses the value of a time qualifier, a single second or an inclusive range of them.
+func fakeTimeRange(value string) (func(time.Time) bool, error) {
+	lo, hi, ok := strings.Cut(value, "..")
+	if !ok {
+		hi = lo
+	}
+	from, err := time.Parse(time.RFC3339, lo)
+	if err != nil {
+		return nil, err
+	}
+	to, err := time.Parse(time.RFC3339, hi)
+	if err != nil {
+		return nil, err
+	}
+	return func(t time.Time) bool { return !t.Before(from) && !t.After(to) }, nil
+}
+
+// testDay is the first day the created and pushed times of the test repositories are spread over.
+var testDay = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeRepos returns n repositories with IDs from first, each set by fn from its index.
+func fakeRepos(first, n int, fn func(i int, r *fakeRepo)) []fakeRepo {
+	repos := make([]fakeRepo, n)
+	for i := range repos {
+		repos[i] = fakeRepo{id: first + i, stars: 1, created: testDay, pushed: testDay, language: "Go"}
+		fn(i, &repos[i])
+	}
+	return repos
+}
+
+// fakeDataset is a heavy tailed spread of stars over a few days, with a single star count, day and second that
+// are each over the 1000 a search returns.
+func fakeDataset() []fakeRepo {
+	var repos []fakeRepo
+	// A tail of 3000 repositories, spread over three days
+	repos = append(repos, fakeRepos(1, 3000, func(i int, r *fakeRepo) {
+		r.stars = 1 + 100000/(i+1)
+		r.forks = i
+		r.created = testDay.Add(time.Duration(i) * 86 * time.Second)
+		r.pushed = r.created.Add(time.Hour)
+		r.language = []string{"Go", "Rust", "Python"}[i%3]
+	})...)
+	// 1500 repositories of 3 stars, spread over the second day, more than one search can return
+	repos = append(repos, fakeRepos(10001, 1500, func(i int, r *fakeRepo) {
+		r.stars = 3
+		r.forks = 5000 + i
+		r.created = testDay.Add(24*time.Hour + time.Duration(i)*57*time.Second)
+		r.pushed = r.created.Add(time.Minute)
+		r.language = []string{"Go", "Go", "Rust", "Python"}[i%4]
+	})...)
+	// 1200 repositories created and pushed to in the same second of the third day, such as a burst of bots
+	burst := testDay.Add(2*24*time.Hour + 12*time.Hour)
+	repos = append(repos, fakeRepos(20001, 1200, func(i int, r *fakeRepo) {
+		r.stars = 10 + i
+		r.forks = i
+		r.created = burst
+		r.pushed = burst
+		r.language = "Python"
+	})...)
+	return repos
+}
+
+// starsWindow and timeWindow match the searches of a single range of stars or window of time.
+var (
+	starsWindow = regexp.MustCompile(`^sort:stars(?:-asc)? stars:(\d+)\.\.(\d+)$`)
+	timeWindow  = regexp.MustCompile(`^sort:\S+ (?:created|pushed):(\S+)\.\.(\S+)$`)
+)
+
+// checkTiling checks that the ranges searched without being split, parsed from the searches by window, cover
+// [lo, hi] exactly once between them, so no repository at the boundary of two is searched by neither or both.
+func checkTiling(t *testing.T, searches []fakeSearch, window *regexp.Regexp, parse func(string) int64, splitAbove int, lo, hi int64) {
+	t.Helper()
+	type span struct{ lo, hi int64 }
+	seen := make(map[span]bool)
+	var spans []span
+	for _, search := range searches {
+		m := window.FindStringSubmatch(strings.Join(strings.Fields(search.query), " "))
+		// A search of the first result only counts the whole range
+		if m == nil || search.first == 1 {
+			continue
+		}
+		s := span{parse(m[1]), parse(m[2])}
+		if (search.count <= splitAbove || s.lo == s.hi) && !seen[s] {
+			seen[s] = true
+			spans = append(spans, s)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lo < spans[j].lo })
+	next := lo
+	for _, s := range spans {
+		if s.lo != next {
+			t.Errorf("searched %d..%d after a range ending at %d", s.lo, s.hi, next-1)
+		}
+		next = s.hi + 1
+	}
+	if next != hi+1 {
+		t.Errorf("the searched ranges end at %d, not %d", next-1, hi)
+	}
+}
+
+func parseStars(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func parseUnix(s string) int64 {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t.Unix()
+}
+
+func TestCrawler(t *testing.T) {
+	repos := fakeDataset()
+	maxStars := 0
+	for _, repo := range repos {
+		maxStars = max(maxStars, repo.stars)
+	}
+	from, before := testDay, testDay.AddDate(0, 0, 3)
+	for _, tt := range []struct {
+		name string
+		// repos are searched instead of the fakeDataset if set
+		repos   []fakeRepo
+		crawler Crawler
+		// want is whether a repository of the dataset is expected, all if nil
+		want func(fakeRepo) bool
+		// fanOut, if set, matches a search the crawl must make to collect a value or second over the cap
+		fanOut string
+		// tiling checks the ranges of stars or windows of time searched without being split
+		tiling func(t *testing.T, searches []fakeSearch)
+	}{
+		{
+			name:    "sorted batches bisect a star count by creation time",
+			crawler: Crawler{Field: "stars"},
+			fanOut:  `^stars:3 created:\S+\.\.\S+ sort:stars$`,
+		},
+		{
+			name:    "sorted batches ascending",
+			crawler: Crawler{Field: "stars", Ascending: true},
+			fanOut:  `^stars:3 created:\S+\.\.\S+ sort:stars-asc$`,
+		},
+		{
+			name:    "sorted batches fan out by language",
+			crawler: Crawler{Field: "stars", FanOutLanguages: []string{"Go", "Rust"}, Concurrency: 4},
+			fanOut:  `^stars:3 -language:Go -language:Rust sort:stars$`,
+		},
+		{
+			name: "sorted batches fan out by sort order",
+			// The orders only reach 2000 of a star count, so it's at most that
+			repos: fakeRepos(1, 1800, func(i int, r *fakeRepo) {
+				r.stars = 3 + i/1500
+				r.forks = i
+				r.pushed = testDay.Add(time.Duration(i) * time.Minute)
+			}),
+			crawler: Crawler{Field: "stars", SortFanOut: true},
+			fanOut:  `^stars:3 sort:forks-asc$`,
+		},
+		{
+			name:    "sorted batches fan out by language and creation time",
+			crawler: Crawler{Field: "stars", FanOutLanguages: []string{"Python"}, CreatedFanOut: true, Concurrency: 3},
+			fanOut:  `^stars:3 -language:Python created:\S+\.\.\S+ sort:stars$`,
+		},
+		{
+			name:    "sorted batches stop at the minimum stars",
+			crawler: Crawler{Field: "stars", MinStars: 40},
+			want:    func(r fakeRepo) bool { return r.stars >= 40 },
+		},
+		{
+			name:    "sorted batches of forks",
+			crawler: Crawler{Field: "forks", MinStars: 2},
+			// A sorted walk only reaches repositories with a value above 0
+			want: func(r fakeRepo) bool { return r.forks > 0 && r.stars >= 2 },
+		},
+		{
+			name:    "sorted batches of a created range",
+			crawler: Crawler{Field: "stars", CreatedAfter: from.Add(24 * time.Hour), CreatedBefore: from.Add(48 * time.Hour)},
+			want: func(r fakeRepo) bool {
+				return !r.created.Before(from.Add(24*time.Hour)) && r.created.Before(from.Add(48*time.Hour))
+			},
+		},
+		{
+			name:    "ranges of stars",
+			crawler: Crawler{Field: "stars", SliceBy: SliceStars},
+			fanOut:  `^stars:3 created:\S+\.\.\S+ sort:stars$`,
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, starsWindow, parseStars, 1000, 1, int64(maxStars))
+			},
+		},
+		{
+			name:    "ranges of stars ascending from the minimum",
+			crawler: Crawler{Field: "stars", SliceBy: SliceStars, Ascending: true, MinStars: 2, Concurrency: 2},
+			want:    func(r fakeRepo) bool { return r.stars >= 2 },
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, starsWindow, parseStars, 1000, 2, int64(maxStars))
+			},
+		},
+		{
+			name:    "ranges of stars fan out a star count by language",
+			crawler: Crawler{Field: "stars", SliceBy: SliceStars, FanOutLanguages: []string{"Go"}},
+			fanOut:  `^stars:3 language:Go sort:stars$`,
+		},
+		{
+			name:    "days of creation",
+			crawler: Crawler{Field: "stars", SliceBy: SliceCreated, CreatedAfter: from, CreatedBefore: before},
+			fanOut:  `^created:\S+ sort:forks-asc$`,
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, timeWindow, parseUnix, 1000, from.Unix(), before.Unix()-1)
+			},
+		},
+		{
+			name:    "hours of creation ascending",
+			crawler: Crawler{Field: "stars", Ascending: true, SliceBy: SliceCreated, Window: "hour", CreatedAfter: from, CreatedBefore: before, Concurrency: 2},
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, timeWindow, parseUnix, 1000, from.Unix(), before.Unix()-1)
+			},
+		},
+		{
+			name:    "automatic windows of creation",
+			crawler: Crawler{Field: "stars", SliceBy: SliceCreated, Window: GranularityAuto, CreatedAfter: from, CreatedBefore: before},
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, timeWindow, parseUnix, autoSliceLimit, from.Unix(), before.Unix()-1)
+			},
+		},
+		{
+			name:    "months of creation of part of a day",
+			crawler: Crawler{Field: "stars", SliceBy: SliceCreated, Window: "month", CreatedAfter: from.Add(36 * time.Hour), CreatedBefore: before},
+			want:    func(r fakeRepo) bool { return !r.created.Before(from.Add(36 * time.Hour)) },
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, timeWindow, parseUnix, 1000, from.Add(36*time.Hour).Unix(), before.Unix()-1)
+			},
+		},
+		{
+			name:    "days of pushes bisect a second by creation time",
+			repos:   pushBurst(),
+			crawler: Crawler{Field: "stars", SliceBy: SlicePushed, CreatedAfter: from, CreatedBefore: before},
+			fanOut:  `^pushed:\S+ created:\S+\.\.\S+ sort:stars$`,
+			tiling: func(t *testing.T, searches []fakeSearch) {
+				checkTiling(t, searches, timeWindow, parseUnix, 1000, from.Unix(), before.Unix()-1)
+			},
+		},
+		{
+			name:    "ranges of creation",
+			crawler: Crawler{Field: "stars", Ranges: []CreatedRange{{After: from, Before: from.Add(24 * time.Hour)}, {After: from.Add(48 * time.Hour), Before: before}}},
+			want: func(r fakeRepo) bool {
+				return r.created.Before(from.Add(24*time.Hour)) || !r.created.Before(from.Add(48*time.Hour))
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset := repos
+			if tt.repos != nil {
+				dataset = tt.repos
+			}
+			server := newFakeSearchServer(t, dataset)
+			c := tt.crawler
+			c.Client = server.client()
+			emitted := make(map[string]int)
+			c.Emit = func(row Row) error {
+				emitted[row.NameWithOwner]++
+				return nil
+			}
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			var missing []string
+			wanted := 0
+			for _, repo := range dataset {
+				if tt.want != nil && !tt.want(repo) {
+					if emitted[repo.name()] > 0 {
+						t.Errorf("%s was emitted, but is outside the crawl", repo.name())
+					}
+					continue
+				}
+				wanted++
+				if emitted[repo.name()] == 0 {
+					missing = append(missing, repo.name())
+				}
+			}
+			if len(missing) > 0 {
+				t.Errorf("%d of %d repositories were not emitted, such as %s", len(missing), wanted, missing[0])
+			}
+			for name, n := range emitted {
+				if n > 1 {
+					t.Errorf("%s was emitted %d times", name, n)
+				}
+			}
+			if got := c.Progress().Emitted; got != len(emitted) {
+				t.Errorf("Progress().Emitted = %d, %d were emitted", got, len(emitted))
+			}
+
+			// The crawl must have had to get past the limit of a search
+			searches := server.Searches()
+			capped := false
+			for _, search := range searches {
+				capped = capped || search.count > 1000
+			}
+			if !capped {
+				t.Error("no search matched more than 1000 repositories")
+			}
+			if tt.fanOut != "" {
+				fanOut := regexp.MustCompile(tt.fanOut)
+				found := false
+				for _, search := range searches {
+					found = found || fanOut.MatchString(strings.Join(strings.Fields(search.query), " "))
+				}
+				if !found {
+					t.Errorf("no search matched %s", tt.fanOut)
+				}
+			}
+			if tt.tiling != nil {
+				tt.tiling(t, searches)
+			}
+		})
+	}
+}
+
+// pushBurst returns repositories pushed to in the same second, such as by a mass migration, spread over their
+// creation times.
+func pushBurst() []fakeRepo {
+	push := testDay.Add(30 * time.Hour)
+	return append(fakeRepos(1, 1300, func(i int, r *fakeRepo) {
+		r.stars = 1 + i
+		r.created = GitHubLaunch.Add(time.Duration(i) * 24 * time.Hour)
+		r.pushed = push
+	}), fakeRepos(5001, 500, func(i int, r *fakeRepo) {
+		r.stars = 1 + i%7
+		r.created = GitHubLaunch.Add(time.Duration(i) * time.Hour)
+		r.pushed = testDay.Add(time.Duration(i) * 5 * time.Minute)
+	})...)
+}
+
+func TestCrawlerLimit(t *testing.T) {
+	for _, sliceBy := range []string{"", SliceStars, SliceCreated} {
+		t.Run("slice by "+sliceBy, func(t *testing.T) {
+			server := newFakeSearchServer(t, fakeDataset())
+			var rows []Row
+			c := Crawler{Client: server.client(), Field: "stars", SliceBy: sliceBy, Limit: 1234, CreatedAfter: testDay, CreatedBefore: testDay.AddDate(0, 0, 3)}
+			c.Emit = func(row Row) error {
+				rows = append(rows, row)
+				return nil
+			}
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1234 {
+				t.Errorf("emitted %d repositories, want the limit of 1234", len(rows))
+			}
+		})
+	}
+}
+
+func TestCrawlerWindowLimit(t *testing.T) {
+	repos := fakeDataset()
+	server := newFakeSearchServer(t, repos)
+	emitted := make(map[string]bool)
+	c := Crawler{Client: server.client(), Field: "stars", SliceBy: SliceCreated, WindowLimit: 10, CreatedAfter: testDay, CreatedBefore: testDay.AddDate(0, 0, 3)}
+	c.Emit = func(row Row) error {
+		emitted[row.NameWithOwner] = true
+		return nil
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The top 10 of each day by stars, the same as the search sorts them
+	for day := 0; day < 3; day++ {
+		start := testDay.AddDate(0, 0, day)
+		top, err := server.match(fmt.Sprintf("sort:stars created:%s..%s", start.Format(time.RFC3339), start.Add(24*time.Hour-time.Second).Format(time.RFC3339)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, repo := range top[:10] {
+			if !emitted[repo.name()] {
+				t.Errorf("%s is in the top 10 of day %d but was not emitted", repo.name(), day)
+			}
+		}
+	}
+	if len(emitted) != 30 {
+		t.Errorf("emitted %d repositories, want 10 for each of 3 days", len(emitted))
+	}
+}
+
+func TestWindowEnd(t *testing.T) {
+	at := time.Date(2024, time.February, 29, 13, 47, 5, 0, time.UTC)
+	for window, want := range map[string]time.Time{
+		"1m":    time.Date(2024, time.February, 29, 13, 48, 0, 0, time.UTC),
+		"10m":   time.Date(2024, time.February, 29, 13, 50, 0, 0, time.UTC),
+		"30m":   time.Date(2024, time.February, 29, 14, 0, 0, 0, time.UTC),
+		"hour":  time.Date(2024, time.February, 29, 14, 0, 0, 0, time.UTC),
+		"":      time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		"day":   time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		"week":  time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC),
+		"month": time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		if got := windowEnd(at, window); !got.Equal(want) {
+			t.Errorf("windowEnd(%s, %q) = %s, want %s", at, window, got, want)
+		}
+	}
+}
+
+func TestAutoStep(t *testing.T) {
+	for _, tt := range []struct {
+		size  time.Duration
+		count int
+		want  time.Duration
+	}{
+		// Sparse windows grow at most 4 times
+		{24 * time.Hour, 0, 96 * time.Hour},
+		{24 * time.Hour, 150, 96 * time.Hour},
+		// Dense ones shrink toward 600 at the same density
+		{24 * time.Hour, 1200, 12 * time.Hour},
+		{time.Hour, 300, 2 * time.Hour},
+		// But never below a second
+		{time.Second, 100000, time.Second},
+	} {
+		if got := autoStep(tt.size, tt.count); got != tt.want {
+			t.Errorf("autoStep(%s, %d) = %s, want %s", tt.size, tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package ghsearch
+
+import (
+	"context"
+	"time"
+)
+
+// crawledDayKey is the context key of the day a search is crawling.
+type crawledDayKey struct{}
+
+// withCrawledDay returns a copy of ctx whose searches are crawling the UTC day of t.
+func withCrawledDay(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, crawledDayKey{}, t.UTC().Truncate(24*time.Hour))
+}
+
+// CrawledDay returns the UTC day a request of a Crawler is crawling, the day its window of creation or push
+// times starts, or false if it isn't limited to a window, such as a crawl of every creation time.
+func CrawledDay(ctx context.Context) (time.Time, bool) {
+	day, ok := ctx.Value(crawledDayKey{}).(time.Time)
+	return day, ok
+}
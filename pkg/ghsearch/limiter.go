@@ -0,0 +1,69 @@
+package ghsearch
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds how many searches run at once, to a limit that may be changed while they run,
+// such as to throttle a long crawl without restarting it.
+type Limiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	// changed is closed and replaced whenever a slot may have become free
+	changed chan struct{}
+}
+
+// NewLimiter returns a Limiter of limit searches at once, at least one.
+func NewLimiter(limit int) *Limiter {
+	return &Limiter{limit: max(limit, 1), changed: make(chan struct{})}
+}
+
+// SetLimit changes the limit to at least one search. Searches over a lowered limit are left to finish.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = max(limit, 1)
+	l.notify()
+}
+
+// Limit returns the current limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Acquire waits for a slot, returning an error if ctx is done first.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.notify()
+}
+
+// notify wakes the waiting searches, with mu held.
+func (l *Limiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
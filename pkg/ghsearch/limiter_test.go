@@ -0,0 +1,92 @@
+package ghsearch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquired returns a channel receiving the result of an Acquire of l with ctx.
+func acquired(ctx context.Context, l *Limiter) <-chan error {
+	ch := make(chan error, 1)
+	go func() { ch <- l.Acquire(ctx) }()
+	return ch
+}
+
+// expectBlocked fails the test if ch receives within a short wait.
+func expectBlocked(t *testing.T, ch <-chan error) {
+	t.Helper()
+	select {
+	case err := <-ch:
+		t.Fatalf("Acquire() = %v over the limit, want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// expectAcquired fails the test unless ch receives a nil error.
+func expectAcquired(t *testing.T, ch <-chan error) {
+	t.Helper()
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Fatalf("Acquire(): %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() still waiting with a free slot")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	if got := NewLimiter(0).Limit(); got != 1 {
+		t.Errorf("NewLimiter(0).Limit() = %d, want 1", got)
+	}
+	l := NewLimiter(2)
+	expectAcquired(t, acquired(ctx, l))
+	expectAcquired(t, acquired(ctx, l))
+	third := acquired(ctx, l)
+	expectBlocked(t, third)
+	l.Release()
+	expectAcquired(t, third)
+
+	// Raising the limit frees a slot for a waiting search
+	fourth := acquired(ctx, l)
+	expectBlocked(t, fourth)
+	l.SetLimit(3)
+	expectAcquired(t, fourth)
+
+	// Lowering it leaves the running searches, but no more start until they are under it
+	l.SetLimit(-1)
+	if got := l.Limit(); got != 1 {
+		t.Errorf("Limit() = %d after SetLimit(-1), want 1", got)
+	}
+	fifth := acquired(ctx, l)
+	l.Release()
+	l.Release()
+	expectBlocked(t, fifth)
+	l.Release()
+	expectAcquired(t, fifth)
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := acquired(ctx, l)
+	expectBlocked(t, waiting)
+	cancel()
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Acquire() = %v once canceled, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() still waiting once canceled")
+	}
+	// The canceled search took no slot
+	l.Release()
+	expectAcquired(t, acquired(context.Background(), l))
+}
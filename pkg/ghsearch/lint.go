@@ -0,0 +1,153 @@
+package ghsearch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// LintIssue is a problem with a search query found by LintQuery.
+type LintIssue struct {
+	// Term is the part of the query the issue is about.
+	Term string
+	// Warning is set if the query is valid, but may not crawl as intended.
+	Warning bool
+	Message string
+}
+
+func (i LintIssue) String() string {
+	kind := "error"
+	if i.Warning {
+		kind = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", kind, i.Term, i.Message)
+}
+
+var (
+	lintNumber = regexp.MustCompile(`^(\d+|[<>]=?\d+|\d+\.\.\d+|\d+\.\.\*|\*\.\.\d+)$`)
+	lintDate   = `\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2})?(Z|[+-]\d{2}:\d{2})?)?`
+	lintDates  = regexp.MustCompile(`^(` + lintDate + `|[<>]=?` + lintDate + `|` + lintDate + `\.\.` + lintDate + `|` + lintDate + `\.\.\*|\*\.\.` + lintDate + `)$`)
+)
+
+// lintQualifiers are the repository search qualifiers, each validating its value.
+// https://docs.github.com/en/search-github/searching-on-github/searching-for-repositories
+var lintQualifiers = map[string]func(string) bool{
+	"in":                 lintList("name", "description", "readme", "topics"),
+	"user":               lintAny,
+	"org":                lintAny,
+	"repo":               lintAny,
+	"size":               lintNumber.MatchString,
+	"followers":          lintNumber.MatchString,
+	"forks":              lintNumber.MatchString,
+	"stars":              lintNumber.MatchString,
+	"created":            lintDates.MatchString,
+	"pushed":             lintDates.MatchString,
+	"language":           lintAny,
+	"topic":              lintAny,
+	"topics":             lintNumber.MatchString,
+	"license":            lintAny,
+	"is":                 lintList("public", "private", "internal", "sponsorable", "template", "mirror", "archived"),
+	"mirror":             lintList("true", "false"),
+	"template":           lintList("true", "false"),
+	"archived":           lintList("true", "false"),
+	"fork":               lintList("true", "false", "only"),
+	"good-first-issues":  lintNumber.MatchString,
+	"help-wanted-issues": lintNumber.MatchString,
+	"has":                lintList("funding-file"),
+	"sort":               lintAny,
+}
+
+func lintAny(value string) bool {
+	return value != ""
+}
+
+// lintList returns a validator accepting a comma-separated list of values.
+func lintList(values ...string) func(string) bool {
+	return func(value string) bool {
+		for _, v := range strings.Split(value, ",") {
+			if !contains(values, v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitQuery splits a query into its terms, keeping double quoted text together.
+func splitQuery(query string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+// LintQuery checks the qualifiers of a query that will be crawled by field,
+// returning errors for invalid qualifiers and warnings for those that conflict with the crawl.
+func LintQuery(query, field string) []LintIssue {
+	terms, err := splitQuery(query)
+	if err != nil {
+		return []LintIssue{{Term: query, Message: err.Error()}}
+	}
+	var issues []LintIssue
+	for _, term := range terms {
+		// Quoted text and boolean operators are free text, not qualifiers
+		if strings.HasPrefix(term, `"`) || term == "AND" || term == "OR" || term == "NOT" {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(term, "-"), ":")
+		if !ok {
+			continue
+		}
+		valid, ok := lintQualifiers[key]
+		switch {
+		case !ok:
+			issues = append(issues, LintIssue{Term: term, Message: fmt.Sprintf("unknown qualifier %q, it will be searched for as text", key)})
+			continue
+		case !valid(strings.Trim(value, `"`)):
+			issues = append(issues, LintIssue{Term: term, Message: fmt.Sprintf("invalid value for %s", key)})
+			continue
+		}
+		// The crawl adds its own range, sort and fan-out qualifiers to every search
+		switch {
+		case key == field:
+			issues = append(issues, LintIssue{Term: term, Warning: true, Message: fmt.Sprintf("the crawl windows on %s, combining ranges may return nothing, use -resume or -min-stars instead", field)})
+		case key == "sort":
+			issues = append(issues, LintIssue{Term: term, Warning: true, Message: "the crawl sorts by the field, a second sort is ignored or conflicts"})
+		case key == "created":
+			issues = append(issues, LintIssue{Term: term, Warning: true, Message: "created fan-out bisects the creation time, a created range may leave batches stuck above 1000 results"})
+		case key == "language" && !strings.HasPrefix(term, "-"):
+			issues = append(issues, LintIssue{Term: term, Warning: true, Message: "do not combine with -language-fan-out, which adds its own language qualifier"})
+		}
+	}
+	return issues
+}
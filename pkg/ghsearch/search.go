@@ -0,0 +1,251 @@
+// Package ghsearch crawls the GitHub repository search beyond its 1000 result limit.
+package ghsearch
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// https://docs.github.com/en/graphql/reference/objects#repository
+type Repository struct {
+	DatabaseId     int
+	NameWithOwner  string
+	StargazerCount int
+	ForkCount      int
+	DiskUsage      int
+	Description    string
+	// CreatedAt is zero if GitHub returned none, see HasCreatedAt.
+	CreatedAt time.Time
+	// The flags are only fetched if Pages.Flags is set.
+	IsFork     bool `graphql:"isFork @include(if: $withFlags)"`
+	IsMirror   bool `graphql:"isMirror @include(if: $withFlags)"`
+	IsTemplate bool `graphql:"isTemplate @include(if: $withFlags)"`
+	IsArchived bool `graphql:"isArchived @include(if: $withFlags)"`
+	IsDisabled bool `graphql:"isDisabled @include(if: $withFlags)"`
+	// PrimaryLanguage is empty if GitHub has not detected any language.
+	PrimaryLanguage struct {
+		Name string
+	}
+	// LicenseInfo is empty if GitHub has not detected a license, NOASSERTION if it is unrecognized.
+	LicenseInfo struct {
+		SpdxId string
+	}
+	// Languages are only fetched if Pages.Languages is set, largest first.
+	Languages struct {
+		Edges []LanguageEdge
+	} `graphql:"languages(first: $languages, orderBy: {field: SIZE, direction: DESC}) @include(if: $withLanguages)"`
+	// RepositoryTopics are only fetched if Pages.Topics is set.
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string
+			}
+		}
+	} `graphql:"repositoryTopics(first: 20) @include(if: $withTopics)"`
+	// Owner is only fetched if Pages.Owner or Pages.OwnerHistory is set.
+	Owner struct {
+		// Typename is User or Organization.
+		Typename string `graphql:"__typename"`
+		User     struct {
+			DatabaseId int
+			// CreatedAt and Repositories are only fetched if Pages.OwnerHistory is set.
+			CreatedAt    time.Time `graphql:"createdAt @include(if: $withOwnerHistory)"`
+			Repositories struct {
+				TotalCount int
+			} `graphql:"repositories @include(if: $withOwnerHistory)"`
+		} `graphql:"... on User"`
+		Organization struct {
+			DatabaseId int
+			// IsVerified is whether the organization has verified its domains.
+			IsVerified bool
+		} `graphql:"... on Organization"`
+	} `graphql:"owner @include(if: $withOwner)"`
+}
+
+// LanguageEdge is the size of a language in a repository, in bytes.
+// https://docs.github.com/en/graphql/reference/objects#languageedge
+type LanguageEdge struct {
+	Size int
+	Node struct {
+		Name string
+	}
+}
+
+// OwnerDatabaseId returns the database ID of the user or organization owning the repository.
+func (r Repository) OwnerDatabaseId() int {
+	if r.Owner.Typename == "Organization" {
+		return r.Owner.Organization.DatabaseId
+	}
+	return r.Owner.User.DatabaseId
+}
+
+// HasCreatedAt reports whether CreatedAt is valid, as no repository predates GitHubLaunch.
+func (r Repository) HasCreatedAt() bool {
+	return !r.CreatedAt.Before(GitHubLaunch)
+}
+
+// Value returns the value of the named sort field (stars, forks or size).
+func (r Repository) Value(field string) int {
+	switch field {
+	case "stars":
+		return r.StargazerCount
+	case "forks":
+		return r.ForkCount
+	case "size":
+		return r.DiskUsage
+	}
+	return 0
+}
+
+// UnionRepositories merges the results of multiple searches, ordered by less, de-duplicated by DatabaseId
+// so a repository renamed between them is only kept once.
+func UnionRepositories(less func(a, b Repository) bool, results ...[]Repository) []Repository {
+	var repos []Repository
+	seen := make(map[int]struct{})
+	for _, result := range results {
+		for _, repo := range result {
+			if _, ok := seen[repo.DatabaseId]; !ok {
+				seen[repo.DatabaseId] = struct{}{}
+				repos = append(repos, repo)
+			}
+		}
+	}
+	sort.SliceStable(repos, func(i, j int) bool {
+		return less(repos[i], repos[j])
+	})
+	return repos
+}
+
+// Pages iterates over the pages of a repository search.
+type Pages struct {
+	client *githubv4.Client
+	query  string
+	cursor *githubv4.String
+	done   bool
+	// last identifies the repositories of the previous page.
+	last string
+	// Languages is how many of the largest languages of each repository to fetch, 0 for none.
+	Languages int
+	// Topics is whether to fetch the first 20 topics of each repository.
+	Topics bool
+	// Flags is whether to fetch whether each repository is a fork, mirror or template, archived or disabled.
+	Flags bool
+	// Owner is whether to fetch the type and database ID of the owner of each repository,
+	// and whether an organization is verified.
+	Owner bool
+	// OwnerHistory is whether to fetch the owner, when a user owner was created and how many repositories it has.
+	OwnerHistory bool
+	// Count is the total number of matching repositories once a page has been fetched,
+	// which may exceed the 1000 result limit.
+	Count int
+}
+
+// NewPages returns an iterator over the pages of a search of repositories matching the query.
+func NewPages(client *githubv4.Client, query string) *Pages {
+	return &Pages{client: client, query: query}
+}
+
+// Next fetches the next page of at most first repositories, returning nil once there are no more.
+// A page of only nodes GitHub failed to resolve is empty but not nil, and the search continues.
+// An empty page, or one of the same repositories as the previous page, also ends the search, as the
+// search API occasionally returns one page for every cursor and would otherwise never end.
+func (p *Pages) Next(ctx context.Context, first int) ([]Repository, error) {
+	if p.done {
+		return nil, nil
+	}
+	// https://docs.github.com/en/graphql/reference/queries#search
+	var q struct {
+		RateLimit struct {
+			Cost int
+		}
+		Search struct {
+			RepositoryCount int
+			Nodes           []struct {
+				Repository Repository `graphql:"... on Repository"`
+			}
+			PageInfo struct {
+				EndCursor   githubv4.String
+				HasNextPage bool
+			}
+		} `graphql:"search(query: $query, type: REPOSITORY, first: $first, after: $cursor)"`
+	}
+	if err := p.client.Query(ctx, &q, map[string]any{
+		"query":  githubv4.String(p.query),
+		"first":  githubv4.Int(first),
+		"cursor": p.cursor,
+		// The variable must still be valid when the languages are not included
+		"languages":     githubv4.Int(max(p.Languages, 1)),
+		"withLanguages": githubv4.Boolean(p.Languages > 0),
+		"withTopics":    githubv4.Boolean(p.Topics),
+		"withFlags":     githubv4.Boolean(p.Flags),
+		"withOwner":     githubv4.Boolean(p.Owner || p.OwnerHistory),
+		// The history is of the owner, so only included within it
+		"withOwnerHistory": githubv4.Boolean(p.OwnerHistory),
+	}); err != nil {
+		return nil, err
+	}
+	// https://docs.github.com/en/graphql/guides/using-pagination-in-the-graphql-api
+	p.Count = q.Search.RepositoryCount
+	if q.Search.PageInfo.HasNextPage {
+		p.cursor = githubv4.NewString(q.Search.PageInfo.EndCursor)
+	} else {
+		p.done = true
+	}
+	repos := make([]Repository, 0, len(q.Search.Nodes))
+	names := make([]string, 0, len(q.Search.Nodes))
+	for _, node := range q.Search.Nodes {
+		// A node GitHub failed to resolve is null
+		if node.Repository.NameWithOwner == "" {
+			continue
+		}
+		repos = append(repos, node.Repository)
+		names = append(names, node.Repository.NameWithOwner)
+	}
+	sort.Strings(names)
+	last := strings.Join(names, "\n")
+	if len(q.Search.Nodes) == 0 {
+		// An empty page can't be followed by more
+		p.done = true
+	} else if len(names) == 0 {
+		// A page of only null nodes can't be told apart from the previous page, so it can't be a repeat of it
+		return repos, nil
+	} else if last == p.last {
+		log.Printf("Search %q returned the same page for the next cursor, stopping", p.query)
+		p.done = true
+		return nil, nil
+	}
+	p.last = last
+	return repos, nil
+}
+
+// All fetches the remaining pages, at most limit repositories if positive.
+// The total number of matching repositories is also returned, which may exceed the 1000 result limit.
+func (p *Pages) All(ctx context.Context, limit int) ([]Repository, int, error) {
+	var repos []Repository
+	for limit <= 0 || len(repos) < limit {
+		first := 100
+		if limit > 0 {
+			first = min(first, limit-len(repos))
+		}
+		page, err := p.Next(ctx, first)
+		if err != nil {
+			return nil, 0, err
+		} else if page == nil {
+			break
+		}
+		repos = append(repos, page...)
+	}
+	return repos, p.Count, nil
+}
+
+// Search performs a search of repositories matching the query.
+// The total number of matching repositories is also returned, which may exceed the 1000 result limit.
+// If limit is positive, at most limit repositories are fetched.
+func Search(ctx context.Context, client *githubv4.Client, query string, limit int) ([]Repository, int, error) {
+	return NewPages(client, query).All(ctx, limit)
+}
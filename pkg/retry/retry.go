@@ -0,0 +1,243 @@
+// Package retry retries failed GitHub API requests with exponential backoff, honoring Retry-After.
+package retry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Class is why a request failed, deciding whether and how long to wait before retrying it.
+type Class int
+
+const (
+	// None is a successful request, or a failure that will not succeed if retried.
+	None Class = iota
+	// SecondaryRateLimit is a 403 or 429 response for making requests too quickly, or a GraphQL response of
+	// only a RATE_LIMITED error before the hourly limit is exhausted.
+	// https://docs.github.com/en/rest/using-the-rest-api/rate-limits-for-the-rest-api#about-secondary-rate-limits
+	SecondaryRateLimit
+	// Abuse is a 403 response from the older abuse detection mechanism.
+	Abuse
+	// PrimaryRateLimit is a 403 or 429 response, or a GraphQL response of only a RATE_LIMITED error,
+	// once the hourly limit is exhausted, retried after it resets.
+	PrimaryRateLimit
+	// ServerError is a 502, 503 or 504 response, usually a GitHub timeout on an expensive query.
+	ServerError
+	// Timeout is a network timeout, a connection refused, reset or broken, or a DNS lookup that may succeed
+	// if retried.
+	Timeout
+)
+
+func (c Class) String() string {
+	switch c {
+	case SecondaryRateLimit:
+		return "secondary rate limit"
+	case Abuse:
+		return "abuse detection"
+	case PrimaryRateLimit:
+		return "primary rate limit"
+	case ServerError:
+		return "server error"
+	case Timeout:
+		return "timeout"
+	default:
+		return "none"
+	}
+}
+
+// maxBodyPeek is how much of a 200, 403 or 429 response is read to tell the kind of rate limit apart.
+const maxBodyPeek = 4096
+
+// Classify decides why a round trip failed. The body of a 200, 403 or 429 response may be read to tell rate
+// limits apart from data or permission errors, in which case it is replaced.
+func Classify(resp *http.Response, err error) Class {
+	if err != nil {
+		var netErr net.Error
+		var dnsErr *net.DNSError
+		var tempErr interface{ Temporary() bool }
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// The caller gave up, not the network
+			return None
+		case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			// A host that doesn't exist won't by trying again
+			return None
+		case errors.As(err, &netErr) && netErr.Timeout(),
+			errors.Is(err, io.EOF),
+			errors.Is(err, io.ErrUnexpectedEOF),
+			errors.Is(err, net.ErrClosed),
+			errors.Is(err, syscall.ECONNRESET),
+			errors.Is(err, syscall.ECONNREFUSED),
+			errors.Is(err, syscall.EPIPE),
+			// Such as a connection reset on Windows, whose errors aren't the syscall ones above
+			errors.As(err, &tempErr) && tempErr.Temporary():
+			return Timeout
+		}
+		return None
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// GraphQL reports a rate limit as an error in a successful response
+		if graphQLRateLimited(peekBody(resp)) {
+			if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+				return PrimaryRateLimit
+			}
+			return SecondaryRateLimit
+		}
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ServerError
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return PrimaryRateLimit
+		} else if resp.Header.Get("Retry-After") != "" || resp.StatusCode == http.StatusTooManyRequests {
+			return SecondaryRateLimit
+		}
+		// Without headers only the message tells a rate limit from a lack of permission
+		body := peekBody(resp)
+		if graphQLRateLimited(body) {
+			return SecondaryRateLimit
+		}
+		message := strings.ToLower(string(body))
+		switch {
+		case strings.Contains(message, "secondary rate limit"):
+			return SecondaryRateLimit
+		case strings.Contains(message, "abuse"):
+			return Abuse
+		}
+	}
+	return None
+}
+
+// peekBody returns up to maxBodyPeek bytes of the body of resp, replacing it with one that reads them again.
+func peekBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyPeek))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return body
+}
+
+// graphQLRateLimited reports whether body is a whole GraphQL response without data whose errors include
+// one of type RATE_LIMITED. Any response of data is larger than maxBodyPeek, or has data, so isn't mistaken
+// for one by a repository mentioning RATE_LIMITED.
+// https://docs.github.com/en/graphql/overview/rate-limits-and-node-limits-for-the-graphql-api#exceeding-the-rate-limit
+func graphQLRateLimited(body []byte) bool {
+	if !bytes.Contains(body, []byte("RATE_LIMITED")) {
+		return false
+	}
+	var out struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Type string `json:"type"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &out) != nil || (len(out.Data) > 0 && string(out.Data) != "null") {
+		return false
+	}
+	for _, e := range out.Errors {
+		if e.Type == "RATE_LIMITED" {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAfter returns how long the response asks to wait before retrying, if it does.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		} else if date, err := http.ParseTime(value); err == nil {
+			return date.Sub(now), true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+	}
+	return 0, false
+}
+
+// Transport is a http.RoundTripper that retries requests failing with a retryable Class.
+type Transport struct {
+	Base http.RoundTripper
+	// MaxAttempts is the most times a request is sent, 1 to never retry.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubling with each attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff, and any Retry-After longer than it fails the request instead.
+	MaxDelay time.Duration
+}
+
+// NewTransport returns a Transport sending each request at most maxAttempts times,
+// backing off from one second up to maxDelay.
+func NewTransport(base http.RoundTripper, maxAttempts int, maxDelay time.Duration) *Transport {
+	return &Transport{Base: base, MaxAttempts: maxAttempts, BaseDelay: time.Second, MaxDelay: maxDelay}
+}
+
+// backoff returns the delay before retry attempt n (from 1), with full jitter in its upper half.
+func (t *Transport) backoff(n int) time.Duration {
+	d := t.BaseDelay << min(n-1, 30)
+	if d <= 0 || d > t.MaxDelay {
+		d = t.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.Base.RoundTrip(req)
+		class := Classify(resp, err)
+		if class == None || attempt >= t.MaxAttempts {
+			return resp, err
+		}
+		// The body has already been sent, so it must be replayable to retry
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		delay, ok := RetryAfter(resp, time.Now())
+		if ok && delay > t.MaxDelay {
+			log.Printf("%s on %s, not waiting %s to retry", class, req.URL, delay.Round(time.Second))
+			return resp, err
+		} else if !ok {
+			delay = t.backoff(attempt)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyPeek))
+			resp.Body.Close()
+		}
+		log.Printf("%s on %s (attempt %d/%d), retrying in %s", class, req.URL, attempt, t.MaxAttempts, delay.Round(time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
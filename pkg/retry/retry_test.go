@@ -0,0 +1,230 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// response returns a response of status with headers given as name, value pairs and body.
+func response(status int, body string, headers ...string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(body))}
+	for i := 0; i+1 < len(headers); i += 2 {
+		resp.Header.Set(headers[i], headers[i+1])
+	}
+	return resp
+}
+
+// opError returns the error of a failed dial or read of err, as the net package does.
+func opError(op string, err error) error {
+	return &url.Error{Op: "Post", URL: "https://api.github.com/graphql", Err: &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, err)}}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	rateLimited := `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit already exceeded for user ID 1."}]}`
+	for _, tt := range []struct {
+		name string
+		resp *http.Response
+		err  error
+		want Class
+	}{
+		{"200", response(200, `{"data":{"search":{}}}`), nil, None},
+		{"200 RATE_LIMITED exhausted", response(200, rateLimited, "X-RateLimit-Remaining", "0"), nil, PrimaryRateLimit},
+		{"200 RATE_LIMITED", response(200, rateLimited, "X-RateLimit-Remaining", "120"), nil, SecondaryRateLimit},
+		{"200 data mentioning RATE_LIMITED", response(200, `{"data":{"description":"RATE_LIMITED"},"errors":[{"type":"RATE_LIMITED"}]}`), nil, None},
+		{"200 other error", response(200, `{"errors":[{"type":"NOT_FOUND"}]}`), nil, None},
+		{"403 exhausted", response(403, `{"message":"API rate limit exceeded"}`, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "1700000000"), nil, PrimaryRateLimit},
+		{"403 Retry-After", response(403, `{"message":"?"}`, "Retry-After", "60", "X-RateLimit-Remaining", "4000"), nil, SecondaryRateLimit},
+		{"403 secondary rate limit without headers", response(403, `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes."}`), nil, SecondaryRateLimit},
+		{"403 abuse without headers", response(403, `{"message":"You have triggered an abuse detection mechanism."}`), nil, Abuse},
+		{"403 RATE_LIMITED without headers", response(403, rateLimited), nil, SecondaryRateLimit},
+		{"403 forbidden", response(403, `{"message":"Resource not accessible by integration"}`, "X-RateLimit-Remaining", "4000"), nil, None},
+		{"429", response(429, ""), nil, SecondaryRateLimit},
+		{"429 exhausted", response(429, "", "X-RateLimit-Remaining", "0"), nil, PrimaryRateLimit},
+		{"404", response(404, `{"message":"Not Found"}`), nil, None},
+		{"500", response(500, ""), nil, None},
+		{"502", response(502, "<html>"), nil, ServerError},
+		{"503", response(503, ""), nil, ServerError},
+		{"504", response(504, ""), nil, ServerError},
+		{"canceled", nil, &url.Error{Op: "Post", Err: context.Canceled}, None},
+		{"deadline", nil, fmt.Errorf("query: %w", context.DeadlineExceeded), None},
+		{"timeout", nil, &url.Error{Op: "Post", Err: timeoutError{}}, Timeout},
+		{"EOF", nil, &url.Error{Op: "Post", Err: io.EOF}, Timeout},
+		{"unexpected EOF", nil, fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), Timeout},
+		{"closed", nil, &url.Error{Op: "Post", Err: net.ErrClosed}, Timeout},
+		{"connection reset", nil, opError("read", syscall.ECONNRESET), Timeout},
+		{"connection refused", nil, opError("dial", syscall.ECONNREFUSED), Timeout},
+		{"broken pipe", nil, opError("write", syscall.EPIPE), Timeout},
+		{"other network error", nil, opError("dial", syscall.EACCES), None},
+		{"DNS not found", nil, &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "api.github.invalid", IsNotFound: true}}}, None},
+		{"DNS temporary", nil, &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "api.github.com", IsTemporary: true}}}, Timeout},
+		{"DNS timeout", nil, &net.DNSError{Err: "i/o timeout", Name: "api.github.com", IsTimeout: true}, Timeout},
+		{"other error", nil, errors.New("unsupported protocol scheme"), None},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			if tt.resp != nil {
+				b, _ := io.ReadAll(tt.resp.Body)
+				body = string(b)
+				tt.resp.Body = io.NopCloser(strings.NewReader(body))
+			}
+			if got := Classify(tt.resp, tt.err); got != tt.want {
+				t.Errorf("Classify() = %s, want %s", got, tt.want)
+			}
+			// Any of the body read to classify it can still be read
+			if tt.resp != nil {
+				if got, _ := io.ReadAll(tt.resp.Body); string(got) != body {
+					t.Errorf("body after Classify() = %q, want %q", got, body)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyLargeBody(t *testing.T) {
+	// A response larger than the peek is read whole after it
+	body := `{"data":{"description":"RATE_LIMITED ` + strings.Repeat("x", 3*maxBodyPeek) + `"}}`
+	resp := response(200, body)
+	if got := Classify(resp, nil); got != None {
+		t.Errorf("Classify() = %s, want %s", got, None)
+	}
+	if got, _ := io.ReadAll(resp.Body); string(got) != body {
+		t.Errorf("read %d bytes after Classify(), want %d", len(got), len(body))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name string
+		resp *http.Response
+		want time.Duration
+		ok   bool
+	}{
+		{"none", nil, 0, false},
+		{"seconds", response(403, "", "Retry-After", "60"), time.Minute, true},
+		{"date", response(429, "", "Retry-After", now.Add(90*time.Second).Format(http.TimeFormat)), 90 * time.Second, true},
+		{"reset", response(403, "", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10)), 10 * time.Minute, true},
+		{"Retry-After before reset", response(403, "", "Retry-After", "5", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10)), 5 * time.Second, true},
+		{"reset with quota left", response(403, "", "X-RateLimit-Remaining", "10", "X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10)), 0, false},
+		{"invalid", response(403, "", "Retry-After", "soon", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "later"), 0, false},
+		{"no headers", response(502, ""), 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RetryAfter(tt.resp, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("RetryAfter() = %s, %t, want %s, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	transport := &Transport{BaseDelay: time.Second, MaxDelay: time.Minute}
+	for _, tt := range []struct {
+		attempt int
+		// The delay is jittered within [max/2, max]
+		max time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{40, time.Minute},
+		// Not overflowing into a negative delay
+		{100, time.Minute},
+	} {
+		for i := 0; i < 100; i++ {
+			if got := transport.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// statuses are the responses to each attempt, the last repeated
+		statuses    []int
+		headers     []string
+		maxAttempts int
+		wantStatus  int
+		wantSent    int
+	}{
+		{"success", []int{200}, nil, 3, 200, 1},
+		{"retried", []int{502, 503, 200}, nil, 5, 200, 3},
+		{"gives up", []int{502}, nil, 3, 502, 3},
+		{"not retried", []int{404}, nil, 3, 404, 1},
+		{"secondary rate limit", []int{429, 200}, []string{"Retry-After", "0"}, 3, 200, 2},
+		{"Retry-After past the max delay", []int{429, 200}, []string{"Retry-After", "3600"}, 3, 429, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(sent.Add(1))
+				if body, _ := io.ReadAll(r.Body); string(body) != "query" {
+					t.Errorf("attempt %d sent body %q", n, body)
+				}
+				status := tt.statuses[min(n, len(tt.statuses))-1]
+				if status != 200 {
+					for i := 0; i+1 < len(tt.headers); i += 2 {
+						w.Header().Set(tt.headers[i], tt.headers[i+1])
+					}
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+			transport := &Transport{Base: http.DefaultTransport, MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("query"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || int(sent.Load()) != tt.wantSent {
+				t.Errorf("got %d after %d attempts, want %d after %d", resp.StatusCode, sent.Load(), tt.wantStatus, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestTransportCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	transport := &Transport{Base: http.DefaultTransport, MaxAttempts: 10, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() waiting to retry = %v, want %v", err, context.DeadlineExceeded)
+	}
+}